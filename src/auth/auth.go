@@ -4,6 +4,9 @@ package auth
 type Auth interface {
 	Login() error
 	Logout() error
+	// Refresh requests a new token immediately, e.g. after the current token has been
+	// rejected, and sends it to the token channel
+	Refresh() (Token, error)
 }
 
 // Token contains the token, which will be used to authenticate
@@ -11,3 +14,9 @@ type Token interface {
 	// return the token as string
 	AuthToken() string
 }
+
+// Header is implemented by tokens, which are not sent in the token header of the requests
+type Header interface {
+	// AuthHeader returns the name and the value of the header, which carries the token
+	AuthHeader() (string, string)
+}
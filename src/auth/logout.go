@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"k8s.io/klog"
+)
+
+var logouts = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "analysis_connector_logouts_total",
+	Help: "The number of logouts at the identity providers by their outcome",
+}, []string{"issuer", "result"})
+
+// session stops the renewal of the tokens of a login
+type session struct {
+	quit chan struct{}
+	once sync.Once
+}
+
+func newSession() *session {
+	return &session{quit: make(chan struct{})}
+}
+
+// stop stops the renewal; it can be called more than once and without login
+func (s *session) stop() {
+	if s == nil {
+		return
+	}
+	s.once.Do(func() {
+		close(s.quit)
+	})
+}
+
+// logoutDone logs and exports the outcome of a logout
+func logoutDone(issuer, reason string, err error) error {
+	if err != nil {
+		klog.Errorf("cannot log out at %s on %s: %s", issuer, reason, err)
+		logouts.WithLabelValues(issuer, "failed").Inc()
+		return err
+	}
+
+	klog.Infof("logged out at %s on %s", issuer, reason)
+	tokenExpiry.DeleteLabelValues(issuer)
+	logouts.WithLabelValues(issuer, "revoked").Inc()
+	return nil
+}
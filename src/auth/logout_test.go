@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOAuth2Logout(t *testing.T) {
+	testTable := []struct {
+		description string
+		refresh     string
+		access      string
+		revocation  bool
+		form        string
+		expectErr   bool
+	}{
+		{
+			description: "revoked refresh token",
+			refresh:     "refresh",
+			access:      "access",
+			revocation:  true,
+			form:        "client_id=edge&client_secret=secret&token=refresh&token_type_hint=refresh_token",
+		},
+		{
+			description: "revoked access token",
+			access:      "access",
+			revocation:  true,
+			form:        "client_id=edge&client_secret=secret&token=access&token_type_hint=access_token",
+		},
+		{
+			description: "failed revocation",
+			refresh:     "invalid",
+			revocation:  true,
+			form:        "client_id=edge&client_secret=secret&token=invalid&token_type_hint=refresh_token",
+			expectErr:   true,
+		},
+		{
+			description: "without revocation endpoint",
+			refresh:     "refresh",
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			var form string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil {
+					t.Errorf("cannot parse form: %s", err)
+				}
+				form = r.PostForm.Encode()
+
+				if r.PostForm.Get("token") == "invalid" {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer ts.Close()
+
+			config := OAuth2Config{Grant: ClientCredentials, ClientID: "edge", ClientSecret: "secret"}
+			if test.revocation {
+				config.RevocationURL = ts.URL
+			}
+
+			a, err := NewOAuth2Auth(make(chan Token, 1), config, DefaultRenewal)
+			if err != nil {
+				t.Fatalf("cannot create token provider: %s", err)
+			}
+
+			o := a.(*oauth2Auth)
+			o.refreshToken, o.accessToken = test.refresh, test.access
+
+			if err := o.Logout(); (err != nil) != test.expectErr {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if form != test.form {
+				t.Errorf("unexpected revocation request: %s != %s", form, test.form)
+			}
+
+			if o.refreshToken != "" || o.accessToken != "" {
+				t.Errorf("tokens are kept after the logout")
+			}
+		})
+	}
+}
+
+func TestOidcLogout(t *testing.T) {
+	testTable := []struct {
+		description string
+		logout      bool
+		token       string
+		requests    int
+		expectErr   bool
+	}{
+		{
+			description: "ended session",
+			logout:      true,
+			token:       "token",
+			requests:    1,
+		},
+		{
+			description: "failed logout",
+			logout:      true,
+			token:       "invalid",
+			requests:    1,
+			expectErr:   true,
+		},
+		{
+			description: "without end session endpoint",
+			token:       "token",
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			var requests int
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if err := r.ParseForm(); err != nil {
+					t.Errorf("cannot parse form: %s", err)
+				}
+
+				cookie, err := r.Cookie("session")
+				if r.Method != http.MethodPost || r.URL.Path != "/auth/protocol/openid-connect/logout" || err != nil || cookie.Value != "id" || r.PostForm.Get("id_token_hint") != "token" {
+					w.WriteHeader(http.StatusBadRequest)
+				}
+			}))
+			defer ts.Close()
+
+			o := &oidcAuth{url: "127.0.0.1", port: ts.Listener.Addr().(*net.TCPAddr).Port, schema: "http", path: "auth"}
+			if test.logout {
+				o.logoutURL = ts.URL + "/auth/protocol/openid-connect/logout"
+			}
+			o.cookies = []*http.Cookie{{Name: "session", Value: "id"}}
+			o.token = test.token
+
+			if err := o.Logout(); (err != nil) != test.expectErr {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			// the ended session is not ended a second time
+			if err := o.Logout(); err != nil {
+				t.Errorf("unexpected error of the second logout: %s", err)
+			}
+
+			if requests != test.requests {
+				t.Errorf("unexpected number of logout requests: %d != %d", requests, test.requests)
+			}
+		})
+	}
+}
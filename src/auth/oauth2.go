@@ -0,0 +1,291 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// GrantType is the OAuth2 grant, which is used to request the first token at the token
+// endpoint
+type GrantType string
+
+const (
+	// ClientCredentials authenticates the connector as confidential client without user
+	ClientCredentials GrantType = "client_credentials"
+	// PasswordGrant authenticates the user of the connector with its password
+	PasswordGrant GrantType = "password"
+	// RefreshTokenGrant starts the session with a configured refresh token, like an offline
+	// token
+	RefreshTokenGrant GrantType = "refresh_token"
+)
+
+// OAuth2Config defines the token endpoint and the credentials of an OAuth2 client
+type OAuth2Config struct {
+	// TokenURL is the address of the token endpoint
+	TokenURL string
+	// Grant is the grant of the first token request
+	Grant        GrantType
+	ClientID     string
+	ClientSecret string
+	// Scope is the space separated list of the requested scopes; it is optional
+	Scope    string
+	User     string
+	Password string
+	// RefreshToken is the refresh token of the refresh token grant
+	RefreshToken string
+	// RevocationURL is the address of the token revocation endpoint (RFC 7009); without
+	// revocation endpoint the tokens are not revoked on logout
+	RevocationURL string
+	// Client is the client of the requests to the identity provider; without client the
+	// default client is used
+	Client *http.Client
+}
+
+// bearerToken is an access token, which is sent in the authorization header
+type bearerToken struct {
+	Token string
+	Valid time.Time
+}
+
+// AuthToken return the token as string
+func (t bearerToken) AuthToken() string {
+	return t.Token
+}
+
+func (t bearerToken) expiry() time.Time {
+	return t.Valid
+}
+
+// AuthHeader returns the authorization header of the token
+func (t bearerToken) AuthHeader() (string, string) {
+	return "Authorization", "Bearer " + t.Token
+}
+
+type oauth2Auth struct {
+	tokenChan chan<- Token
+	config    OAuth2Config
+	renewal   Renewal
+
+	lock         sync.Mutex
+	refreshToken string
+	accessToken  string
+	renewing     *session
+}
+
+// NewOAuth2Auth create a new authentication client, which requests the tokens directly
+// from the token endpoint of an OAuth2 identity provider. Refresh tokens, which are
+// returned by the identity provider, replace the previous refresh token.
+func NewOAuth2Auth(tokenChan chan<- Token, config OAuth2Config, renewal Renewal) (Auth, error) {
+	switch config.Grant {
+	case ClientCredentials:
+		if config.ClientID == "" {
+			return nil, fmt.Errorf("client credentials grant requires a client id")
+		}
+	case PasswordGrant:
+		if config.User == "" {
+			return nil, fmt.Errorf("password grant requires a user")
+		}
+	case RefreshTokenGrant:
+		if config.RefreshToken == "" {
+			return nil, fmt.Errorf("refresh token grant requires a refresh token")
+		}
+	default:
+		return nil, fmt.Errorf("unknown grant type %s", config.Grant)
+	}
+
+	return &oauth2Auth{tokenChan: tokenChan, config: config, renewal: renewal, refreshToken: config.RefreshToken}, nil
+}
+
+// Login requests the first token and renews it before its expiry
+func (o *oauth2Auth) Login() error {
+	token, err := o.request(o.grant())
+	if err != nil {
+		return err
+	}
+
+	s := newSession()
+	o.lock.Lock()
+	o.renewing.stop()
+	o.renewing = s
+	o.lock.Unlock()
+
+	publish(o.tokenChan, o.config.TokenURL, token)
+	go o.renewal.renew(o.tokenChan, o.config.TokenURL, token, func() (expiring, error) {
+		return o.renew()
+	}, s.quit)
+	return nil
+}
+
+// renew requests a new token with the refresh token, as long as the identity provider
+// returns one. The first grant is repeated, if the refresh token has been rejected.
+func (o *oauth2Auth) renew() (bearerToken, error) {
+	token, err := o.request(o.refresh())
+	if err == nil {
+		return token, nil
+	}
+
+	klog.Warningf("cannot refresh token at %s, request a new token: %s", o.config.TokenURL, err)
+	return o.request(o.grant())
+}
+
+// Refresh requests a new token immediately
+func (o *oauth2Auth) Refresh() (Token, error) {
+	token, err := o.renew()
+	if err != nil {
+		return nil, err
+	}
+
+	publish(o.tokenChan, o.config.TokenURL, token)
+	return token, nil
+}
+
+// httpClient returns the client of the requests to the identity provider
+func (o *oauth2Auth) httpClient() *http.Client {
+	if o.config.Client == nil {
+		return http.DefaultClient
+	}
+	return o.config.Client
+}
+
+// grant returns the form of the first token request
+func (o *oauth2Auth) grant() url.Values {
+	form := url.Values{"grant_type": []string{string(o.config.Grant)}}
+	switch o.config.Grant {
+	case PasswordGrant:
+		form.Set("username", o.config.User)
+		form.Set("password", o.config.Password)
+	case RefreshTokenGrant:
+		form.Set("refresh_token", o.config.RefreshToken)
+	}
+	return form
+}
+
+// refresh returns the form of a refresh token request or the form of the first token
+// request, if no refresh token has been returned
+func (o *oauth2Auth) refresh() url.Values {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.refreshToken == "" {
+		return o.grant()
+	}
+	return url.Values{
+		"grant_type":    []string{string(RefreshTokenGrant)},
+		"refresh_token": []string{o.refreshToken},
+	}
+}
+
+// request requests a token at the token endpoint and stores the returned refresh token
+func (o *oauth2Auth) request(form url.Values) (bearerToken, error) {
+	form.Set("client_id", o.config.ClientID)
+	if o.config.ClientSecret != "" {
+		form.Set("client_secret", o.config.ClientSecret)
+	}
+	if o.config.Scope != "" {
+		form.Set("scope", o.config.Scope)
+	}
+
+	res, err := o.httpClient().Post(o.config.TokenURL, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return bearerToken{}, err
+	}
+
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			klog.Errorf("cannot close response body: %s", err)
+		}
+	}()
+
+	bod, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return bearerToken{}, err
+	}
+
+	var respJSON struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		RefreshToken     string `json:"refresh_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	if err := json.Unmarshal(bod, &respJSON); err != nil && res.StatusCode == http.StatusOK {
+		return bearerToken{}, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return bearerToken{}, fmt.Errorf("token request failed with status code %d: %s %s", res.StatusCode, respJSON.Error, respJSON.ErrorDescription)
+	}
+
+	if respJSON.AccessToken == "" {
+		return bearerToken{}, fmt.Errorf("token response contains no access token")
+	}
+
+	o.lock.Lock()
+	o.accessToken = respJSON.AccessToken
+	if respJSON.RefreshToken != "" {
+		o.refreshToken = respJSON.RefreshToken
+	}
+	o.lock.Unlock()
+
+	token := bearerToken{Token: respJSON.AccessToken}
+	if respJSON.ExpiresIn > 0 {
+		token.Valid = time.Now().Add(time.Duration(respJSON.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+// Logout stops the renewal of the tokens and revokes the refresh token or, without refresh
+// token, the access token at the revocation endpoint
+func (o *oauth2Auth) Logout() error {
+	o.lock.Lock()
+	o.renewing.stop()
+	token, hint := o.refreshToken, "refresh_token"
+	if token == "" {
+		token, hint = o.accessToken, "access_token"
+	}
+	o.refreshToken, o.accessToken = "", ""
+	o.lock.Unlock()
+
+	if o.config.RevocationURL == "" || token == "" {
+		klog.Infof("no token of %s is revoked, the session ends with the expiry of the tokens", o.config.TokenURL)
+		tokenExpiry.DeleteLabelValues(o.config.TokenURL)
+		return nil
+	}
+	return logoutDone(o.config.TokenURL, "logout", o.revoke(token, hint))
+}
+
+// revoke revokes a token at the revocation endpoint
+func (o *oauth2Auth) revoke(token, hint string) error {
+	form := url.Values{
+		"token":           []string{token},
+		"token_type_hint": []string{hint},
+		"client_id":       []string{o.config.ClientID},
+	}
+	if o.config.ClientSecret != "" {
+		form.Set("client_secret", o.config.ClientSecret)
+	}
+
+	res, err := o.httpClient().Post(o.config.RevocationURL, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+
+	if err := res.Body.Close(); err != nil {
+		klog.Errorf("cannot close response body: %s", err)
+	}
+
+	// the revocation endpoint responds with 200 for revoked and for invalid tokens
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("token revocation failed with status code %d", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOAuth2Request(t *testing.T) {
+	var forms []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("cannot parse form: %s", err)
+		}
+		forms = append(forms, r.PostForm.Encode())
+
+		switch r.PostForm.Get("grant_type") {
+		case "client_credentials":
+			fmt.Fprint(w, `{"access_token": "access1", "expires_in": 60, "refresh_token": "refresh1"}`)
+		case "password":
+			if r.PostForm.Get("password") != "password" {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"error": "invalid_grant", "error_description": "invalid user credentials"}`)
+				return
+			}
+			fmt.Fprint(w, `{"access_token": "access2"}`)
+		case "refresh_token":
+			fmt.Fprintf(w, `{"access_token": "access3", "expires_in": 60, "refresh_token": "%s-rotated"}`, r.PostForm.Get("refresh_token"))
+		}
+	}))
+	defer ts.Close()
+
+	testTable := []struct {
+		description string
+		config      OAuth2Config
+		token       string
+		expires     bool
+		refresh     string
+		form        string
+		expectErr   bool
+	}{
+		{
+			description: "client credentials",
+			config:      OAuth2Config{Grant: ClientCredentials, ClientID: "edge", ClientSecret: "secret", Scope: "upload"},
+			token:       "access1",
+			expires:     true,
+			refresh:     "refresh1",
+			form:        "client_id=edge&client_secret=secret&grant_type=client_credentials&scope=upload",
+		},
+		{
+			description: "password grant",
+			config:      OAuth2Config{Grant: PasswordGrant, ClientID: "edge", User: "user", Password: "password"},
+			token:       "access2",
+			form:        "client_id=edge&grant_type=password&password=password&username=user",
+		},
+		{
+			description: "rotated refresh token",
+			config:      OAuth2Config{Grant: RefreshTokenGrant, ClientID: "edge", RefreshToken: "offline"},
+			token:       "access3",
+			expires:     true,
+			refresh:     "offline-rotated",
+			form:        "client_id=edge&grant_type=refresh_token&refresh_token=offline",
+		},
+		{
+			description: "invalid credentials",
+			config:      OAuth2Config{Grant: PasswordGrant, ClientID: "edge", User: "user", Password: "wrong"},
+			form:        "client_id=edge&grant_type=password&password=wrong&username=user",
+			expectErr:   true,
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			forms = nil
+			test.config.TokenURL = ts.URL
+
+			a, err := NewOAuth2Auth(make(chan Token, 1), test.config, DefaultRenewal)
+			if err != nil {
+				t.Fatalf("cannot create token provider: %s", err)
+			}
+
+			o := a.(*oauth2Auth)
+			token, err := o.request(o.grant())
+			if (err != nil) != test.expectErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(forms) != 1 || forms[0] != test.form {
+				t.Errorf("unexpected token requests: %v", forms)
+			}
+
+			if token.Token != test.token || token.Valid.IsZero() == test.expires {
+				t.Errorf("unexpected token: %v", token)
+			}
+
+			if o.refreshToken != test.refresh && test.refresh != "" {
+				t.Errorf("unexpected refresh token: %s != %s", o.refreshToken, test.refresh)
+			}
+
+			if name, value := token.AuthHeader(); !test.expectErr && (name != "Authorization" || value != "Bearer "+test.token) {
+				t.Errorf("unexpected header: %s: %s", name, value)
+			}
+		})
+	}
+}
+
+func TestNewOAuth2Auth(t *testing.T) {
+	testTable := []struct {
+		description string
+		config      OAuth2Config
+	}{
+		{
+			description: "client credentials without client",
+			config:      OAuth2Config{Grant: ClientCredentials},
+		},
+		{
+			description: "password grant without user",
+			config:      OAuth2Config{Grant: PasswordGrant, ClientID: "edge"},
+		},
+		{
+			description: "refresh token grant without token",
+			config:      OAuth2Config{Grant: RefreshTokenGrant, ClientID: "edge"},
+		},
+		{
+			description: "unknown grant",
+			config:      OAuth2Config{Grant: "implicit", ClientID: "edge"},
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			if _, err := NewOAuth2Auth(make(chan Token, 1), test.config, DefaultRenewal); err == nil {
+				t.Errorf("invalid configuration has been accepted")
+			}
+		})
+	}
+}
+
+func TestStaticAuth(t *testing.T) {
+	testTable := []struct {
+		description string
+		header      string
+		name        string
+		value       string
+	}{
+		{
+			description: "bearer token",
+			name:        "Authorization",
+			value:       "Bearer secret",
+		},
+		{
+			description: "api key",
+			header:      "X-API-Key",
+			name:        "X-API-Key",
+			value:       "secret",
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			tokenChan := make(chan Token, 1)
+			if err := NewStaticAuth(tokenChan, test.header, "secret").Login(); err != nil {
+				t.Fatalf("cannot login: %s", err)
+			}
+
+			token := (<-tokenChan).(Header)
+			if name, value := token.AuthHeader(); name != test.name || value != test.value {
+				t.Errorf("unexpected header: %s: %s", name, value)
+			}
+		})
+	}
+}
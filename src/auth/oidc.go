@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/net/html"
@@ -14,15 +15,23 @@ import (
 )
 
 type oidcAuth struct {
-	tokenChan    chan<- Token
-	url          string
-	path         string
-	user         string
-	password     string
-	schema       string
-	port         int
+	tokenChan chan<- Token
+	url       string
+	path      string
+	user      string
+	password  string
+	logoutURL string
+	schema    string
+	port      int
+	renewal   Renewal
+	client    *http.Client
+
+	lock         sync.Mutex
 	refreshURL   string
 	refreshQuery string
+	cookies      []*http.Cookie
+	token        string
+	renewing     *session
 }
 
 type oidcToken struct {
@@ -35,115 +44,180 @@ func (t oidcToken) AuthToken() string {
 	return t.Token
 }
 
-// NewOidcAuth create an new authentication client with oidc
-func NewOidcAuth(tokenChan chan<- Token, schema, baseURL, path string, port int, user, password string) Auth {
-	return oidcAuth{
+func (t oidcToken) expiry() time.Time {
+	return t.Valid
+}
+
+// NewOidcAuth create an new authentication client with oidc; the session is ended at the
+// end session endpoint of the logout url, an empty logout url only drops the session
+func NewOidcAuth(tokenChan chan<- Token, schema, baseURL, path string, port int, user, password, logoutURL string, renewal Renewal, client *http.Client) Auth {
+	return &oidcAuth{
 		tokenChan: tokenChan,
 		url:       baseURL,
 		path:      path,
 		schema:    schema,
 		user:      user,
 		password:  password,
+		logoutURL: logoutURL,
 		port:      port,
+		renewal:   renewal,
+		client:    client,
+	}
+}
+
+// httpClient returns the client of the requests to the user management
+func (o *oidcAuth) httpClient() *http.Client {
+	if o.client == nil {
+		return http.DefaultClient
 	}
+	return o.client
+}
+
+// issuer returns the address of the user management
+func (o *oidcAuth) issuer() string {
+	return fmt.Sprintf("%s://%s:%d/%s", o.schema, o.url, o.port, o.path)
 }
 
 // Login perform the login with oidc
-func (o oidcAuth) Login() error {
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s://%s:%d/%s", o.schema, o.url, o.port, o.path), nil)
+func (o *oidcAuth) Login() error {
+	token, err := o.login()
 	if err != nil {
 		return err
 	}
 
-	res, err := http.DefaultClient.Do(req)
+	s := newSession()
+	o.lock.Lock()
+	o.renewing.stop()
+	o.renewing = s
+	o.lock.Unlock()
+
+	publish(o.tokenChan, o.issuer(), token)
+	go o.renewal.renew(o.tokenChan, o.issuer(), token, func() (expiring, error) {
+		return o.refresh()
+	}, s.quit)
+	return nil
+}
+
+// login opens a new session at the login form and requests the first token of the session
+func (o *oidcAuth) login() (oidcToken, error) {
+	req, err := http.NewRequest(http.MethodGet, o.issuer(), nil)
 	if err != nil {
-		return err
+		return oidcToken{}, err
+	}
+
+	res, err := o.httpClient().Do(req)
+	if err != nil {
+		return oidcToken{}, err
 	}
 
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			klog.Errorf("cannot close response body: %s", err)
+		}
+	}()
+
 	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("initial request was not successfull")
+		return oidcToken{}, fmt.Errorf("initial request was not successfull")
 	}
 
 	body, err := html.Parse(res.Body)
 	if err != nil {
-		return err
+		return oidcToken{}, err
 	}
 
-	o.refreshQuery = res.Request.URL.RawQuery
-	o.refreshURL = fmt.Sprintf("%s://%s%s", res.Request.URL.Scheme, res.Request.URL.Host, res.Request.URL.Path)
-
 	targetAddress := o.findTargetInForm(body)
 	if targetAddress == "" {
-		return fmt.Errorf("no address found -> cannot login")
+		return oidcToken{}, fmt.Errorf("no address found -> cannot login")
 	}
 
-	go o.renew(targetAddress, res.Cookies())
-
-	return err
-}
-
-func (o oidcAuth) renew(address string, cookies []*http.Cookie) {
-	token, err := o.getInitialToken(address, cookies)
+	token, err := o.getInitialToken(targetAddress, res.Cookies())
 	if err != nil {
-		klog.Errorf("cannot receive token: %s", err)
+		return oidcToken{}, err
 	}
-	klog.V(2).Infof("token: %v", token)
 
-	for {
+	o.lock.Lock()
+	o.refreshQuery = res.Request.URL.RawQuery
+	o.refreshURL = fmt.Sprintf("%s://%s%s", res.Request.URL.Scheme, res.Request.URL.Host, res.Request.URL.Path)
+	o.cookies = res.Cookies()
+	o.token = token.Token
+	o.lock.Unlock()
+	return token, nil
+}
 
-		o.tokenChan <- token
-		now := time.Now()
-		dura := token.Valid.Sub(now)
-		time.Sleep(dura)
+// refresh requests a new token within the session; a new session is opened, if the
+// session is gone
+func (o *oidcAuth) refresh() (oidcToken, error) {
+	o.lock.Lock()
+	refreshURL, cookies := o.refreshURL, o.cookies
+	o.lock.Unlock()
+
+	token, err := o.getFollowUpToken(refreshURL, cookies)
+	if err == nil {
+		o.lock.Lock()
+		o.token = token.Token
+		o.lock.Unlock()
+		return token, nil
+	}
 
-		klog.Infof("refreshURL: %s", o.refreshURL)
-		token, err = o.getFollowUpToken(o.refreshURL, cookies)
-		if err != nil {
-			klog.Errorf("cannot receive follow up token: %s", err)
-		}
+	// the abandoned session is ended, before a new session is opened
+	klog.Warningf("cannot receive follow up token, login again: %s", err)
+	_ = o.endSession("session rotation")
+	return o.login()
+}
 
-		klog.V(2).Infof("token: %v", token)
+// Refresh requests a new token immediately
+func (o *oidcAuth) Refresh() (Token, error) {
+	token, err := o.refresh()
+	if err != nil {
+		return nil, err
 	}
+
+	publish(o.tokenChan, o.issuer(), token)
+	return token, nil
 }
 
-func (o oidcAuth) getFollowUpToken(targetAddress string, cookies []*http.Cookie) (oidcToken, error) {
-	klog.Infof("target address: %s\n", targetAddress)
+func (o *oidcAuth) getFollowUpToken(targetAddress string, cookies []*http.Cookie) (oidcToken, error) {
 	req, err := http.NewRequest(http.MethodGet, targetAddress, nil)
 	if err != nil {
 		return oidcToken{}, err
 	}
 
+	o.lock.Lock()
 	klog.V(2).Infof("raw query: %s", o.refreshQuery)
 	req.URL.RawQuery = o.refreshQuery
+	o.lock.Unlock()
 
 	for _, cookie := range cookies {
 		req.AddCookie(cookie)
 	}
 
-	//req.Header.Add("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
-	//req.Header.Add("Connection", "keep-alive")
-	//req.Header.Add("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:84.0) Gecko/20100101 Firefox/84.0")
-
-	res, err := http.DefaultClient.Do(req)
+	res, err := o.httpClient().Do(req)
 	if err != nil {
 		return oidcToken{}, err
 	}
 
-	//bod, err := ioutil.ReadAll(res.Body)
-	//if err != nil {
-	//	return oidcToken{}, err
-	//}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			klog.Errorf("cannot close response body: %s", err)
+		}
+	}()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return oidcToken{}, fmt.Errorf("follow up request failed with status code %d", res.StatusCode)
+	}
 
 	body, err := html.Parse(res.Body)
 	if err != nil {
 		return oidcToken{}, err
 	}
 	addre := o.findTargetInForm(body)
+	if addre == "" {
+		return oidcToken{}, fmt.Errorf("no address found, the session is gone")
+	}
 	return o.getInitialToken(addre, cookies)
-
 }
 
-func (o oidcAuth) getInitialToken(targetAddress string, cookies []*http.Cookie) (oidcToken, error) {
+func (o *oidcAuth) getInitialToken(targetAddress string, cookies []*http.Cookie) (oidcToken, error) {
 	data := url.Values{
 		"username": []string{o.user},
 		"password": []string{o.password},
@@ -159,13 +233,20 @@ func (o oidcAuth) getInitialToken(targetAddress string, cookies []*http.Cookie)
 	}
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := o.httpClient().Do(req)
 	if err != nil {
 		return oidcToken{}, err
 	}
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return oidcToken{}, err
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			klog.Errorf("cannot close response body: %s", err)
+		}
+	}()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return oidcToken{}, fmt.Errorf("token request failed with status code %d", res.StatusCode)
 	}
 
 	bod, err := ioutil.ReadAll(res.Body)
@@ -173,9 +254,6 @@ func (o oidcAuth) getInitialToken(targetAddress string, cookies []*http.Cookie)
 		return oidcToken{}, err
 	}
 
-	klog.Infof("StatusCode in get initial token is: %d", res.StatusCode)
-	klog.V(2).Infoln(string(bod))
-
 	var respJSON struct {
 		Token string `json:"token"`
 		Valid string `json:"valid"`
@@ -198,25 +276,60 @@ func (o oidcAuth) getInitialToken(targetAddress string, cookies []*http.Cookie)
 	return tok, nil
 }
 
-// Logout perform the logout
-func (o oidcAuth) Logout() error {
-	req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s://%s/%s", o.schema, o.url, o.path), nil)
+// Logout stops the renewal of the tokens and ends the session at the user management
+func (o *oidcAuth) Logout() error {
+	o.lock.Lock()
+	o.renewing.stop()
+	o.lock.Unlock()
+
+	return o.endSession("logout")
+}
+
+// endSession ends the session of the login with its cookies and its latest token as id
+// token hint at the end session endpoint of the user management
+func (o *oidcAuth) endSession(reason string) error {
+	o.lock.Lock()
+	cookies, token := o.cookies, o.token
+	o.cookies, o.token = nil, ""
+	o.lock.Unlock()
+
+	if o.logoutURL == "" || token == "" {
+		klog.Infof("no session of %s is ended, the session ends with the expiry of the token", o.issuer())
+		tokenExpiry.DeleteLabelValues(o.issuer())
+		return nil
+	}
+	return logoutDone(o.issuer(), reason, o.logout(token, cookies))
+}
+
+// logout sends the logout request of a session to the end session endpoint
+func (o *oidcAuth) logout(token string, cookies []*http.Cookie) error {
+	form := url.Values{"id_token_hint": []string{token}}
+	req, err := http.NewRequest(http.MethodPost, o.logoutURL, strings.NewReader(form.Encode()))
 	if err != nil {
 		return err
 	}
 
-	res, err := http.DefaultClient.Do(req)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := o.httpClient().Do(req)
 	if err != nil {
 		return err
 	}
 
+	if err := res.Body.Close(); err != nil {
+		klog.Errorf("cannot close response body: %s", err)
+	}
+
 	if res.StatusCode >= 200 && res.StatusCode < 300 {
 		return nil
 	}
-	return fmt.Errorf("deletion was not successfull")
+	return fmt.Errorf("logout was not successfull: status code %d", res.StatusCode)
 }
 
-func (o oidcAuth) findTargetInForm(node *html.Node) string {
+func (o *oidcAuth) findTargetInForm(node *html.Node) string {
 	if node.Type == html.ElementNode && node.Data == "form" {
 		for _, attr := range node.Attr {
 			if attr.Key == "action" {
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOidcToken(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/form":
+			fmt.Fprintf(w, `<html><body><form action="http://%s/token"></form></body></html>`, r.Host)
+		case "/gone":
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintf(w, `<html><body><form action="http://%s/token"></form></body></html>`, r.Host)
+		case "/token":
+			if err := r.ParseForm(); err != nil {
+				t.Errorf("cannot parse form: %s", err)
+			}
+			if r.PostForm.Get("password") != "password" {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"token": "", "valid": "2021-01-01T00:00:00Z"}`)
+				return
+			}
+			fmt.Fprint(w, `{"token": "token", "valid": "2021-01-01T00:00:00Z"}`)
+		}
+	}))
+	defer ts.Close()
+
+	testTable := []struct {
+		description string
+		path        string
+		password    string
+		expectErr   bool
+	}{
+		{
+			description: "valid session",
+			path:        "/form",
+			password:    "password",
+		},
+		{
+			description: "rejected credentials",
+			path:        "/form",
+			password:    "wrong",
+			expectErr:   true,
+		},
+		{
+			description: "rejected session",
+			path:        "/gone",
+			password:    "password",
+			expectErr:   true,
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			o := &oidcAuth{user: "user", password: test.password}
+			token, err := o.getFollowUpToken(ts.URL+test.path, nil)
+			if (err != nil) != test.expectErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !test.expectErr && token.Token != "token" {
+				t.Errorf("unexpected token: %s", token.Token)
+			}
+		})
+	}
+}
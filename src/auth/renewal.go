@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"k8s.io/klog"
+)
+
+var tokenExpiry = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "analysis_connector_token_expiry_timestamp_seconds",
+	Help: "The unix time, at which the current token of an identity provider expires",
+}, []string{"issuer"})
+
+// Renewal defines when the tokens are renewed and how failed renewals are retried
+type Renewal struct {
+	// Fraction is the fraction of the lifetime of a token, after which it is renewed
+	Fraction float64
+	// BaseBackoff is the backoff after the first failed renewal
+	BaseBackoff time.Duration
+	// MaxBackoff is the maximal backoff between two failed renewals
+	MaxBackoff time.Duration
+}
+
+// DefaultRenewal renews the tokens after three quarters of their lifetime
+var DefaultRenewal = Renewal{Fraction: 0.75, BaseBackoff: 5 * time.Second, MaxBackoff: 5 * time.Minute}
+
+// expiring is a token, which expires; a zero expiry never expires
+type expiring interface {
+	Token
+	expiry() time.Time
+}
+
+// renewAt returns the time, at which a token received at the given time is renewed. A
+// token is renewed not before the base backoff, so that a token, which is already expired
+// on receipt, is not renewed in a tight loop.
+func (r Renewal) renewAt(received, valid time.Time) time.Time {
+	fraction := r.Fraction
+	if fraction <= 0 || fraction > 1 {
+		fraction = DefaultRenewal.Fraction
+	}
+
+	at := received.Add(time.Duration(float64(valid.Sub(received)) * fraction))
+	if earliest := received.Add(r.backoff(1)); at.Before(earliest) {
+		return earliest
+	}
+	return at
+}
+
+// backoff returns the duration before the next attempt after the number of failed
+// renewals; the backoff is doubled on every failure up to the maximal backoff
+func (r Renewal) backoff(failures int) time.Duration {
+	base, max := r.BaseBackoff, r.MaxBackoff
+	if base <= 0 {
+		base = DefaultRenewal.BaseBackoff
+	}
+	if max < base {
+		max = base
+	}
+
+	dura := base
+	for i := 1; i < failures && dura < max; i++ {
+		dura *= 2
+	}
+	if dura > max {
+		dura = max
+	}
+	return dura
+}
+
+// publish sends a token to the token channel and exports its expiry
+func publish(tokenChan chan<- Token, issuer string, token expiring) {
+	if valid := token.expiry(); valid.IsZero() {
+		tokenExpiry.DeleteLabelValues(issuer)
+	} else {
+		tokenExpiry.WithLabelValues(issuer).Set(float64(valid.Unix()))
+	}
+	tokenChan <- token
+}
+
+// renew renews a token at the fraction of its lifetime, until quit is closed or refresh
+// returns a token, which never expires. Failed renewals are retried with a bounded
+// backoff, the renewed tokens are published on the token channel.
+func (r Renewal) renew(tokenChan chan<- Token, issuer string, token expiring, refresh func() (expiring, error), quit <-chan struct{}) {
+	received := time.Now()
+	for failures := 0; !token.expiry().IsZero(); {
+		wait := time.Until(r.renewAt(received, token.expiry()))
+		if failures > 0 {
+			wait = r.backoff(failures)
+		}
+		select {
+		case <-quit:
+			return
+		case <-time.After(wait):
+		}
+
+		next, err := refresh()
+		if err != nil {
+			failures++
+			klog.Errorf("cannot renew token of %s, retry in %s: %s", issuer, r.backoff(failures), err)
+			continue
+		}
+
+		failures = 0
+		token, received = next, time.Now()
+		publish(tokenChan, issuer, token)
+	}
+}
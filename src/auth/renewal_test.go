@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRenewAt(t *testing.T) {
+	received := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	testTable := []struct {
+		description string
+		fraction    float64
+		// valid is the lifetime of the token, the default is one hour
+		valid    time.Duration
+		expected time.Time
+	}{
+		{
+			description: "configured fraction",
+			fraction:    0.5,
+			expected:    received.Add(30 * time.Minute),
+		},
+		{
+			description: "default fraction",
+			expected:    received.Add(45 * time.Minute),
+		},
+		{
+			description: "fraction after the expiry",
+			fraction:    1.5,
+			expected:    received.Add(45 * time.Minute),
+		},
+		{
+			description: "expired token",
+			valid:       -time.Minute,
+			expected:    received.Add(DefaultRenewal.BaseBackoff),
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			valid := test.valid
+			if valid == 0 {
+				valid = time.Hour
+			}
+
+			renewal := Renewal{Fraction: test.fraction}
+			if at := renewal.renewAt(received, received.Add(valid)); !at.Equal(test.expected) {
+				t.Errorf("unexpected renewal: %s != %s", at, test.expected)
+			}
+		})
+	}
+}
+
+func TestRenewalBackoff(t *testing.T) {
+	renewal := Renewal{BaseBackoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	testTable := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{failures: 1, expected: time.Second},
+		{failures: 2, expected: 2 * time.Second},
+		{failures: 3, expected: 4 * time.Second},
+		{failures: 4, expected: 5 * time.Second},
+		{failures: 100, expected: 5 * time.Second},
+	}
+
+	for _, test := range testTable {
+		if backoff := renewal.backoff(test.failures); backoff != test.expected {
+			t.Errorf("unexpected backoff after %d failures: %s != %s", test.failures, backoff, test.expected)
+		}
+	}
+}
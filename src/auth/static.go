@@ -0,0 +1,49 @@
+package auth
+
+// staticToken is a bearer token or an api key, which does not expire
+type staticToken struct {
+	header string
+	token  string
+}
+
+// AuthToken return the token as string
+func (t staticToken) AuthToken() string {
+	return t.token
+}
+
+// AuthHeader returns the header of the token; a token in the authorization header is sent
+// as bearer token
+func (t staticToken) AuthHeader() (string, string) {
+	if t.header == "" || t.header == "Authorization" {
+		return "Authorization", "Bearer " + t.token
+	}
+	return t.header, t.token
+}
+
+type staticAuth struct {
+	tokenChan chan<- Token
+	token     staticToken
+}
+
+// NewStaticAuth create an authentication with a static token, which is sent in the header
+// with the given name. Without header name the token is sent as bearer token.
+func NewStaticAuth(tokenChan chan<- Token, header, token string) Auth {
+	return staticAuth{tokenChan: tokenChan, token: staticToken{header: header, token: token}}
+}
+
+// Login provides the static token
+func (s staticAuth) Login() error {
+	s.tokenChan <- s.token
+	return nil
+}
+
+// Refresh provides the static token again, because a static token cannot be renewed
+func (s staticAuth) Refresh() (Token, error) {
+	s.tokenChan <- s.token
+	return s.token, nil
+}
+
+// Logout does nothing, because a static token has no session
+func (s staticAuth) Logout() error {
+	return nil
+}
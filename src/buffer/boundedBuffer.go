@@ -0,0 +1,299 @@
+package buffer
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"k8s.io/klog"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/connection"
+)
+
+// OverflowPolicy defines what happens with the sensor updates, if a limit of the buffer is
+// reached
+type OverflowPolicy string
+
+const (
+	// DropOldest removes the oldest buffered update
+	DropOldest OverflowPolicy = "drop-oldest"
+	// DropNewest rejects the update, which should be inserted
+	DropNewest OverflowPolicy = "drop-newest"
+	// Downsample removes every second buffered update of a machine sensor combination
+	Downsample OverflowPolicy = "downsample"
+	// SpillToDisk moves the oldest buffered update into a secondary buffer
+	SpillToDisk OverflowPolicy = "spill-to-disk"
+)
+
+var (
+	droppedUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "analysis_connector_buffer_dropped_updates_total",
+		Help: "The number of sensor updates, which are dropped because a buffer limit is reached",
+	}, []string{"machine", "sensor", "policy"})
+
+	spilledUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "analysis_connector_buffer_spilled_updates_total",
+		Help: "The number of sensor updates, which are spilled to disk because a buffer limit is reached",
+	}, []string{"machine", "sensor"})
+)
+
+// Limits defines the limits of a bounded buffer. A limit with the value 0 is disabled.
+type Limits struct {
+	// SensorCount is the maximal number of updates of one machine sensor combination
+	SensorCount int
+	// SensorBytes is the maximal size of the updates of one machine sensor combination
+	SensorBytes int
+	// GlobalCount is the maximal number of updates in the buffer
+	GlobalCount int
+	// GlobalBytes is the maximal size of all updates in the buffer
+	GlobalBytes int
+}
+
+type entry struct {
+	update connection.SensorData
+	size   int
+}
+
+type queue struct {
+	entries []entry
+	bytes   int
+}
+
+type boundedBuffer struct {
+	limits  Limits
+	policy  OverflowPolicy
+	spill   Data
+	syncMap map[string]map[string]*queue
+	count   int
+	bytes   int
+	mutex   sync.Mutex
+}
+
+// NewBoundedBuffer initialise an in memory buffer, which applies the overflow policy if
+// one of the limits is reached. The spill buffer is required by the SpillToDisk policy.
+func NewBoundedBuffer(limits Limits, policy OverflowPolicy, spill Data) (Data, error) {
+	switch policy {
+	case DropOldest, DropNewest, Downsample:
+	case SpillToDisk:
+		if spill == nil {
+			return nil, fmt.Errorf("the policy %s requires a spill buffer", policy)
+		}
+	default:
+		return nil, fmt.Errorf("unknown overflow policy: %s", policy)
+	}
+
+	return &boundedBuffer{
+		limits:  limits,
+		policy:  policy,
+		spill:   spill,
+		syncMap: make(map[string]map[string]*queue),
+	}, nil
+}
+
+func (u *boundedBuffer) queue(machine, sensor string) *queue {
+	if _, ok := u.syncMap[machine]; !ok {
+		u.syncMap[machine] = make(map[string]*queue)
+	}
+
+	q, ok := u.syncMap[machine][sensor]
+	if !ok {
+		q = &queue{}
+		u.syncMap[machine][sensor] = q
+	}
+	return q
+}
+
+// sensorExceeded tests if an update with the size would exceed the sensor limits
+func (u *boundedBuffer) sensorExceeded(q *queue, size int) bool {
+	return (u.limits.SensorCount > 0 && len(q.entries)+1 > u.limits.SensorCount) ||
+		(u.limits.SensorBytes > 0 && q.bytes+size > u.limits.SensorBytes)
+}
+
+// oversized tests if an update with the size exceeds the byte limits on its own, so that
+// it cannot be buffered in memory
+func (u *boundedBuffer) oversized(size int) bool {
+	return (u.limits.SensorBytes > 0 && size > u.limits.SensorBytes) ||
+		(u.limits.GlobalBytes > 0 && size > u.limits.GlobalBytes)
+}
+
+// prune removes the queue of a machine sensor combination, if it is empty
+func (u *boundedBuffer) prune(machine, sensor string) {
+	if q, ok := u.syncMap[machine][sensor]; !ok || len(q.entries) > 0 {
+		return
+	}
+
+	delete(u.syncMap[machine], sensor)
+	if len(u.syncMap[machine]) == 0 {
+		delete(u.syncMap, machine)
+	}
+}
+
+// globalExceeded tests if an update with the size would exceed the global limits
+func (u *boundedBuffer) globalExceeded(size int) bool {
+	return (u.limits.GlobalCount > 0 && u.count+1 > u.limits.GlobalCount) ||
+		(u.limits.GlobalBytes > 0 && u.bytes+size > u.limits.GlobalBytes)
+}
+
+// largest returns the machine sensor combination with the most buffered updates
+func (u *boundedBuffer) largest() (string, string, *queue) {
+	var (
+		machine, sensor string
+		largest         *queue
+	)
+	for m, sensors := range u.syncMap {
+		for s, q := range sensors {
+			if largest == nil || len(q.entries) > len(largest.entries) {
+				machine, sensor, largest = m, s, q
+			}
+		}
+	}
+	return machine, sensor, largest
+}
+
+// evict frees space in the queue according to the overflow policy. It returns false, if
+// no space could be freed.
+func (u *boundedBuffer) evict(machine, sensor string, q *queue) bool {
+	if u.policy == DropNewest || len(q.entries) == 0 {
+		return false
+	}
+
+	switch u.policy {
+	case Downsample:
+		if len(q.entries) > 1 {
+			var kept []entry
+			for i, e := range q.entries {
+				if i%2 == 1 {
+					kept = append(kept, e)
+					continue
+				}
+				u.remove(q, e)
+			}
+			droppedUpdates.WithLabelValues(machine, sensor, string(u.policy)).Add(float64(len(q.entries) - len(kept)))
+			q.entries = kept
+			return true
+		}
+		fallthrough
+	case DropOldest:
+		u.remove(q, q.entries[0])
+		q.entries = q.entries[1:]
+		droppedUpdates.WithLabelValues(machine, sensor, string(u.policy)).Inc()
+	case SpillToDisk:
+		u.spill.Insert(machine, sensor, q.entries[0].update)
+		u.remove(q, q.entries[0])
+		q.entries = q.entries[1:]
+		spilledUpdates.WithLabelValues(machine, sensor).Inc()
+	}
+	return true
+}
+
+// remove updates the accounting after an entry is removed from the queue
+func (u *boundedBuffer) remove(q *queue, e entry) {
+	q.bytes -= e.size
+	u.bytes -= e.size
+	u.count--
+}
+
+// Insert insert new data to a machine sensor combination
+func (u *boundedBuffer) Insert(machine, sensor string, update connection.SensorData) {
+	encoded, err := json.Marshal(update)
+	if err != nil {
+		klog.Errorf("cannot marshal update of machine %s sensor %s: %s", machine, sensor, err)
+		return
+	}
+	size := len(encoded)
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	// the queue is only created, if the update is accepted
+	q, ok := u.syncMap[machine][sensor]
+	if !ok {
+		q = &queue{}
+	}
+
+	if u.oversized(size) {
+		if u.policy != SpillToDisk {
+			droppedUpdates.WithLabelValues(machine, sensor, string(u.policy)).Inc()
+			return
+		}
+
+		// the buffered updates are spilled first, so that the order is kept
+		for len(q.entries) > 0 {
+			u.evict(machine, sensor, q)
+		}
+		u.prune(machine, sensor)
+		u.spill.Insert(machine, sensor, update)
+		spilledUpdates.WithLabelValues(machine, sensor).Inc()
+		return
+	}
+
+	for u.sensorExceeded(q, size) {
+		if !u.evict(machine, sensor, q) {
+			droppedUpdates.WithLabelValues(machine, sensor, string(u.policy)).Inc()
+			u.prune(machine, sensor)
+			return
+		}
+	}
+
+	for u.globalExceeded(size) {
+		victimMachine, victimSensor, victim := machine, sensor, q
+		if len(q.entries) == 0 {
+			victimMachine, victimSensor, victim = u.largest()
+		}
+
+		if victim == nil || !u.evict(victimMachine, victimSensor, victim) {
+			droppedUpdates.WithLabelValues(machine, sensor, string(u.policy)).Inc()
+			u.prune(machine, sensor)
+			return
+		}
+		if victim != q {
+			u.prune(victimMachine, victimSensor)
+		}
+	}
+
+	q = u.queue(machine, sensor)
+	q.entries = append(q.entries, entry{update: update, size: size})
+	q.bytes += size
+	u.bytes += size
+	u.count++
+}
+
+// GetValues returns all sensor data from machine, sensor string. Spilled updates are
+// older than the updates in memory and will be returned first.
+func (u *boundedBuffer) GetValues(machine, sensor string) []connection.SensorData {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	var data []connection.SensorData
+	if u.spill != nil {
+		data = u.spill.GetValues(machine, sensor)
+	}
+
+	q, ok := u.syncMap[machine][sensor]
+	if !ok {
+		return data
+	}
+
+	for _, e := range q.entries {
+		data = append(data, e.update)
+	}
+	u.count -= len(q.entries)
+	u.bytes -= q.bytes
+
+	delete(u.syncMap[machine], sensor)
+	if len(u.syncMap[machine]) == 0 {
+		delete(u.syncMap, machine)
+	}
+	return data
+}
+
+// Pending returns the number of spilled updates of a machine sensor combination, which
+// are kept over a restart by the spill buffer. The updates in memory are not counted.
+func (u *boundedBuffer) Pending(machine, sensor string) int {
+	if p, ok := u.spill.(Pending); ok {
+		return p.Pending(machine, sensor)
+	}
+	return 0
+}
@@ -0,0 +1,150 @@
+package buffer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/connection"
+)
+
+func TestBoundedBuffer(t *testing.T) {
+	testTable := []struct {
+		description string
+		limits      Limits
+		policy      OverflowPolicy
+		insert      []string
+		expected    []string
+		spilled     []string
+	}{
+		{
+			description: "no limit reached",
+			limits:      Limits{SensorCount: 3},
+			policy:      DropOldest,
+			insert:      []string{"1", "2"},
+			expected:    []string{"1", "2"},
+		},
+		{
+			description: "drop oldest",
+			limits:      Limits{SensorCount: 2},
+			policy:      DropOldest,
+			insert:      []string{"1", "2", "3"},
+			expected:    []string{"2", "3"},
+		},
+		{
+			description: "drop newest",
+			limits:      Limits{GlobalCount: 2},
+			policy:      DropNewest,
+			insert:      []string{"1", "2", "3"},
+			expected:    []string{"1", "2"},
+		},
+		{
+			description: "downsample",
+			limits:      Limits{SensorCount: 4},
+			policy:      Downsample,
+			insert:      []string{"1", "2", "3", "4", "5"},
+			expected:    []string{"2", "4", "5"},
+		},
+		{
+			description: "spill to disk",
+			limits:      Limits{SensorCount: 2},
+			policy:      SpillToDisk,
+			insert:      []string{"1", "2", "3", "4"},
+			expected:    []string{"1", "2", "3", "4"},
+			spilled:     []string{"1", "2"},
+		},
+		{
+			description: "spill oversized update to disk",
+			limits:      Limits{SensorBytes: 300},
+			policy:      SpillToDisk,
+			insert:      []string{"1", strings.Repeat("2", 300), "3"},
+			expected:    []string{"1", strings.Repeat("2", 300), "3"},
+			spilled:     []string{"1", strings.Repeat("2", 300)},
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			spill := NewLocalBuffer()
+			buf, err := NewBoundedBuffer(test.limits, test.policy, spill)
+			if err != nil {
+				t.Fatalf("cannot create bounded buffer: %s", err)
+			}
+
+			for _, v := range test.insert {
+				buf.Insert("machine", "sensor", connection.SensorData{Signature: v})
+			}
+
+			bounded := buf.(*boundedBuffer)
+			var spilled []string
+			for _, v := range bounded.spill.(*data).syncMap["machine"]["sensor"] {
+				spilled = append(spilled, v.Signature)
+			}
+			if !equal(spilled, test.spilled) {
+				t.Errorf("unexpected spilled updates: %v != %v", spilled, test.spilled)
+			}
+
+			var ret []string
+			for _, v := range buf.GetValues("machine", "sensor") {
+				ret = append(ret, v.Signature)
+			}
+			if !equal(ret, test.expected) {
+				t.Errorf("unexpected returned updates: %v != %v", ret, test.expected)
+			}
+
+			if bounded.count != 0 || bounded.bytes != 0 {
+				t.Errorf("accounting is not reset: count %d bytes %d", bounded.count, bounded.bytes)
+			}
+		})
+	}
+}
+
+func TestBoundedBufferGlobalBytes(t *testing.T) {
+	update := connection.SensorData{Signature: "signature"}
+	buf, err := NewBoundedBuffer(Limits{GlobalBytes: 1}, DropOldest, nil)
+	if err != nil {
+		t.Fatalf("cannot create bounded buffer: %s", err)
+	}
+
+	buf.Insert("machine", "sensor", update)
+	if queues := len(buf.(*boundedBuffer).syncMap); queues != 0 {
+		t.Errorf("the dropped update has left %d queues", queues)
+	}
+
+	if ret := buf.GetValues("machine", "sensor"); len(ret) != 0 {
+		t.Errorf("an update larger than the global limit has been inserted")
+	}
+}
+
+func TestBoundedBufferDroppedQueue(t *testing.T) {
+	buf, err := NewBoundedBuffer(Limits{GlobalCount: 1}, DropNewest, nil)
+	if err != nil {
+		t.Fatalf("cannot create bounded buffer: %s", err)
+	}
+
+	buf.Insert("machine", "sensor", connection.SensorData{Signature: "1"})
+	buf.Insert("machine", "other", connection.SensorData{Signature: "2"})
+	buf.Insert("other", "sensor", connection.SensorData{Signature: "3"})
+
+	bounded := buf.(*boundedBuffer)
+	if len(bounded.syncMap) != 1 || len(bounded.syncMap["machine"]) != 1 {
+		t.Errorf("the dropped updates have left queues: %v", bounded.syncMap)
+	}
+}
+
+func TestBoundedBufferSpillRequired(t *testing.T) {
+	if _, err := NewBoundedBuffer(Limits{}, SpillToDisk, nil); err == nil {
+		t.Errorf("expected error, if no spill buffer is defined")
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,244 @@
+package buffer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"k8s.io/klog"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/connection"
+)
+
+// segmentSuffix is the file suffix of a segment file
+const segmentSuffix = ".seg"
+
+// fileBuffer stores the sensor updates in append-only segment files. Each machine sensor
+// combination has its own segment file, which will be removed after the values are
+// returned by GetValues. Because the data is written to the local storage it survives a
+// restart of the connector. The names of the machines and sensors are base64 encoded, so
+// that they cannot address a file outside of the buffer directory.
+type fileBuffer struct {
+	dir string
+	// pending is the number of buffered updates of every machine sensor combination
+	pending map[string]map[string]int
+	mutex   sync.Mutex
+}
+
+// errEmptyName is returned, if the machine or sensor of a segment has no name
+var errEmptyName = errors.New("the machine and the sensor of a segment require a name")
+
+// NewFileBuffer initialise a buffer, which persists the data in the directory dir. Sensor
+// updates which are stored by a previous run of the connector will be replayed.
+func NewFileBuffer(dir string) (Data, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+
+	f := &fileBuffer{dir: dir, pending: make(map[string]map[string]int)}
+	if err := f.replay(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// segment returns the path of the segment file of a machine sensor combination
+func (f *fileBuffer) segment(machine, sensor string) (string, error) {
+	if machine == "" || sensor == "" {
+		return "", errEmptyName
+	}
+	return filepath.Join(f.dir, encodeName(machine), encodeName(sensor)+segmentSuffix), nil
+}
+
+// encodeName encodes a name into a file name, which contains only letters, digits, '-' and
+// '_'
+func encodeName(name string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(name))
+}
+
+func decodeName(file string) (string, error) {
+	name, err := base64.RawURLEncoding.DecodeString(file)
+	return string(name), err
+}
+
+// replay loads the number of sensor updates, which are stored by a previous run, into the
+// pending updates of the buffer
+func (f *fileBuffer) replay() error {
+	machines, err := ioutil.ReadDir(f.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range machines {
+		if !m.IsDir() {
+			continue
+		}
+
+		machine, err := decodeName(m.Name())
+		if err != nil {
+			klog.Errorf("cannot decode machine of buffer directory %s: %s", m.Name(), err)
+			continue
+		}
+
+		sensors, err := ioutil.ReadDir(filepath.Join(f.dir, m.Name()))
+		if err != nil {
+			return err
+		}
+
+		for _, s := range sensors {
+			if s.IsDir() || !strings.HasSuffix(s.Name(), segmentSuffix) {
+				continue
+			}
+
+			sensor, err := decodeName(strings.TrimSuffix(s.Name(), segmentSuffix))
+			if err != nil {
+				klog.Errorf("cannot decode sensor of buffer segment %s: %s", s.Name(), err)
+				continue
+			}
+
+			data, err := f.read(machine, sensor)
+			if err != nil {
+				return err
+			}
+			if len(data) == 0 {
+				continue
+			}
+			f.add(machine, sensor, len(data))
+			klog.Infof("recovered %d buffered updates of machine %s sensor %s", len(data), machine, sensor)
+		}
+	}
+
+	return nil
+}
+
+// read reads all sensor updates of a segment file
+func (f *fileBuffer) read(machine, sensor string) ([]connection.SensorData, error) {
+	path, err := f.segment(machine, sensor)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			klog.Errorf("cannot close buffer segment: %s", err)
+		}
+	}()
+
+	var data []connection.SensorData
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var update connection.SensorData
+		if err := json.Unmarshal(scanner.Bytes(), &update); err != nil {
+			// a partial written line of a crashed connector will be skipped
+			klog.Errorf("skip corrupted update in buffer of machine %s sensor %s: %s", machine, sensor, err)
+			continue
+		}
+		data = append(data, update)
+	}
+
+	return data, scanner.Err()
+}
+
+// Insert appends new data to the segment of a machine sensor combination
+func (f *fileBuffer) Insert(machine, sensor string, update connection.SensorData) {
+	encoded, err := json.Marshal(update)
+	if err != nil {
+		klog.Errorf("cannot marshal update of machine %s sensor %s: %s", machine, sensor, err)
+		return
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	path, err := f.segment(machine, sensor)
+	if err != nil {
+		klog.Errorf("cannot buffer update of machine %s sensor %s: %s", machine, sensor, err)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		klog.Errorf("cannot create buffer directory of machine %s: %s", machine, err)
+		return
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		klog.Errorf("cannot open buffer segment of machine %s sensor %s: %s", machine, sensor, err)
+		return
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			klog.Errorf("cannot close buffer segment: %s", err)
+		}
+	}()
+
+	if _, err := file.Write(append(encoded, '\n')); err != nil {
+		klog.Errorf("cannot write update of machine %s sensor %s: %s", machine, sensor, err)
+		return
+	}
+
+	f.add(machine, sensor, 1)
+
+	if err := file.Sync(); err != nil {
+		klog.Errorf("cannot sync buffer segment of machine %s sensor %s: %s", machine, sensor, err)
+	}
+}
+
+// add increases the number of pending updates of a machine sensor combination
+func (f *fileBuffer) add(machine, sensor string, n int) {
+	if _, ok := f.pending[machine]; !ok {
+		f.pending[machine] = make(map[string]int)
+	}
+	f.pending[machine][sensor] += n
+}
+
+// Pending returns the number of buffered updates of a machine sensor combination including
+// the updates, which are recovered from a previous run
+func (f *fileBuffer) Pending(machine, sensor string) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.pending[machine][sensor]
+}
+
+// GetValues returns all sensor data from machine, sensor string and removes the segment
+func (f *fileBuffer) GetValues(machine, sensor string) []connection.SensorData {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	data, err := f.read(machine, sensor)
+	if err != nil {
+		klog.Errorf("cannot read buffer segment of machine %s sensor %s: %s", machine, sensor, err)
+		return nil
+	}
+
+	delete(f.pending[machine], sensor)
+	if len(f.pending[machine]) == 0 {
+		delete(f.pending, machine)
+	}
+
+	path, _ := f.segment(machine, sensor)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		klog.Errorf("cannot remove buffer segment of machine %s sensor %s: %s", machine, sensor, err)
+	}
+
+	// the machine directory is only removed, if it is empty
+	_ = os.Remove(filepath.Dir(path))
+
+	return data
+}
@@ -0,0 +1,168 @@
+package buffer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/connection"
+)
+
+func TestFileBuffer(t *testing.T) {
+	testTable := []struct {
+		description string
+		machine     string
+		sensor      string
+		data        []connection.SensorData
+	}{
+		{
+			"insert one element",
+			"machine",
+			"sensor",
+			[]connection.SensorData{
+				{
+					Signature: "signature",
+				},
+			},
+		},
+		{
+			"insert two elements with escaped names",
+			"machine/1",
+			"sensor 2",
+			[]connection.SensorData{
+				{
+					Signature: "signature1",
+				},
+				{
+					Signature: "signature2",
+				},
+			},
+		},
+	}
+
+	for _, v := range testTable {
+		t.Run(v.description, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "buffer")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			buf, err := NewFileBuffer(dir)
+			if err != nil {
+				t.Fatalf("cannot create file buffer: %s", err)
+			}
+
+			for _, y := range v.data {
+				buf.Insert(v.machine, v.sensor, y)
+			}
+
+			// a new buffer on the same directory simulates a restart of the connector
+			restarted, err := NewFileBuffer(dir)
+			if err != nil {
+				t.Fatalf("cannot recreate file buffer: %s", err)
+			}
+
+			ret := restarted.GetValues(v.machine, v.sensor)
+
+			bRet, err := json.Marshal(ret)
+			if err != nil {
+				t.Errorf("cannot marshal: %s", err)
+			}
+
+			vData, err := json.Marshal(v.data)
+			if err != nil {
+				t.Errorf("cannot marshal: %s", err)
+			}
+
+			if string(vData) != string(bRet) {
+				t.Errorf("the returned value and the expected value are not equal\n\t%s != %s", bRet, vData)
+			}
+
+			if ret := restarted.GetValues(v.machine, v.sensor); len(ret) != 0 {
+				t.Errorf("segment is not removed, %d elements are returned", len(ret))
+			}
+		})
+	}
+}
+
+func TestFileBufferNames(t *testing.T) {
+	testTable := []struct {
+		description string
+		machine     string
+		sensor      string
+		buffered    bool
+	}{
+		{
+			description: "parent directory",
+			machine:     "..",
+			sensor:      "..",
+			buffered:    true,
+		},
+		{
+			description: "path of a parent directory",
+			machine:     "../..",
+			sensor:      "../../sensor",
+			buffered:    true,
+		},
+		{
+			description: "current directory",
+			machine:     ".",
+			sensor:      ".",
+			buffered:    true,
+		},
+		{
+			description: "empty machine",
+			sensor:      "sensor",
+		},
+	}
+
+	for _, v := range testTable {
+		t.Run(v.description, func(t *testing.T) {
+			root, err := ioutil.TempDir("", "buffer")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(root)
+
+			dir := filepath.Join(root, "a", "b")
+			buf, err := NewFileBuffer(dir)
+			if err != nil {
+				t.Fatalf("cannot create file buffer: %s", err)
+			}
+
+			buf.Insert(v.machine, v.sensor, connection.SensorData{Signature: "signature"})
+
+			err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if !info.IsDir() && !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+					t.Errorf("segment is written outside of the buffer directory: %s", path)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			restarted, err := NewFileBuffer(dir)
+			if err != nil {
+				t.Fatalf("cannot recreate file buffer: %s", err)
+			}
+
+			pending := restarted.(Pending).Pending(v.machine, v.sensor)
+			ret := restarted.GetValues(v.machine, v.sensor)
+			if (pending == 1) != v.buffered || (len(ret) == 1) != v.buffered {
+				t.Errorf("unexpected buffered updates, pending %d, returned %d", pending, len(ret))
+			}
+
+			if pending := restarted.(Pending).Pending(v.machine, v.sensor); pending != 0 {
+				t.Errorf("returned updates are still pending: %d", pending)
+			}
+		})
+	}
+}
@@ -6,12 +6,23 @@ import (
 	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/connection"
 )
 
+// Inserter receives the sensor updates of the machine sensor combinations
+type Inserter interface {
+	Insert(machine, sensor string, update connection.SensorData)
+}
+
 // Data contains the machine data in a sync map
 type Data interface {
-	Insert(machine, sensor string, update connection.SensorData)
+	Inserter
 	GetValues(machine, sensor string) []connection.SensorData
 }
 
+// Pending is implemented by the buffers, which keep the sensor updates over a restart of the
+// connector. It returns the number of buffered updates of a machine sensor combination.
+type Pending interface {
+	Pending(machine, sensor string) int
+}
+
 type data struct {
 	syncMap map[string]map[string][]connection.SensorData
 	mutex   sync.Mutex
@@ -2,107 +2,560 @@
 package connection
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"k8s.io/klog"
 
 	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/auth"
 )
 
+var expiredMessages = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "analysis_connector_outbox_expired_messages_total",
+	Help: "The number of messages, which are purged from the outbox because their retention has ended",
+})
+
+// DefaultTimeout is the timeout of the requests, if no timeout is set
+const DefaultTimeout = 30 * time.Second
+
+// ErrQueued is returned, if a message is not sent directly, because older messages of the
+// same queue are waiting in the outbox. The message will be sent by SendMissingData.
+var ErrQueued = errors.New("message is queued behind older messages")
+
+// ErrNotStored is returned by a request, whose message could not be stored in the outbox;
+// the message is not uploaded and has to be requested again
+var ErrNotStored = errors.New("message cannot be stored in the outbox")
+
+// RetryPolicy defines how messages, which could not be uploaded, will be retried
+type RetryPolicy struct {
+	// Interval is the duration between two runs of the outbox
+	Interval time.Duration
+	// BaseBackoff is the backoff after the first failed attempt
+	BaseBackoff time.Duration
+	// MaxBackoff is the maximal backoff between two attempts
+	MaxBackoff time.Duration
+	// MaxAttempts is the number of attempts before a message is dead lettered; 0 means
+	// that messages are retried forever
+	MaxAttempts int
+}
+
 // Connection is the connection to the analyse cloud
 type Connection struct {
 	baseURL   string
 	tokenChan <-chan auth.Token
+	auth      auth.Auth
+	transport http.RoundTripper
+	timeout   time.Duration
 	token     string
+	header    string
 	ready     bool
 	persist   Persist
-	lock      sync.Mutex
+	retry     RetryPolicy
+	// sending contains the messages, which are sent by a request right now
+	sending map[uint]bool
+	// lock protects the outbox state; it is not held during the uploads
+	lock       sync.Mutex
+	outboxLock sync.Mutex
+	tokenLock  sync.RWMutex
+	done       chan struct{}
+	closeOnce  sync.Once
+	quit       chan struct{}
+	quitOnce   sync.Once
+	// retirement is set, while the connection waits for its outbox to be empty, before it
+	// is closed; it receives true, when the connection is closed, and false, when the
+	// connection is reused
+	retirement chan bool
 }
 
 func (c *Connection) renewToken() {
 	for {
-		tok := <-c.tokenChan
-		c.token = tok.AuthToken()
-		c.ready = true
+		select {
+		case <-c.quit:
+			return
+		case tok := <-c.tokenChan:
+			c.setToken(tok)
+		}
+	}
+}
+
+// setToken replaces the token of the requests
+func (c *Connection) setToken(tok auth.Token) {
+	c.tokenLock.Lock()
+	defer c.tokenLock.Unlock()
+
+	c.header, c.token = "token", tok.AuthToken()
+	if h, ok := tok.(auth.Header); ok {
+		c.header, c.token = h.AuthHeader()
+	}
+	c.ready = true
+}
+
+// SetTLSConfig defines the tls configuration of the requests
+func (c *Connection) SetTLSConfig(config *tls.Config) {
+	c.tokenLock.Lock()
+	c.transport = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: config,
+	}
+	c.tokenLock.Unlock()
+}
+
+// SetTimeout defines the timeout of the requests; 0 uses the DefaultTimeout
+func (c *Connection) SetTimeout(timeout time.Duration) {
+	c.tokenLock.Lock()
+	c.timeout = timeout
+	c.tokenLock.Unlock()
+}
+
+// httpClient returns the client of the requests
+func (c *Connection) httpClient() *http.Client {
+	c.tokenLock.RLock()
+	defer c.tokenLock.RUnlock()
+
+	timeout := c.timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
 	}
+	return &http.Client{Transport: c.transport, Timeout: timeout}
+}
+
+// SetAuth defines the authentication, which is asked for a new token, if the token of a
+// request has been rejected
+func (c *Connection) SetAuth(a auth.Auth) {
+	c.tokenLock.Lock()
+	c.auth = a
+	c.tokenLock.Unlock()
+}
+
+// authorize adds the latest received token to the header of a request
+func (c *Connection) authorize(req *http.Request) {
+	c.tokenLock.RLock()
+	defer c.tokenLock.RUnlock()
+
+	header := c.header
+	if header == "" {
+		header = "token"
+	}
+	req.Header.Add(header, c.token)
+}
+
+// SetRetryPolicy changes the retry policy of the outbox
+func (c *Connection) SetRetryPolicy(policy RetryPolicy) {
+	c.lock.Lock()
+	c.retry = policy
+	c.lock.Unlock()
 }
 
 // SendMissingData sends data, which are buffered and could not be uploaded previously
 func (c *Connection) SendMissingData() {
 	for {
+		c.sendMissingData(context.Background(), time.Now())
+		c.closeIfSent()
+
 		c.lock.Lock()
-		msg := c.persist.Query()
+		interval := c.retry.Interval
+		c.lock.Unlock()
+		if interval <= 0 {
+			interval = time.Minute
+		}
+
+		select {
+		case <-c.done:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Drain stops SendMissingData and sends every due message of the outbox a last time; the
+// messages, which are not sent before the context is done, are kept in the outbox
+func (c *Connection) Drain(ctx context.Context) {
+	c.closeOnce.Do(func() {
+		if c.done != nil {
+			close(c.done)
+		}
+	})
+	c.sendMissingData(ctx, time.Now())
+}
 
-		for _, ms := range msg {
-			req, err := http.NewRequest(ms.Method, ms.Address, strings.NewReader(string(ms.Message)))
-			if err != nil {
-				klog.Errorf("cannot create new http request")
-				continue
+// Close stops SendMissingData and the renewal of the token; the messages are kept in the
+// outbox
+func (c *Connection) Close() {
+	c.closeOnce.Do(func() {
+		if c.done != nil {
+			close(c.done)
+		}
+	})
+	c.quitOnce.Do(func() {
+		if c.quit != nil {
+			close(c.quit)
+		}
+	})
+}
+
+// Retire closes the connection, once SendMissingData has sent every message of the outbox,
+// so the messages of an endpoint, which is not used anymore, are not left behind. It
+// returns true after the closing and false, if the connection is reused in the meantime.
+func (c *Connection) Retire() bool {
+	retirement := make(chan bool, 1)
+	c.lock.Lock()
+	c.retirement = retirement
+	c.lock.Unlock()
+
+	c.closeIfSent()
+	return <-retirement
+}
+
+// Reuse stops the retirement of a connection; it returns false, if the connection has
+// already been closed
+func (c *Connection) Reuse() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.retirement == nil {
+		return false
+	}
+	c.retirement <- false
+	c.retirement = nil
+	return true
+}
+
+// closeIfSent closes a retired connection, whose outbox is empty; a connection without
+// outbox has nothing to send
+func (c *Connection) closeIfSent() {
+	c.lock.Lock()
+	retirement := c.retirement
+	if retirement == nil || (c.persist != nil && len(c.persist.Query()) > 0) {
+		c.lock.Unlock()
+		return
+	}
+	c.retirement = nil
+	c.lock.Unlock()
+
+	c.Close()
+	retirement <- true
+}
+
+// sendMissingData sends every due message of the outbox. Messages of a queue are sent in
+// order, so a queue is blocked until its oldest message is uploaded or dead lettered.
+func (c *Connection) sendMissingData(ctx context.Context, now time.Time) {
+	c.outboxLock.Lock()
+	defer c.outboxLock.Unlock()
+
+	blocked := make(map[string]bool)
+	for _, ms := range c.persist.Query() {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if blocked[ms.Queue] {
+			continue
+		}
+
+		// messages, whose retention has ended, are purged instead of replayed
+		if !ms.Expires.IsZero() && !now.Before(ms.Expires) {
+			klog.Warningf("message %d of queue %s is purged, its retention has ended at %s", ms.ID, ms.Queue, ms.Expires)
+			expiredMessages.Inc()
+			if err := c.persist.Remove([]Message{ms}); err != nil {
+				klog.Errorf("cannot purge message %d of queue %s: %s", ms.ID, ms.Queue, err)
+				blocked[ms.Queue] = true
 			}
+			continue
+		}
 
-			client := http.Client{}
+		if ms.NextAttempt.After(now) || c.isSending(ms.ID) {
+			blocked[ms.Queue] = true
+			continue
+		}
 
-			res, err := client.Do(req)
-			if err != nil {
-				klog.Error(err)
+		res, err := c.send(ctx, ms)
+		if err != nil {
+			if !c.failed(ms, err.Error()) {
+				blocked[ms.Queue] = true
 			}
+			continue
+		}
+
+		if err := res.Body.Close(); err != nil {
+			klog.Errorf("cannot close response body: %s", err)
+		}
 
-			if res.StatusCode >= 200 && res.StatusCode < 300 {
-				c.persist.Remove(msg)
+		if res.StatusCode < 200 || res.StatusCode >= 300 {
+			if !c.failed(ms, fmt.Sprintf("unexpected status code %d", res.StatusCode)) {
+				blocked[ms.Queue] = true
 			}
+			continue
 		}
 
-		c.lock.Unlock()
-		// exectue only every 10 minutes
-		time.Sleep(10 * time.Minute)
+		if err := c.persist.Remove([]Message{ms}); err != nil {
+			// the message is sent once more with the same idempotency key
+			klog.Errorf("cannot remove uploaded message %d of queue %s: %s", ms.ID, ms.Queue, err)
+			blocked[ms.Queue] = true
+		}
+	}
+}
+
+// setSending marks a message, which is sent by a request, so that the outbox does not
+// send it at the same time; the lock has to be held
+func (c *Connection) setSending(id uint, sending bool) {
+	if c.sending == nil {
+		c.sending = make(map[uint]bool)
+	}
+	if sending {
+		c.sending[id] = true
+	} else {
+		delete(c.sending, id)
+	}
+}
+
+// isSending tests if a message is sent by a request right now
+func (c *Connection) isSending(id uint) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.sending[id]
+}
+
+// failed reschedules a message after a failed upload. It returns true, if the message
+// has been moved to the dead letter table; a message, which cannot be moved, is kept in
+// the outbox and blocks its queue.
+func (c *Connection) failed(msg Message, reason string) bool {
+	c.lock.Lock()
+	retry := c.retry
+	c.lock.Unlock()
+
+	msg.Attempts++
+	if retry.MaxAttempts > 0 && msg.Attempts >= retry.MaxAttempts {
+		klog.Errorf("message %d of queue %s is dead lettered after %d attempts: %s", msg.ID, msg.Queue, msg.Attempts, reason)
+		if err := c.persist.DeadLetter(msg, reason); err != nil {
+			klog.Errorf("cannot dead letter message %d of queue %s: %s", msg.ID, msg.Queue, err)
+			return false
+		}
+		return true
+	}
+
+	msg.NextAttempt = time.Now().Add(backoff(retry, msg.Attempts))
+	klog.Infof("message %d of queue %s failed with attempt %d, next attempt at %s: %s", msg.ID, msg.Queue, msg.Attempts, msg.NextAttempt, reason)
+	if err := c.persist.Reschedule(msg); err != nil {
+		klog.Errorf("cannot reschedule message %d of queue %s: %s", msg.ID, msg.Queue, err)
+	}
+	return false
+}
+
+// backoff calculates an exponential backoff with jitter; the returned duration is between
+// the half and the full exponential backoff
+func backoff(policy RetryPolicy, attempts int) time.Duration {
+	dura := policy.BaseBackoff
+	for i := 1; i < attempts && (policy.MaxBackoff <= 0 || dura < policy.MaxBackoff); i++ {
+		dura *= 2
+	}
+
+	if policy.MaxBackoff > 0 && dura > policy.MaxBackoff {
+		dura = policy.MaxBackoff
+	}
+
+	if dura <= 1 {
+		return dura
 	}
+
+	return dura/2 + time.Duration(rand.Int63n(int64(dura/2)))
 }
 
 // NewConnection create a new connection
 func NewConnection(baseURL string, token <-chan auth.Token, persist Persist) *Connection {
-	u := Connection{baseURL: baseURL, tokenChan: token, persist: persist}
+	u := &Connection{baseURL: baseURL, tokenChan: token, persist: persist, done: make(chan struct{}), quit: make(chan struct{})}
 	go u.renewToken()
-	return &u
+	return u
+}
+
+// send uploads a message with the current token
+func (c *Connection) send(ctx context.Context, msg Message) (*http.Response, error) {
+	return c.do(func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, msg.Method, msg.Address, strings.NewReader(string(msg.Message)))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Add("Idempotency-Key", msg.IdempotencyKey)
+		return req, nil
+	})
+}
+
+// do sends a request with the current token. If the token is rejected, a new token is
+// requested and the request is sent once more.
+func (c *Connection) do(newRequest func() (*http.Request, error)) (*http.Response, error) {
+	req, err := newRequest()
+	if err != nil {
+		return nil, err
+	}
+
+	c.authorize(req)
+	client := c.httpClient()
+
+	res, err := client.Do(req)
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+
+	c.tokenLock.RLock()
+	a := c.auth
+	c.tokenLock.RUnlock()
+	if a == nil {
+		return res, nil
+	}
+
+	klog.Warningf("token has been rejected by %s, refresh the token", req.URL.Host)
+	tok, err := a.Refresh()
+	if err != nil {
+		klog.Errorf("cannot refresh the rejected token: %s", err)
+		return res, nil
+	}
+	c.setToken(tok)
+
+	if err := res.Body.Close(); err != nil {
+		klog.Errorf("cannot close response body: %s", err)
+	}
+
+	if req, err = newRequest(); err != nil {
+		return nil, err
+	}
+
+	c.authorize(req)
+	return client.Do(req)
+}
+
+// address returns the url of the path with the query arguments
+func (c *Connection) address(path string, queryArgs map[string]string) string {
+	address := c.baseURL + "/" + path
+	if len(queryArgs) == 0 {
+		return address
+	}
+
+	query := url.Values{}
+	for i, v := range queryArgs {
+		query.Add(i, v)
+	}
+	return address + "?" + query.Encode()
+}
+
+// Get fetches a resource of the analyse cloud connection. The request is not stored in
+// the outbox.
+func (c *Connection) Get(path string, queryArgs map[string]string) (*http.Response, error) {
+	address := c.address(path, queryArgs)
+	klog.V(2).Infof("making http request against url %s with method GET", address)
+
+	return c.do(func() (*http.Request, error) {
+		return http.NewRequest("GET", address, nil)
+	})
 }
 
 // Request makes a request aggainst to the analyse cloud connection
 func (c *Connection) Request(method, path string, queryArgs map[string]string, data io.Reader) (*http.Response, error) {
-	klog.Infof("making http request against url %s with method %s", c.baseURL+"/"+path, method)
+	return c.RequestOrdered(path, method, path, queryArgs, data)
+}
+
+// RequestOrdered makes a request against the analyse cloud connection. The message will be
+// stored in the outbox, until it is uploaded successfully. Messages with the same queue
+// are uploaded in the order of their requests.
+func (c *Connection) RequestOrdered(queue, method, path string, queryArgs map[string]string, data io.Reader) (*http.Response, error) {
+	return c.RequestExpiring(queue, method, path, queryArgs, data, time.Time{})
+}
+
+// DeadLetter stores a message, which must not be uploaded, directly in the dead letter
+// table of the outbox, so that it can be inspected and replayed manually
+func (c *Connection) DeadLetter(queue, method, path string, queryArgs map[string]string, data []byte, reason string) error {
+	msg := []Message{{Address: c.address(path, queryArgs), Message: data, Method: method, Queue: queue}}
+
 	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := c.persist.Insert(msg); err != nil {
+		klog.Errorf("cannot store message of queue %s: %s", queue, err)
+		return fmt.Errorf("%w: %s", ErrNotStored, err)
+	}
+	if err := c.persist.DeadLetter(msg[0], reason); err != nil {
+		klog.Errorf("cannot dead letter message %d of queue %s: %s", msg[0].ID, queue, err)
+		// the message must not be uploaded
+		if err := c.persist.Remove(msg); err != nil {
+			klog.Errorf("cannot remove message %d of queue %s: %s", msg[0].ID, queue, err)
+		}
+		return fmt.Errorf("%w: %s", ErrNotStored, err)
+	}
+	klog.Errorf("message %d of queue %s is dead lettered: %s", msg[0].ID, queue, reason)
+	return nil
+}
+
+// RequestExpiring is a RequestOrdered,whose message is purged from the outbox instead of
+// replayed, if it could not be uploaded before it expires; a zero time never expires
+func (c *Connection) RequestExpiring(queue, method, path string, queryArgs map[string]string, data io.Reader, expires time.Time) (*http.Response, error) {
+	return c.RequestExpiringContext(context.Background(), queue, method, path, queryArgs, data, expires)
+}
+
+// RequestExpiringContext is a RequestExpiring, whose upload is canceled, when the context
+// is done; the canceled message is kept in the outbox and a message, whose context is
+// already done, is only stored
+func (c *Connection) RequestExpiringContext(ctx context.Context, queue, method, path string, queryArgs map[string]string, data io.Reader, expires time.Time) (*http.Response, error) {
+	address := c.address(path, queryArgs)
+	klog.Infof("making http request against url %s with method %s", address, method)
 
 	dataArray, err := ioutil.ReadAll(data)
 	if err != nil {
 		klog.Errorf("cannot read all data from io.Reader: %s", err)
 		return nil, err
 	}
-	msg := []Message{{Address: c.baseURL + "/" + path, Message: dataArray, Method: method}}
-	c.persist.Insert(msg)
-	req, err := http.NewRequest(method, c.baseURL+"/"+path, strings.NewReader(string(dataArray)))
-	if err != nil {
-		return nil, err
-	}
 
-	for i, v := range queryArgs {
-		req.URL.Query().Add(i, v)
+	// the lock is only held to store the message, so a hanging upload does not block the
+	// other requests
+	c.lock.Lock()
+	msg := []Message{{Address: address, Message: dataArray, Method: method, Queue: queue, Expires: expires}}
+	if err := c.persist.Insert(msg); err != nil {
+		c.lock.Unlock()
+		klog.Errorf("cannot store message of queue %s: %s", queue, err)
+		return nil, fmt.Errorf("%w: %s", ErrNotStored, err)
 	}
 
-	req.Header.Add("token", c.token)
-	client := http.Client{}
+	if c.persist.Queued(queue, msg[0].ID) {
+		c.lock.Unlock()
+		return nil, ErrQueued
+	}
+	if ctx.Err() != nil {
+		// the message is only stored, e.g. after the deadline of the shutdown
+		c.lock.Unlock()
+		return nil, ctx.Err()
+	}
+	c.setSending(msg[0].ID, true)
+	c.lock.Unlock()
+	defer func() {
+		c.lock.Lock()
+		c.setSending(msg[0].ID, false)
+		c.lock.Unlock()
+	}()
 
-	res, err := client.Do(req)
+	res, err := c.send(ctx, msg[0])
 	if err != nil {
+		c.failed(msg[0], err.Error())
 		return res, err
 	}
 
 	if res.StatusCode >= 200 && res.StatusCode < 300 {
-		c.persist.Remove(msg)
+		if err := c.persist.Remove(msg); err != nil {
+			// the message is sent once more with the same idempotency key
+			klog.Errorf("cannot remove uploaded message %d of queue %s: %s", msg[0].ID, queue, err)
+		}
+	} else {
+		c.failed(msg[0], fmt.Sprintf("unexpected status code %d", res.StatusCode))
 	}
-	c.lock.Unlock()
 
 	return res, err
 }
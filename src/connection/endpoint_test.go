@@ -1,14 +1,19 @@
 package connection
 
 import (
+	"context"
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/auth"
 )
 
 func TestRequest(t *testing.T) {
@@ -83,7 +88,7 @@ func TestRequest(t *testing.T) {
 			defer ts.Close()
 
 			db, err := gorm.Open("sqlite3", "test_endpoint.db")
-			db.AutoMigrate(&message{})
+			db.AutoMigrate(&message{}, &deadMessage{})
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -98,3 +103,416 @@ func TestRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestSendMissingData(t *testing.T) {
+	var received []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("cannot read transmitted data %s", err)
+		}
+
+		if r.Header.Get("token") != "token" {
+			t.Errorf("use wrong token: %s", r.Header.Get("token"))
+		}
+
+		if r.Header.Get("Idempotency-Key") == "" {
+			t.Errorf("no idempotency key is transmitted")
+		}
+
+		received = append(received, string(data))
+		if string(data) == "fail" || string(data) == "dead" {
+			w.WriteHeader(500)
+			return
+		}
+		w.WriteHeader(201)
+	}))
+	defer ts.Close()
+
+	pers, db, err := initDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	pers.Insert([]Message{
+		{Method: http.MethodPost, Address: ts.URL, Message: []byte("fail"), Queue: "blocked"},
+		{Method: http.MethodPost, Address: ts.URL, Message: []byte("after fail"), Queue: "blocked"},
+		{Method: http.MethodPost, Address: ts.URL, Message: []byte("later"), Queue: "later", NextAttempt: now.Add(time.Hour)},
+		{Method: http.MethodPost, Address: ts.URL, Message: []byte("dead"), Queue: "dead", Attempts: 2},
+		{Method: http.MethodPost, Address: ts.URL, Message: []byte("after dead"), Queue: "dead"},
+		{Method: http.MethodPost, Address: ts.URL, Message: []byte("expired"), Queue: "expired", NextAttempt: now.Add(time.Hour), Expires: now},
+		{Method: http.MethodPost, Address: ts.URL, Message: []byte("after expired"), Queue: "expired"},
+	})
+
+	c := Connection{
+		token:   "token",
+		persist: pers,
+		retry:   RetryPolicy{BaseBackoff: time.Minute, MaxBackoff: time.Hour, MaxAttempts: 3},
+	}
+	c.sendMissingData(context.Background(), now)
+
+	expected := []string{"fail", "dead", "after dead", "after expired"}
+	if strings.Join(received, ",") != strings.Join(expected, ",") {
+		t.Errorf("unexpected uploaded messages: %v != %v", received, expected)
+	}
+
+	var left []string
+	for _, v := range pers.Query() {
+		left = append(left, string(v.Message))
+		if string(v.Message) == "fail" && (v.Attempts != 1 || !v.NextAttempt.After(now)) {
+			t.Errorf("failed message is not rescheduled: %v", v)
+		}
+	}
+
+	expected = []string{"fail", "after fail", "later"}
+	if strings.Join(left, ",") != strings.Join(expected, ",") {
+		t.Errorf("unexpected messages in the outbox: %v != %v", left, expected)
+	}
+
+	var dead []deadMessage
+	db.Find(&dead)
+	if len(dead) != 1 || string(dead[0].Message) != "dead" {
+		t.Errorf("unexpected dead letter table: %v", dead)
+	}
+
+	cleanUp(db)
+	if err := pers.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDrainDeadline(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	pers, db, err := initDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pers.Insert([]Message{
+		{Method: http.MethodPost, Address: ts.URL, Message: []byte("hung"), Queue: "hung"},
+		{Method: http.MethodPost, Address: ts.URL, Message: []byte("other"), Queue: "other"},
+	})
+
+	c := NewConnection(ts.URL, nil, pers)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	c.Drain(ctx)
+	if time.Since(start) > time.Second {
+		t.Errorf("drain has not been canceled at the deadline")
+	}
+
+	if left := pers.Query(); len(left) != 2 {
+		t.Errorf("unexpected messages in the outbox: %v", left)
+	}
+
+	cleanUp(db)
+	if err := pers.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHungRequest(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "hung") {
+			<-release
+		}
+		w.WriteHeader(201)
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	pers, db, err := initDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewConnection(ts.URL, nil, pers)
+	c.SetTimeout(time.Second)
+
+	hung := make(chan error, 1)
+	go func() {
+		_, err := c.Request("POST", "hung", nil, strings.NewReader("hung"))
+		hung <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		res, err := c.Request("POST", "other", nil, strings.NewReader("other"))
+		if err != nil || res.StatusCode != 201 {
+			t.Errorf("request is not sent during a hung request: %v", err)
+		}
+
+		// the outbox does not send the message of the hung request a second time
+		c.sendMissingData(context.Background(), time.Now())
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatalf("requests are blocked by a hung request")
+	}
+
+	if err := <-hung; err == nil {
+		t.Errorf("hung request has not timed out")
+	}
+
+	if left := pers.Query(); len(left) != 1 || string(left[0].Message) != "hung" || left[0].Attempts != 1 {
+		t.Errorf("unexpected messages in the outbox: %v", left)
+	}
+
+	cleanUp(db)
+	if err := pers.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRequestNotStored(t *testing.T) {
+	var sent bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = true
+		w.WriteHeader(201)
+	}))
+	defer ts.Close()
+
+	pers, db, err := initDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the outbox cannot store any message without its table
+	cleanUp(db)
+
+	c := NewConnection(ts.URL, nil, pers)
+	if _, err := c.Request("POST", "path", nil, strings.NewReader("data")); !errors.Is(err, ErrNotStored) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if err := c.DeadLetter("queue", "POST", "path", nil, []byte("data"), "invalid"); !errors.Is(err, ErrNotStored) {
+		t.Errorf("unexpected dead letter error: %v", err)
+	}
+
+	if sent {
+		t.Errorf("message, which is not stored, has been sent")
+	}
+
+	if err := pers.Close(); err != nil {
+		t.Error(err)
+	}
+
+	// without the dead letter table the message is stored, but cannot be dead lettered
+	pers, db, err = initDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.DropTable(&deadMessage{})
+
+	c = NewConnection(ts.URL, nil, pers)
+	if err := c.DeadLetter("queue", "POST", "path", nil, []byte("data"), "invalid"); !errors.Is(err, ErrNotStored) {
+		t.Errorf("unexpected dead letter error: %v", err)
+	}
+
+	if ret := pers.Query(); len(ret) != 0 {
+		t.Errorf("message, which cannot be dead lettered, is kept in the outbox: %v", ret)
+	}
+	cleanUp(db)
+
+	if err := pers.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRetire(t *testing.T) {
+	var attempts int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(500)
+			return
+		}
+		w.WriteHeader(201)
+	}))
+	defer ts.Close()
+
+	pers, db, err := initDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pers.Insert([]Message{{Method: http.MethodDelete, Address: ts.URL, Message: []byte("delete"), Queue: "contract"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewConnection(ts.URL, nil, pers)
+	c.SetRetryPolicy(RetryPolicy{Interval: 10 * time.Millisecond, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+	go c.SendMissingData()
+
+	retired := make(chan bool, 1)
+	go func() {
+		retired <- c.Retire()
+	}()
+
+	select {
+	case closed := <-retired:
+		if !closed {
+			t.Errorf("connection has not been closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("connection has not been retired")
+	}
+
+	if left := pers.Query(); len(left) != 0 || attempts != 2 {
+		t.Errorf("outbox has not been sent before the closing: %v after %d attempts", left, attempts)
+	}
+
+	if c.Reuse() {
+		t.Errorf("closed connection has been reused")
+	}
+
+	cleanUp(db)
+	if err := pers.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReuse(t *testing.T) {
+	pers, db, err := initDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pers.Insert([]Message{{Method: http.MethodPost, Address: "http://unreachable", Message: []byte("data")}}); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewConnection("http://unreachable", nil, pers)
+	retired := make(chan bool, 1)
+	go func() {
+		retired <- c.Retire()
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	if !c.Reuse() {
+		t.Fatalf("retiring connection cannot be reused")
+	}
+	if closed := <-retired; closed {
+		t.Errorf("reused connection has been closed")
+	}
+
+	cleanUp(db)
+	if err := pers.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	testTable := []struct {
+		description string
+		attempts    int
+		min         time.Duration
+		max         time.Duration
+	}{
+		{"first attempt", 1, 5 * time.Second, 10 * time.Second},
+		{"third attempt", 3, 20 * time.Second, 40 * time.Second},
+		{"limited by the maximal backoff", 20, 30 * time.Minute, time.Hour},
+	}
+
+	policy := RetryPolicy{BaseBackoff: 10 * time.Second, MaxBackoff: time.Hour}
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			dura := backoff(policy, test.attempts)
+			if dura < test.min || dura > test.max {
+				t.Errorf("backoff %s is not between %s and %s", dura, test.min, test.max)
+			}
+		})
+	}
+}
+
+type testToken string
+
+func (t testToken) AuthToken() string {
+	return string(t)
+}
+
+// refreshAuth returns a new token on every refresh
+type refreshAuth struct {
+	refreshed int
+}
+
+func (a *refreshAuth) Login() error {
+	return nil
+}
+
+func (a *refreshAuth) Logout() error {
+	return nil
+}
+
+func (a *refreshAuth) Refresh() (auth.Token, error) {
+	a.refreshed++
+	return testToken("refreshed"), nil
+}
+
+func TestRejectedToken(t *testing.T) {
+	testTable := []struct {
+		description string
+		valid       string
+		status      int
+		refreshed   int
+	}{
+		{
+			description: "accepted token",
+			valid:       "token",
+			status:      http.StatusOK,
+		},
+		{
+			description: "refreshed token",
+			valid:       "refreshed",
+			status:      http.StatusOK,
+			refreshed:   1,
+		},
+		{
+			description: "rejected refreshed token",
+			valid:       "other",
+			status:      http.StatusUnauthorized,
+			refreshed:   1,
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("token") != test.valid {
+					w.WriteHeader(http.StatusUnauthorized)
+				}
+			}))
+			defer ts.Close()
+
+			a := &refreshAuth{}
+			c := Connection{baseURL: ts.URL, token: "token", auth: a}
+
+			res, err := c.Get("results", nil)
+			if err != nil {
+				t.Fatalf("cannot send request: %s", err)
+			}
+
+			if err := res.Body.Close(); err != nil {
+				t.Error(err)
+			}
+
+			if res.StatusCode != test.status || a.refreshed != test.refreshed {
+				t.Errorf("unexpected status code %d after %d refreshs", res.StatusCode, a.refreshed)
+			}
+		})
+	}
+}
@@ -36,4 +36,6 @@ type SensorDataBody struct {
 type SensorData struct {
 	Body      SensorDataBody `json:"body"`
 	Signature string         `json:"signature,omitempty"`
+	// SignatureMeta is set, if the update is signed by the edge
+	SignatureMeta *SignatureMeta `json:"signatureMeta,omitempty"`
 }
@@ -1,58 +1,93 @@
 package connection
 
 import (
+	"crypto/rand"
 	"fmt"
+	"time"
 
 	"github.com/jinzhu/gorm"
 )
 
 // Message defines the message, which should be uploaded to the analysis cloud
 type message struct {
-	//gorm.Model
-	Method  string
-	Address string
-	Message []byte
+	ID             uint `gorm:"primary_key"`
+	CreatedAt      time.Time
+	IdempotencyKey string `gorm:"unique_index"`
+	Method         string
+	Address        string
+	Message        []byte
+	Queue          string `gorm:"index"`
+	Target         string `gorm:"index"`
+	Attempts       int
+	NextAttempt    time.Time
+	Expires        time.Time
+}
+
+// deadMessage is a message, which could not be uploaded after the maximal number of attempts
+type deadMessage struct {
+	ID             uint `gorm:"primary_key"`
+	CreatedAt      time.Time
+	IdempotencyKey string
+	Method         string
+	Address        string
+	Message        []byte
+	Queue          string
+	Target         string
+	Attempts       int
+	Expires        time.Time
+	Reason         string
+	Failed         time.Time
 }
 
 // Persist is the interface, to store enable a persistent in this tool
 type Persist interface {
 	Close() error
-	Insert([]Message)
-	Remove([]Message)
+	// Insert stores the messages and sets the ID, the creation time and, if it is
+	// missing, the idempotency key of each message; no message is stored on error
+	Insert([]Message) error
+	// Remove deletes the messages with the IDs of the given messages
+	Remove([]Message) error
+	// Query returns all stored messages ordered by their insertion
 	Query() []Message
+	// Queued tests if older messages of the queue are waiting to be uploaded
+	Queued(queue string, before uint) bool
+	// Reschedule stores the attempts and the next attempt of a message
+	Reschedule(Message) error
+	// DeadLetter moves a message into the dead letter table in one transaction; the
+	// message is kept in the outbox on error
+	DeadLetter(msg Message, reason string) error
+	// Target returns the outbox of an analysis target, which only contains the messages
+	// of the target
+	Target(name string) Persist
+	// Outboxes returns the names of the outboxes, which contain messages
+	Outboxes() ([]string, error)
 }
 
-// NewPersistPostgreSQL create a new Persist Tool and using PostgreSQL in the background
-func NewPersistPostgreSQL(host, user, password, database string, port int) (Persist, error) {
-	var conStr string
-	if password == "" {
-		conStr = fmt.Sprintf("host=%s user=%s port=%d sslmode=disable dbname=%s",
-			host,
-			user,
-			port,
-			database,
-		)
-	} else {
-		conStr = fmt.Sprintf("host=%s user=%s password=%s port=%d sslmode=disable dbname=%s",
-			host,
-			user,
-			password,
-			port,
-			database,
-		)
-	}
-	
+// NewPersistPostgreSQL create a new Persist Tool and using PostgreSQL in the background;
+// the connection string is the connection string of the edge database
+func NewPersistPostgreSQL(conStr string) (Persist, error) {
 	db, err := gorm.Open("postgres", conStr)
 	if err != nil {
 		return persist{}, err
 	}
 
-	db.AutoMigrate(&message{})
+	// the tables are created by the schema migrations of the edge database
 	return persist{db: db}, nil
 }
 
 type persist struct {
-	db *gorm.DB
+	db     *gorm.DB
+	target string
+}
+
+func (p persist) Target(name string) Persist {
+	return persist{db: p.db, target: name}
+}
+
+func (p persist) Outboxes() ([]string, error) {
+	var names []string
+	err := p.db.Model(&message{}).Order("target").Pluck("DISTINCT target", &names).Error
+	return names, err
 }
 
 // Close the database connection
@@ -62,35 +97,95 @@ func (p persist) Close() error {
 
 // Message represent a message which should be send to ther analysis platform
 type Message struct {
+	// ID is the identifier of the stored message
+	ID uint
+	// CreatedAt is the time, when the message has been stored
+	CreatedAt time.Time
+	// IdempotencyKey is sent with every upload of the message, so that the analysis
+	// platform can detect replayed messages
+	IdempotencyKey string
 	// Method describe the used REST method
 	Method string
 	// Address is the current address of the analysis platform
 	Address string
 	// Message contains the complete message of the analysis platform
 	Message []byte
+	// Queue defines the messages, which have to be uploaded in order
+	Queue string
+	// Target is the analysis target of the message
+	Target string
+	// Attempts is the number of failed uploads
+	Attempts int
+	// NextAttempt is the earliest time of the next upload
+	NextAttempt time.Time
+	// Expires is the end of the retention of the message, after which it is not uploaded
+	// anymore; a zero time never expires
+	Expires time.Time
 }
 
-// Insert insert a message into the database
-func (p persist) Insert(msg []Message) {
-	for _, v := range msg {
-		var ms message
-		ms.Address = v.Address
-		ms.Message = v.Message
-		ms.Method = v.Method
+// Insert insert the messages into the database in one transaction; no message is stored,
+// if an error is returned
+func (p persist) Insert(msg []Message) error {
+	stored := make([]message, len(msg))
+	for i, v := range msg {
+		stored[i] = message(v)
+		stored[i].Target = p.target
+		if stored[i].IdempotencyKey == "" {
+			key, err := newIdempotencyKey()
+			if err != nil {
+				return fmt.Errorf("cannot create idempotency key: %s", err)
+			}
+			stored[i].IdempotencyKey = key
+		}
+	}
+
+	tx := p.db.Begin()
+	for i := range stored {
+		if err := tx.Create(&stored[i]).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
 
-		p.db.Create(&ms)
+	for i, ms := range stored {
+		msg[i].ID = ms.ID
+		msg[i].CreatedAt = ms.CreatedAt
+		msg[i].IdempotencyKey = ms.IdempotencyKey
+		msg[i].Target = ms.Target
 	}
+	return nil
 }
 
-func (p persist) Remove(msg []Message) {
-	for _, v := range msg {
-		p.db.Where("address = ? AND message = ?", v.Address, v.Message).Delete(message{})
+// newIdempotencyKey creates a random key in the format of an uuid version 4
+func newIdempotencyKey() (string, error) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
 	}
+
+	key[6] = (key[6] & 0x0f) | 0x40
+	key[8] = (key[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", key[0:4], key[4:6], key[6:8], key[8:10], key[10:]), nil
+}
+
+func (p persist) Remove(msg []Message) error {
+	if len(msg) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(msg))
+	for i, v := range msg {
+		ids[i] = v.ID
+	}
+	return p.db.Where("id IN (?)", ids).Delete(message{}).Error
 }
 
 func (p persist) Query() []Message {
 	var ms []message
-	p.db.Find(&ms)
+	p.db.Where("target = ?", p.target).Order("id").Find(&ms)
 
 	var msg []Message
 	for _, v := range ms {
@@ -99,3 +194,48 @@ func (p persist) Query() []Message {
 
 	return msg
 }
+
+func (p persist) Queued(queue string, before uint) bool {
+	var count int
+	p.db.Model(&message{}).Where("target = ? AND queue = ? AND id < ?", p.target, queue, before).Count(&count)
+	return count > 0
+}
+
+func (p persist) Reschedule(msg Message) error {
+	return p.db.Model(&message{}).Where("id = ?", msg.ID).Updates(map[string]interface{}{
+		"attempts":     msg.Attempts,
+		"next_attempt": msg.NextAttempt,
+	}).Error
+}
+
+func (p persist) DeadLetter(msg Message, reason string) error {
+	tx := p.db.Begin()
+	if err := tx.Error; err != nil {
+		return err
+	}
+
+	err := tx.Create(&deadMessage{
+		ID:             msg.ID,
+		CreatedAt:      msg.CreatedAt,
+		IdempotencyKey: msg.IdempotencyKey,
+		Method:         msg.Method,
+		Address:        msg.Address,
+		Message:        msg.Message,
+		Queue:          msg.Queue,
+		Target:         msg.Target,
+		Attempts:       msg.Attempts,
+		Expires:        msg.Expires,
+		Reason:         reason,
+		Failed:         time.Now(),
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Where("id = ?", msg.ID).Delete(message{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
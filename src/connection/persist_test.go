@@ -3,9 +3,12 @@ package connection
 import (
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/auth"
 )
 
 func initDb() (Persist, *gorm.DB, error) {
@@ -14,12 +17,12 @@ func initDb() (Persist, *gorm.DB, error) {
 		return persist{}, nil, err
 	}
 
-	db.AutoMigrate(&message{})
+	db.AutoMigrate(&message{}, &deadMessage{})
 	return persist{db: db}, db, nil
 }
 
 func cleanUp(db *gorm.DB) {
-	db.DropTable(&message{})
+	db.DropTable(&message{}, &deadMessage{})
 }
 
 func TestInsert(t *testing.T) {
@@ -61,7 +64,9 @@ func TestInsert(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			pers.Insert(test.msg)
+			if err := pers.Insert(test.msg); err != nil {
+				t.Fatalf("cannot insert messages: %s", err)
+			}
 
 			var ms []message
 			db.Find(&ms)
@@ -96,6 +101,35 @@ func TestInsert(t *testing.T) {
 	}
 }
 
+func TestInsertFailed(t *testing.T) {
+	pers, db, err := initDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the second message violates the unique idempotency key
+	msg := []Message{
+		{Address: "foo", Message: []byte("bar"), IdempotencyKey: "key"},
+		{Address: "foo", Message: []byte("bar"), IdempotencyKey: "key"},
+	}
+	if err := pers.Insert(msg); err == nil {
+		t.Errorf("expected error on a duplicate idempotency key")
+	}
+
+	if ret := pers.Query(); len(ret) != 0 {
+		t.Errorf("messages of a failed insert are stored: %v", ret)
+	}
+
+	if msg[0].ID != 0 {
+		t.Errorf("id of a message, which is not stored, is set: %d", msg[0].ID)
+	}
+
+	cleanUp(db)
+	if err := pers.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
 func TestRemove(t *testing.T) {
 	testTable := []struct {
 		description string
@@ -134,10 +168,7 @@ func TestRemove(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			for _, m := range test.msg {
-				ms := message{Address: m.Address, Message: m.Message}
-				db.Create(&ms)
-			}
+			pers.Insert(test.msg)
 
 			var ms []message
 			db.Find(&ms)
@@ -145,7 +176,9 @@ func TestRemove(t *testing.T) {
 				t.Error("expected length is not equal to length in db")
 			}
 
-			pers.Remove(test.msg)
+			if err := pers.Remove(test.msg); err != nil {
+				t.Errorf("cannot remove messages: %s", err)
+			}
 
 			db.Find(&ms)
 			if len(ms) != 0 {
@@ -159,6 +192,45 @@ func TestRemove(t *testing.T) {
 	}
 }
 
+func TestRemoveDuplicate(t *testing.T) {
+	pers, db, err := initDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := []Message{
+		{Address: "foo", Message: []byte("bar")},
+		{Address: "foo", Message: []byte("bar")},
+	}
+	pers.Insert(msg)
+
+	if msg[0].IdempotencyKey == "" || msg[0].IdempotencyKey == msg[1].IdempotencyKey {
+		t.Errorf("identical messages have no unique idempotency keys: %s, %s", msg[0].IdempotencyKey, msg[1].IdempotencyKey)
+	}
+
+	if err := pers.Remove(msg[:1]); err != nil {
+		t.Errorf("cannot remove message: %s", err)
+	}
+
+	ret := pers.Query()
+	if len(ret) != 1 {
+		t.Fatalf("unexpected return length: %d", len(ret))
+	}
+
+	if ret[0].ID != msg[1].ID || ret[0].IdempotencyKey != msg[1].IdempotencyKey {
+		t.Errorf("the wrong message has been removed")
+	}
+
+	if ret[0].CreatedAt.IsZero() {
+		t.Errorf("creation time of the message is not stored")
+	}
+
+	cleanUp(db)
+	if err := pers.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
 func TestQuery(t *testing.T) {
 	testTable := []struct {
 		description string
@@ -185,7 +257,7 @@ func TestQuery(t *testing.T) {
 
 			for _, m := range test.msg {
 				ms := message{Message: m.Message, Address: m.Address}
-				db.Create(ms)
+				db.Create(&ms)
 			}
 
 			msg := pers.Query()
@@ -202,3 +274,216 @@ func TestQuery(t *testing.T) {
 		})
 	}
 }
+
+func TestQueued(t *testing.T) {
+	pers, db, err := initDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := []Message{
+		{Address: "foo", Message: []byte("bar"), Queue: "queue"},
+		{Address: "foo", Message: []byte("bar"), Queue: "queue"},
+		{Address: "foo", Message: []byte("bar"), Queue: "other"},
+	}
+	pers.Insert(msg)
+
+	if pers.Queued("queue", msg[0].ID) {
+		t.Errorf("the first message of the queue is reported as queued")
+	}
+
+	if !pers.Queued("queue", msg[1].ID) {
+		t.Errorf("the second message of the queue is not reported as queued")
+	}
+
+	if pers.Queued("other", msg[2].ID) {
+		t.Errorf("the message of an other queue is reported as queued")
+	}
+
+	cleanUp(db)
+	if err := pers.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReschedule(t *testing.T) {
+	pers, db, err := initDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := []Message{{Address: "foo", Message: []byte("bar")}}
+	pers.Insert(msg)
+
+	next := time.Now().Add(time.Hour).Round(time.Second)
+	msg[0].Attempts = 3
+	msg[0].NextAttempt = next
+	if err := pers.Reschedule(msg[0]); err != nil {
+		t.Errorf("cannot reschedule message: %s", err)
+	}
+
+	ret := pers.Query()
+	if len(ret) != 1 {
+		t.Fatalf("unexpected return length: %d", len(ret))
+	}
+
+	if ret[0].Attempts != 3 || !ret[0].NextAttempt.Equal(next) {
+		t.Errorf("unexpected attempts %d and next attempt %s", ret[0].Attempts, ret[0].NextAttempt)
+	}
+
+	cleanUp(db)
+	if err := pers.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	pers, db, err := initDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := []Message{{Address: "foo", Message: []byte("bar"), Queue: "queue", Attempts: 10}}
+	pers.Insert(msg)
+	if err := pers.DeadLetter(msg[0], "reason"); err != nil {
+		t.Errorf("cannot dead letter message: %s", err)
+	}
+
+	if ret := pers.Query(); len(ret) != 0 {
+		t.Errorf("dead lettered message is still in the outbox")
+	}
+
+	var dead []deadMessage
+	db.Find(&dead)
+	if len(dead) != 1 {
+		t.Fatalf("unexpected length of dead letter table: %d", len(dead))
+	}
+
+	if dead[0].ID != msg[0].ID || dead[0].Reason != "reason" || dead[0].Attempts != 10 {
+		t.Errorf("unexpected dead letter: %v", dead[0])
+	}
+
+	cleanUp(db)
+	if err := pers.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeadLetterFailed(t *testing.T) {
+	pers, db, err := initDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := []Message{{Address: "foo", Message: []byte("bar"), Queue: "queue"}}
+	if err := pers.Insert(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	// the message cannot be moved without the dead letter table
+	db.DropTable(&deadMessage{})
+	if err := pers.DeadLetter(msg[0], "reason"); err == nil {
+		t.Errorf("dead letter without dead letter table has been accepted")
+	}
+
+	if ret := pers.Query(); len(ret) != 1 || ret[0].ID != msg[0].ID {
+		t.Errorf("message is not kept in the outbox: %v", ret)
+	}
+
+	cleanUp(db)
+	if err := pers.Remove(msg); err == nil {
+		t.Errorf("remove without table has been accepted")
+	}
+	if err := pers.Reschedule(msg[0]); err == nil {
+		t.Errorf("reschedule without table has been accepted")
+	}
+
+	if err := pers.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTarget(t *testing.T) {
+	pers, db, err := initDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cloud := pers.Target("cloud")
+	onprem := pers.Target("onprem")
+	cloud.Insert([]Message{{Address: "cloud", Message: []byte("bar"), Queue: "queue"}})
+	msg := []Message{{Address: "onprem", Message: []byte("bar"), Queue: "queue"}}
+	onprem.Insert(msg)
+
+	if ret := cloud.Query(); len(ret) != 1 || ret[0].Address != "cloud" || ret[0].Target != "cloud" {
+		t.Errorf("unexpected messages of the cloud target: %v", ret)
+	}
+
+	if onprem.Queued("queue", msg[0].ID) {
+		t.Errorf("the message of an other target is reported as queued")
+	}
+
+	if ret := pers.Query(); len(ret) != 0 {
+		t.Errorf("messages of the targets are returned without target: %v", ret)
+	}
+
+	cleanUp(db)
+	if err := pers.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOutboxes(t *testing.T) {
+	pers, db, err := initDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"cloud", "cloud http://first ", "cloud"} {
+		if err := pers.Target(name).Insert([]Message{{Address: "foo", Message: []byte("bar")}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	outboxes, err := pers.Outboxes()
+	if err != nil {
+		t.Fatalf("cannot read the outboxes: %s", err)
+	}
+	if len(outboxes) != 2 || outboxes[0] != "cloud" || outboxes[1] != "cloud http://first " {
+		t.Errorf("unexpected outboxes: %q", outboxes)
+	}
+
+	cleanUp(db)
+	if err := pers.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConnectionDeadLetter(t *testing.T) {
+	pers, db, err := initDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	con := NewConnection("http://localhost", make(chan auth.Token), pers)
+	con.DeadLetter("queue", "POST", "machine-data", map[string]string{"contract": "c"}, []byte("bar"), "invalid")
+
+	if ret := pers.Query(); len(ret) != 0 {
+		t.Errorf("dead lettered message is in the outbox")
+	}
+
+	var dead []deadMessage
+	db.Find(&dead)
+	if len(dead) != 1 {
+		t.Fatalf("unexpected length of dead letter table: %d", len(dead))
+	}
+
+	if dead[0].Address != "http://localhost/machine-data?contract=c" || dead[0].Reason != "invalid" || string(dead[0].Message) != "bar" {
+		t.Errorf("unexpected dead letter: %v", dead[0])
+	}
+
+	cleanUp(db)
+	if err := pers.Close(); err != nil {
+		t.Error(err)
+	}
+}
@@ -12,9 +12,29 @@ const EdgeDatabaseUser = "edge.database.user"
 // EdgeDatabasePassword contains the config string to define the database password
 const EdgeDatabasePassword = "edge.database.password"
 
+// EdgeDatabasePasswordFile contains the config string to define the file, which contains
+// the database password
+const EdgeDatabasePasswordFile = EdgeDatabasePassword + "_file"
+
 // EdgeDatabaseDatabase contains the config string to define the database in the database
 const EdgeDatabaseDatabase = "edge.database.database"
 
+// EdgeDatabaseSSLMode contains the config string to define the sslmode of the connection
+// to the database; possible values are the sslmodes of postgres
+const EdgeDatabaseSSLMode = "edge.database.sslMode"
+
+// EdgeDatabaseTLSCA contains the config string to define the ca bundle, which is used to
+// verify the certificate of the database
+const EdgeDatabaseTLSCA = "edge.database.tls.ca"
+
+// EdgeDatabaseTLSCert contains the config string to define the client certificate of the
+// connection to the database
+const EdgeDatabaseTLSCert = "edge.database.tls.cert"
+
+// EdgeDatabaseTLSKey contains the config string to define the private key of the client
+// certificate of the connection to the database
+const EdgeDatabaseTLSKey = "edge.database.tls.key"
+
 // EdgeMqttURL contains the config string to define the url of the mqtt brocker
 const EdgeMqttURL = "edge.mqtt.url"
 
@@ -29,12 +49,102 @@ const EdgeMqttUser = "edge.mqtt.user"
 // the user on the mqtt brocker
 const EdgeMqttPassword = "edge.mqtt.password"
 
+// EdgeMqttPasswordFile contains the config string to define the file, which contains the
+// password used by mqtt
+const EdgeMqttPasswordFile = EdgeMqttPassword + "_file"
+
+// EdgeMqttTLSCA contains the config string to define the ca bundle, which is used to verify
+// the certificate of the mqtt broker
+const EdgeMqttTLSCA = "edge.mqtt.tls.ca"
+
+// EdgeMqttTLSCert contains the config string to define the client certificate of the
+// connection to the mqtt broker
+const EdgeMqttTLSCert = "edge.mqtt.tls.cert"
+
+// EdgeMqttTLSKey contains the config string to define the private key of the client
+// certificate of the connection to the mqtt broker
+const EdgeMqttTLSKey = "edge.mqtt.tls.key"
+
+// EdgeMqttTLSServerName contains the config string to define the name, which is expected
+// in the certificate of the mqtt broker
+const EdgeMqttTLSServerName = "edge.mqtt.tls.serverName"
+
+// EdgeTLSReloadInterval contains the config string to define the interval, in which the
+// certificate files are checked for changes
+const EdgeTLSReloadInterval = "edge.tls.reloadInterval"
+
+// EdgeSecretsReloadInterval contains the config string to define the interval, in which the
+// secret files of the user managements are checked for changes
+const EdgeSecretsReloadInterval = "edge.secrets.reloadInterval"
+
+// EdgeShutdownTimeout contains the config string to define the deadline of the graceful
+// shutdown
+const EdgeShutdownTimeout = "edge.shutdown.timeout"
+
+// AnalysisCloud contains the config string of the analysis cloud section, which defines the
+// default analysis target; its keys are the defaults of every analysis target
+const AnalysisCloud = "analysisCloud"
+
+// AnalysisCloudEnabled contains the config string to define if contracts and sensor data
+// are sent to the analysis target
+const AnalysisCloudEnabled = "analysisCloud.enabled"
+
+// AnalysisCloudInterval contains the config string to define the upload interval of the
+// analysis systems, which do not define an interval in the contract
+const AnalysisCloudInterval = "analysisCloud.interval"
+
+// AnalysisCloudAllowedHosts contains the config string to define the hosts of the
+// endpoints and user managements, which the contracts of the analysis target may define;
+// the edge logs in at these user managements with the credentials of the target
+const AnalysisCloudAllowedHosts = "analysisCloud.allowedHosts"
+
+// AnalysisTargets contains the config string to define the named analysis targets; each
+// target is matched with the analysis systems of the contracts by its name and supports
+// the keys of the analysis cloud section
+const AnalysisTargets = "analysisTargets"
+
 // AnalysisCloudConnectorURL contains the config string to define the analysis cloud url
 const AnalysisCloudConnectorURL = "analysisCloud.connector.url"
 
 // AnalysisCloudConnectorPort contains the config string to define the analysis cloud port
 const AnalysisCloudConnectorPort = "analysisCloud.connector.port"
 
+// AnalysisCloudConnectorTimeout contains the config string to define the timeout of the
+// requests to the analysis cloud
+const AnalysisCloudConnectorTimeout = "analysisCloud.connector.timeout"
+
+// AnalysisCloudConnectorTLSCA contains the config string to define the ca bundle, which is
+// used to verify the certificate of the analysis cloud
+const AnalysisCloudConnectorTLSCA = "analysisCloud.connector.tls.ca"
+
+// AnalysisCloudConnectorTLSCert contains the config string to define the client
+// certificate of the connection to the analysis cloud
+const AnalysisCloudConnectorTLSCert = "analysisCloud.connector.tls.cert"
+
+// AnalysisCloudConnectorTLSKey contains the config string to define the private key of
+// the client certificate of the connection to the analysis cloud
+const AnalysisCloudConnectorTLSKey = "analysisCloud.connector.tls.key"
+
+// AnalysisCloudConnectorTLSServerName contains the config string to define the name, which
+// is expected in the certificate of the analysis cloud
+const AnalysisCloudConnectorTLSServerName = "analysisCloud.connector.tls.serverName"
+
+// AnalysisCloudUserMgmtTLSCA contains the config string to define the ca bundle, which is
+// used to verify the certificate of the analysis user mgmt
+const AnalysisCloudUserMgmtTLSCA = "analysisCloud.userMgmt.tls.ca"
+
+// AnalysisCloudUserMgmtTLSCert contains the config string to define the client
+// certificate of the connection to the analysis user mgmt
+const AnalysisCloudUserMgmtTLSCert = "analysisCloud.userMgmt.tls.cert"
+
+// AnalysisCloudUserMgmtTLSKey contains the config string to define the private key of the
+// client certificate of the connection to the analysis user mgmt
+const AnalysisCloudUserMgmtTLSKey = "analysisCloud.userMgmt.tls.key"
+
+// AnalysisCloudUserMgmtTLSServerName contains the config string to define the name, which
+// is expected in the certificate of the analysis user mgmt
+const AnalysisCloudUserMgmtTLSServerName = "analysisCloud.userMgmt.tls.serverName"
+
 // AnalysisCloudUserMgmtURL contains the config string to define the analysis user mgmt
 // url
 const AnalysisCloudUserMgmtURL = "analysisCloud.userMgmt.url"
@@ -45,6 +155,10 @@ const AnalysisCloudUserMgmtSchema = "analysisCloud.userMgmt.schema"
 // AnalysisCloudUserMgmtPath defines the used schema
 const AnalysisCloudUserMgmtPath = "analysisCloud.userMgmt.path"
 
+// AnalysisCloudUserMgmtTimeout contains the config string to define the timeout of the
+// requests to the analysis user mgmt
+const AnalysisCloudUserMgmtTimeout = "analysisCloud.userMgmt.timeout"
+
 // AnalysisCloudUserMgmtPort contains the config string to define the analysis user mgmt
 // port
 const AnalysisCloudUserMgmtPort = "analysisCloud.userMgmt.port"
@@ -56,3 +170,151 @@ const AnalysisCloudUserMgmtUser = "analysisCloud.userMgmt.user"
 // AnalysisCloudUserMgmtPassword contains the config string to define tha analysis user
 // mgmt password
 const AnalysisCloudUserMgmtPassword = "analysisCloud.userMgmt.password"
+
+// AnalysisCloudUserMgmtPasswordFile contains the config string to define the file, which
+// contains the analysis user mgmt password
+const AnalysisCloudUserMgmtPasswordFile = AnalysisCloudUserMgmtPassword + "_file"
+
+// AnalysisCloudUserMgmtProvider contains the config string to define the token provider of
+// the analysis user mgmt; possible values are form, clientCredentials, password,
+// refreshToken and static
+const AnalysisCloudUserMgmtProvider = "analysisCloud.userMgmt.provider"
+
+// AnalysisCloudUserMgmtTokenPath contains the config string to define the path of the
+// token endpoint below the path of the analysis user mgmt
+const AnalysisCloudUserMgmtTokenPath = "analysisCloud.userMgmt.tokenPath"
+
+// AnalysisCloudUserMgmtRevocationPath contains the config string to define the path of the
+// token revocation endpoint below the path of the analysis user mgmt
+const AnalysisCloudUserMgmtRevocationPath = "analysisCloud.userMgmt.revocationPath"
+
+// AnalysisCloudUserMgmtLogoutPath contains the config string to define the path of the
+// end session endpoint of the form login below the path of the analysis user mgmt
+const AnalysisCloudUserMgmtLogoutPath = "analysisCloud.userMgmt.logoutPath"
+
+// AnalysisCloudUserMgmtClientID contains the config string to define the OAuth2 client id
+const AnalysisCloudUserMgmtClientID = "analysisCloud.userMgmt.clientId"
+
+// AnalysisCloudUserMgmtClientSecret contains the config string to define the OAuth2 client
+// secret
+const AnalysisCloudUserMgmtClientSecret = "analysisCloud.userMgmt.clientSecret"
+
+// AnalysisCloudUserMgmtClientSecretFile contains the config string to define the file,
+// which contains the OAuth2 client secret
+const AnalysisCloudUserMgmtClientSecretFile = AnalysisCloudUserMgmtClientSecret + "_file"
+
+// AnalysisCloudUserMgmtScope contains the config string to define the requested OAuth2
+// scopes
+const AnalysisCloudUserMgmtScope = "analysisCloud.userMgmt.scope"
+
+// AnalysisCloudUserMgmtRefreshToken contains the config string to define the refresh token
+// of the refreshToken provider
+const AnalysisCloudUserMgmtRefreshToken = "analysisCloud.userMgmt.refreshToken"
+
+// AnalysisCloudUserMgmtRefreshTokenFile contains the config string to define the file,
+// which contains the refresh token of the refreshToken provider
+const AnalysisCloudUserMgmtRefreshTokenFile = AnalysisCloudUserMgmtRefreshToken + "_file"
+
+// AnalysisCloudUserMgmtToken contains the config string to define the token of the static
+// provider
+const AnalysisCloudUserMgmtToken = "analysisCloud.userMgmt.token"
+
+// AnalysisCloudUserMgmtTokenFile contains the config string to define the file, which
+// contains the token of the static provider
+const AnalysisCloudUserMgmtTokenFile = AnalysisCloudUserMgmtToken + "_file"
+
+// AnalysisCloudUserMgmtHeader contains the config string to define the header, in which
+// the token of the static provider is sent
+const AnalysisCloudUserMgmtHeader = "analysisCloud.userMgmt.header"
+
+// AnalysisCloudUserMgmtRenewalFraction contains the config string to define the fraction
+// of the lifetime of a token, after which the token is renewed
+const AnalysisCloudUserMgmtRenewalFraction = "analysisCloud.userMgmt.renewal.fraction"
+
+// AnalysisCloudUserMgmtRenewalBackoffBase contains the config string to define the backoff
+// after the first failed token renewal
+const AnalysisCloudUserMgmtRenewalBackoffBase = "analysisCloud.userMgmt.renewal.backoff.base"
+
+// AnalysisCloudUserMgmtRenewalBackoffMax contains the config string to define the maximal
+// backoff between two failed token renewals
+const AnalysisCloudUserMgmtRenewalBackoffMax = "analysisCloud.userMgmt.renewal.backoff.max"
+
+// EdgeBufferType contains the config string to define the type of the sensor update
+// buffer; possible values are memory and file
+const EdgeBufferType = "edge.buffer.type"
+
+// EdgeBufferPath contains the config string to define the directory, which is used by
+// the file buffer
+const EdgeBufferPath = "edge.buffer.path"
+
+// EdgeBufferOverflow contains the config string to define the overflow policy of the
+// memory buffer; possible values are drop-oldest, drop-newest, downsample and spill-to-disk
+const EdgeBufferOverflow = "edge.buffer.overflow"
+
+// EdgeBufferLimitsSensorCount contains the config string to define the maximal number of
+// buffered updates of a machine sensor combination
+const EdgeBufferLimitsSensorCount = "edge.buffer.limits.sensor.count"
+
+// EdgeBufferLimitsSensorBytes contains the config string to define the maximal size in
+// bytes of the buffered updates of a machine sensor combination
+const EdgeBufferLimitsSensorBytes = "edge.buffer.limits.sensor.bytes"
+
+// EdgeBufferLimitsGlobalCount contains the config string to define the maximal number of
+// buffered updates
+const EdgeBufferLimitsGlobalCount = "edge.buffer.limits.global.count"
+
+// EdgeBufferLimitsGlobalBytes contains the config string to define the maximal size in
+// bytes of all buffered updates
+const EdgeBufferLimitsGlobalBytes = "edge.buffer.limits.global.bytes"
+
+// EdgeBufferPurgeInterval contains the config string to define the duration between two
+// purges of the buffered updates, whose storage duration on the edge has ended
+const EdgeBufferPurgeInterval = "edge.buffer.purgeInterval"
+
+// EdgeSignatureEnabled contains the config string to define if the signatures of the
+// contracts and sensor updates are verified
+const EdgeSignatureEnabled = "edge.signature.enabled"
+
+// EdgeSignatureTrustStore contains the config string to define the directory, which
+// contains the trusted public keys and certificates in PEM format
+const EdgeSignatureTrustStore = "edge.signature.trustStore"
+
+// EdgeSignatureRejectionTopic contains the config string to define the mqtt topic, on
+// which rejected messages are published
+const EdgeSignatureRejectionTopic = "edge.signature.rejectionTopic"
+
+// EdgeSignatureKey contains the config string to define the private key in PEM format,
+// which signs the contracts and sensor updates sent to the analysis cloud
+const EdgeSignatureKey = "edge.signature.key"
+
+// EdgeSchemaEnabled contains the config string to define if the incoming and outgoing
+// messages are validated against the json schemas
+const EdgeSchemaEnabled = "edge.schema.enabled"
+
+// EdgeSchemaErrorTopic contains the config string to define the mqtt topic, on which
+// messages violating a schema are published with the validation report
+const EdgeSchemaErrorTopic = "edge.schema.errorTopic"
+
+// EdgeContractsParentDeletion contains the config string to define how the deletion of a
+// parent contract is handled; possible values are block and cascade
+const EdgeContractsParentDeletion = "edge.contracts.parentDeletion"
+
+// AnalysisCloudOutboxInterval contains the config string to define the duration between
+// two runs of the outbox, which uploads the messages that could not be sent previously
+const AnalysisCloudOutboxInterval = "analysisCloud.outbox.interval"
+
+// AnalysisCloudOutboxMaxAttempts contains the config string to define the number of
+// attempts before a message is moved to the dead letter table
+const AnalysisCloudOutboxMaxAttempts = "analysisCloud.outbox.maxAttempts"
+
+// AnalysisCloudOutboxBackoffBase contains the config string to define the backoff after
+// the first failed upload of a message
+const AnalysisCloudOutboxBackoffBase = "analysisCloud.outbox.backoff.base"
+
+// AnalysisCloudOutboxBackoffMax contains the config string to define the maximal backoff
+// between two uploads of a message
+const AnalysisCloudOutboxBackoffMax = "analysisCloud.outbox.backoff.max"
+
+// AnalysisCloudResultsInterval contains the config string to define the duration between
+// two polls of the analysis results; 0 disables the polling
+const AnalysisCloudResultsInterval = "analysisCloud.results.interval"
@@ -13,7 +13,6 @@ type MachineSensor struct {
 }
 
 // GetMachineSensorFromContract loads all machine sensors based on a contract id
-// TODO function needs an unittest
 func GetMachineSensorFromContract(db *sql.DB, contract string) ([]MachineSensor, error) {
 	res, err := db.Query("SELECT machine, sensor FROM machine_sensor JOIN contract_machine_sensor ON machine_sensor = id WHERE contract = $1", contract)
 	if err != nil {
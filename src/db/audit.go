@@ -0,0 +1,14 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// AddUploadAudit stores the audit entry of a batch of sensor updates, which has been
+// forwarded to the recipients of a contract at an analysis target
+func AddUploadAudit(db *sql.DB, contract, target, machine, sensor string, recipients []string, updates, bytes int, queued bool) error {
+	_, err := db.Exec("INSERT INTO upload_audit (contract, target, machine, sensor, recipients, updates, bytes, queued) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		contract, target, machine, sensor, strings.Join(recipients, ","), updates, bytes, queued)
+	return err
+}
@@ -0,0 +1,28 @@
+package db
+
+import (
+	"testing"
+
+	dbMock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestAddUploadAudit(t *testing.T) {
+	db, mock, err := dbMock.New(dbMock.QueryMatcherOption(dbMock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("cannot open database mock: %s", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectExec("INSERT INTO upload_audit (contract, target, machine, sensor, recipients, updates, bytes, queued) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)").
+		WithArgs("contract", "cloud", "machine", "sensor", "partner1,partner2", 3, 512, false).
+		WillReturnResult(dbMock.NewResult(1, 1))
+
+	if err := AddUploadAudit(db, "contract", "cloud", "machine", "sensor", []string{"partner1", "partner2"}, 3, 512, false); err != nil {
+		t.Errorf("cannot add upload audit: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("not all expectaions were met: %s\n", err)
+	}
+}
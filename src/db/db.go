@@ -8,6 +8,15 @@ import (
 	"k8s.io/klog"
 )
 
+// Executor executes the statements of the functions, which change the contracts. It is
+// implemented by *sql.DB and *sql.Tx, so that the changes of a contract can be applied in
+// one transaction.
+type Executor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 // ContractExists tests if a contract with a specific id exists or not
 func ContractExists(db *sql.DB, contract string) (bool, error) {
 	klog.Infof("test if the contract %s already exists", contract)
@@ -29,71 +38,51 @@ func ContractExists(db *sql.DB, contract string) (bool, error) {
 	return true, nil
 }
 
-// Insert data from a new contract
-func Insert(db *sql.DB, machine, sensor, duration, version, contract string) error {
+// Insert stores a machine sensor combination of a contract. The duration and the version
+// of an existing contract are updated and a machine sensor combination, which is already
+// stored for the contract, is not inserted twice. The duration is stored in seconds.
+func Insert(db Executor, machine, sensor string, duration time.Duration, version, contract string) error {
 
 	klog.Infof("insert machine %s sensor %s duration %s version %s and contract %s into db", machine, sensor, duration, version, contract)
 
-	machineSensorIDQuery, err := db.Query("SELECT id FROM machine_sensor WHERE machine = $1 AND sensor = $2", machine, sensor)
+	// every query is read completely, before the next statement is executed, because a
+	// transaction cannot execute statements while the rows of a query are open
+	var machineSensorID int64
+	err := db.QueryRow("SELECT id FROM machine_sensor WHERE machine = $1 AND sensor = $2", machine, sensor).Scan(&machineSensorID)
+	if err == sql.ErrNoRows {
+		err = db.QueryRow("INSERT INTO machine_sensor (machine, sensor) VALUES ($1, $2) RETURNING id", machine, sensor).Scan(&machineSensorID)
+	}
 	if err != nil {
 		return err
 	}
 
-	defer func() {
-		if err := machineSensorIDQuery.Close(); err != nil {
-			klog.Errorf("cannot close query object: %s\n", err)
-		}
-	}()
-
-	var machineSensorID int64
-	if machineSensorIDQuery.Next() {
-		if err := machineSensorIDQuery.Scan(&machineSensorID); err != nil {
-			return err
-		}
-	} else {
-		res, err := db.Query("INSERT INTO machine_sensor (machine, sensor) VALUES ($1, $2) RETURNING id", machine, sensor)
-		if err != nil {
-			return err
-		}
-
-		defer func() {
-			if err := res.Close(); err != nil {
-				klog.Errorf("cannot close query object %s\n", err)
-			}
-		}()
-
-		if !res.Next() {
-			return fmt.Errorf("the id will not returned")
-		}
-
-		if err := res.Scan(&machineSensorID); err != nil {
-			return err
-		}
-
-		if err != nil {
-			return err
-		}
-	}
-
 	req, err := db.Query("SELECT * from contract WHERE contract = $1", contract)
 	if err != nil {
 		return err
 	}
+	exists := req.Next()
+	if err := req.Close(); err != nil {
+		return err
+	}
 
-	defer func() {
-		if err := req.Close(); err != nil {
-			klog.Errorf("canot close query object: %s", err)
-		}
-	}()
-
-	if !req.Next() {
-		if _, err := db.Exec("INSERT INTO contract (contract, duration, version) VALUES ($1, $2, $3)", contract, duration, version); err != nil {
+	if !exists {
+		if _, err := db.Exec("INSERT INTO contract (contract, duration, version) VALUES ($1, $2, $3)", contract, seconds(duration), version); err != nil {
 			return fmt.Errorf("in contract insertion error: %s is occured", err)
 		}
+	} else {
+		if _, err := db.Exec("UPDATE contract SET duration = $2, version = $3 WHERE contract = $1", contract, seconds(duration), version); err != nil {
+			return fmt.Errorf("in contract update error: %s is occured", err)
+		}
 	}
 
-	_, err = db.Exec("INSERT INTO contract_machine_sensor (contract, machine_sensor) VALUES ($1, $2)", contract, machineSensorID)
+	_, err = db.Exec("INSERT INTO contract_machine_sensor (contract, machine_sensor) SELECT $1, $2 WHERE NOT EXISTS (SELECT 1 FROM contract_machine_sensor WHERE contract = $1 AND machine_sensor = $2)", contract, machineSensorID)
+
+	return err
+}
 
+// RemoveContractSensor removes a machine sensor combination from a contract
+func RemoveContractSensor(db Executor, contract, machine, sensor string) error {
+	_, err := db.Exec("DELETE FROM contract_machine_sensor WHERE contract = $1 AND machine_sensor IN (SELECT id FROM machine_sensor WHERE machine = $2 AND sensor = $3)", contract, machine, sensor)
 	return err
 }
 
@@ -129,17 +118,20 @@ func MinDuration(db *sql.DB, machine, sensor, version string) (time.Duration, er
 		return time.Minute, err
 	}
 
-	var duration time.Duration
-	var daString string
+	defer func() {
+		if err := data.Close(); err != nil {
+			klog.Errorf("cannot close query object: %s\n", err)
+		}
+	}()
 
 	if !data.Next() {
 		return time.Minute, fmt.Errorf("no entry in the database found for this machine, sensor, version combination")
 	}
 
-	if err := data.Scan(&daString); err != nil {
+	var duration int64
+	if err := data.Scan(&duration); err != nil {
 		return time.Minute, err
 	}
 
-	duration, err = time.ParseDuration(daString)
-	return duration, err
+	return time.Duration(duration) * time.Second, nil
 }
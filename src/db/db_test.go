@@ -83,13 +83,13 @@ func TestInsertMachineSensorExists(t *testing.T) {
 		WithArgs("contract").
 		WillReturnRows(dbMock.NewRows([]string{"contract"}))
 	mock.ExpectExec("INSERT INTO contract (contract, duration, version) VALUES ($1, $2, $3)").
-		WithArgs("contract", "duration", "version").
+		WithArgs("contract", int64(60), "version").
 		WillReturnResult(dbMock.NewResult(0, 0))
-	mock.ExpectExec("INSERT INTO contract_machine_sensor (contract, machine_sensor) VALUES ($1, $2)").
+	mock.ExpectExec("INSERT INTO contract_machine_sensor (contract, machine_sensor) SELECT $1, $2 WHERE NOT EXISTS (SELECT 1 FROM contract_machine_sensor WHERE contract = $1 AND machine_sensor = $2)").
 		WithArgs("contract", 4).
 		WillReturnResult(dbMock.NewResult(1, 1))
 
-	if err := Insert(db, "machine", "sensor", "duration", "version", "contract"); err != nil {
+	if err := Insert(db, "machine", "sensor", time.Minute, "version", "contract"); err != nil {
 		t.Errorf("cannot insert into database %s", err)
 	}
 
@@ -116,13 +116,13 @@ func TestInsertMachineSensorNotExists(t *testing.T) {
 		WithArgs("contract").
 		WillReturnRows(dbMock.NewRows([]string{"contract"}))
 	mock.ExpectExec("INSERT INTO contract (contract, duration, version) VALUES ($1, $2, $3)").
-		WithArgs("contract", "duration", "version").
+		WithArgs("contract", int64(60), "version").
 		WillReturnResult(dbMock.NewResult(0, 0))
-	mock.ExpectExec("INSERT INTO contract_machine_sensor (contract, machine_sensor) VALUES ($1, $2)").
+	mock.ExpectExec("INSERT INTO contract_machine_sensor (contract, machine_sensor) SELECT $1, $2 WHERE NOT EXISTS (SELECT 1 FROM contract_machine_sensor WHERE contract = $1 AND machine_sensor = $2)").
 		WithArgs("contract", 4).
 		WillReturnResult(dbMock.NewResult(1, 1))
 
-	if err := Insert(db, "machine", "sensor", "duration", "version", "contract"); err != nil {
+	if err := Insert(db, "machine", "sensor", time.Minute, "version", "contract"); err != nil {
 		t.Errorf("cannot insert into database %s", err)
 	}
 
@@ -131,6 +131,57 @@ func TestInsertMachineSensorNotExists(t *testing.T) {
 	}
 }
 
+func TestInsertContractExists(t *testing.T) {
+	db, mock, err := dbMock.New(dbMock.QueryMatcherOption(dbMock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("cannot open database mock: %s", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT id FROM machine_sensor WHERE machine = $1 AND sensor = $2").
+		WithArgs("machine", "sensor").
+		WillReturnRows(dbMock.NewRows([]string{"id"}).AddRow(4))
+	mock.ExpectQuery("SELECT * from contract WHERE contract = $1").
+		WithArgs("contract").
+		WillReturnRows(dbMock.NewRows([]string{"contract"}).AddRow("contract"))
+	mock.ExpectExec("UPDATE contract SET duration = $2, version = $3 WHERE contract = $1").
+		WithArgs("contract", int64(60), "version").
+		WillReturnResult(dbMock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO contract_machine_sensor (contract, machine_sensor) SELECT $1, $2 WHERE NOT EXISTS (SELECT 1 FROM contract_machine_sensor WHERE contract = $1 AND machine_sensor = $2)").
+		WithArgs("contract", 4).
+		WillReturnResult(dbMock.NewResult(0, 0))
+
+	if err := Insert(db, "machine", "sensor", time.Minute, "version", "contract"); err != nil {
+		t.Errorf("cannot insert into database %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("not all expectaions were met: %s\n", err)
+	}
+}
+
+func TestRemoveContractSensor(t *testing.T) {
+	db, mock, err := dbMock.New(dbMock.QueryMatcherOption(dbMock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("cannot open database mock: %s", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectExec("DELETE FROM contract_machine_sensor WHERE contract = $1 AND machine_sensor IN (SELECT id FROM machine_sensor WHERE machine = $2 AND sensor = $3)").
+		WithArgs("contract", "machine", "sensor").
+		WillReturnResult(dbMock.NewResult(0, 1))
+
+	if err := RemoveContractSensor(db, "contract", "machine", "sensor"); err != nil {
+		t.Errorf("cannot remove sensor of contract: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("not all expectaions were met: %s\n", err)
+	}
+}
+
 func TestContractRemove(t *testing.T) {
 	db, mock, err := dbMock.New()
 	if err != nil {
@@ -260,8 +311,8 @@ func TestQueryIntervalNotParseDuration(t *testing.T) {
 		WillReturnRows(dbMock.NewRows([]string{"inverval"}).AddRow("nein"))
 
 	_, err = MinDuration(db, "machine", "sensor", "version")
-	if err.Error() != "time: invalid duration \"nein\"" {
-		t.Errorf("returned error doesn't match the expected error\n\t%s != %s", err, "time: invalid duration \"nein\"")
+	if err == nil {
+		t.Errorf("duration, which is not stored in seconds, has been parsed")
 	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -279,7 +330,7 @@ func TestQueryInterval(t *testing.T) {
 
 	mock.ExpectQuery("SELECT duration FROM contract JOIN contract_machine_sensor ON contract_machine_sensor.contract = contract.contract JOIN machine_sensor ON machine_sensor.id = contract_machine_sensor.machine_sensor WHERE machine = $1 AND sensor = $2 AND version = $3 ORDER BY duration ASC LIMIT 1").
 		WithArgs("machine", "sensor", "version").
-		WillReturnRows(dbMock.NewRows([]string{"inverval"}).AddRow("5m"))
+		WillReturnRows(dbMock.NewRows([]string{"inverval"}).AddRow(300))
 
 	duration, err := MinDuration(db, "machine", "sensor", "version")
 	if err != nil {
@@ -295,3 +346,33 @@ func TestQueryInterval(t *testing.T) {
 		t.Errorf("not all expectaions were met: %s\n", err)
 	}
 }
+
+func TestGetMachineSensorFromContract(t *testing.T) {
+	db, mock, err := dbMock.New(dbMock.QueryMatcherOption(dbMock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("cannot create mocked db")
+	}
+
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT machine, sensor FROM machine_sensor JOIN contract_machine_sensor ON machine_sensor = id WHERE contract = $1").
+		WithArgs("contract").
+		WillReturnRows(dbMock.NewRows([]string{"machine", "sensor"}).AddRow("machine", "sensor").AddRow("machine", "sensor1"))
+
+	data, err := GetMachineSensorFromContract(db, "contract")
+	if err != nil {
+		t.Errorf("unexpected returned error %s", err)
+	}
+
+	if len(data) != 2 {
+		t.Fatalf("unexpected length of the result: %d", len(data))
+	}
+
+	if data[1].Machine != "machine" || data[1].Sensor != "sensor1" {
+		t.Errorf("unexpected result: %v", data[1])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("not all expectaions were met: %s\n", err)
+	}
+}
@@ -0,0 +1,25 @@
+package db
+
+import (
+	"database/sql"
+)
+
+// SetContractDefinition stores the contract message, which defines a contract
+func SetContractDefinition(db Executor, contract string, definition []byte) error {
+	_, err := db.Exec("UPDATE contract SET definition = $2 WHERE contract = $1", contract, string(definition))
+	return err
+}
+
+// ContractDefinition returns the contract message, which defines a contract; nil is
+// returned, if the definition has not been stored
+func ContractDefinition(db *sql.DB, contract string) ([]byte, error) {
+	var definition sql.NullString
+	err := db.QueryRow("SELECT definition FROM contract WHERE contract = $1", contract).Scan(&definition)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil || !definition.Valid {
+		return nil, err
+	}
+	return []byte(definition.String), nil
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"testing"
+
+	dbMock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSetContractDefinition(t *testing.T) {
+	db, mock, err := dbMock.New(dbMock.QueryMatcherOption(dbMock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("cannot open database mock: %s", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE contract SET definition = $2 WHERE contract = $1").
+		WithArgs("contract", `{"body":{}}`).
+		WillReturnResult(dbMock.NewResult(0, 1))
+
+	if err := SetContractDefinition(db, "contract", []byte(`{"body":{}}`)); err != nil {
+		t.Errorf("cannot set definition: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("not all expectaions were met: %s\n", err)
+	}
+}
+
+func TestContractDefinition(t *testing.T) {
+	testTable := []struct {
+		description string
+		rows        *dbMock.Rows
+		expected    string
+	}{
+		{
+			description: "stored definition",
+			rows:        dbMock.NewRows([]string{"definition"}).AddRow(`{"body":{}}`),
+			expected:    `{"body":{}}`,
+		},
+		{
+			description: "contract without definition",
+			rows:        dbMock.NewRows([]string{"definition"}).AddRow(nil),
+		},
+		{
+			description: "unknown contract",
+			rows:        dbMock.NewRows([]string{"definition"}),
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			db, mock, err := dbMock.New(dbMock.QueryMatcherOption(dbMock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("cannot open database mock: %s", err)
+			}
+
+			defer db.Close()
+
+			mock.ExpectQuery("SELECT definition FROM contract WHERE contract = $1").
+				WithArgs("contract").
+				WillReturnRows(test.rows)
+
+			definition, err := ContractDefinition(db, "contract")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if string(definition) != test.expected {
+				t.Errorf("unexpected definition: %s != %s", definition, test.expected)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("not all expectaions were met: %s\n", err)
+			}
+		})
+	}
+}
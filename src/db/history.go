@@ -0,0 +1,8 @@
+package db
+
+// AddContractHistory stores a version of a contract with the changes to the previous
+// version and the contract message, which defines the version
+func AddContractHistory(db Executor, contract, version, changes string, definition []byte) error {
+	_, err := db.Exec("INSERT INTO contract_history (contract, version, changes, definition) VALUES ($1, $2, $3, $4)", contract, version, changes, string(definition))
+	return err
+}
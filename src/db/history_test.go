@@ -0,0 +1,28 @@
+package db
+
+import (
+	"testing"
+
+	dbMock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestAddContractHistory(t *testing.T) {
+	db, mock, err := dbMock.New(dbMock.QueryMatcherOption(dbMock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("cannot open database mock: %s", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectExec("INSERT INTO contract_history (contract, version, changes, definition) VALUES ($1, $2, $3, $4)").
+		WithArgs("contract", "2", "added sensors machine/sensor", `{"body":{}}`).
+		WillReturnResult(dbMock.NewResult(1, 1))
+
+	if err := AddContractHistory(db, "contract", "2", "added sensors machine/sensor", []byte(`{"body":{}}`)); err != nil {
+		t.Errorf("cannot add contract history: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("not all expectaions were met: %s\n", err)
+	}
+}
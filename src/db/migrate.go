@@ -0,0 +1,89 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+
+	"k8s.io/klog"
+)
+
+// migrationLock is the key of the postgres advisory lock, which serialises the migrations of
+// connectors sharing a database
+const migrationLock = 4242
+
+// Migration is a versioned change of the schema of the edge database
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(tx *sql.Tx) error
+}
+
+// statements returns the migration function, which executes the sql statements in order
+func statements(stmts ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Migrate applies the migrations, which have not been applied to the database, in the order
+// of their versions and returns the applied versions. Every migration is applied in its own
+// transaction together with its entry in the table schema_migrations.
+func Migrate(db *sql.DB, migrations []Migration) ([]int, error) {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER NOT NULL, description TEXT NOT NULL, applied TIMESTAMPTZ NOT NULL DEFAULT now(), CONSTRAINT schema_migrations_pk PRIMARY KEY ("version"))`); err != nil {
+		return nil, fmt.Errorf("cannot create migration table: %s", err)
+	}
+
+	var applied []int
+	for _, m := range migrations {
+		ok, err := migrate(db, m)
+		if err != nil {
+			return applied, fmt.Errorf("cannot apply migration %d (%s): %s", m.Version, m.Description, err)
+		}
+
+		if ok {
+			klog.Infof("applied migration %d: %s", m.Version, m.Description)
+			applied = append(applied, m.Version)
+		}
+	}
+	return applied, nil
+}
+
+// migrate applies a migration, if it has not been applied; true is returned, if the
+// migration has been applied
+func migrate(db *sql.DB, m Migration) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	defer func() {
+		// the rollback fails after a successful commit
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", migrationLock); err != nil {
+		return false, err
+	}
+
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)", m.Version).Scan(&exists); err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+
+	if err := m.Up(tx); err != nil {
+		return false, err
+	}
+
+	if _, err := tx.Exec("INSERT INTO schema_migrations (version, description) VALUES ($1, $2)", m.Version, m.Description); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
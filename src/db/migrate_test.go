@@ -0,0 +1,117 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	dbMock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestMigrate(t *testing.T) {
+	migrations := []Migration{
+		{Version: 1, Description: "first", Up: statements("CREATE TABLE first (id TEXT)")},
+		{Version: 2, Description: "second", Up: statements("CREATE TABLE second (id TEXT)")},
+	}
+
+	testTable := []struct {
+		description string
+		existing    map[int]bool
+		failing     int
+		expected    []int
+		expectErr   bool
+	}{
+		{
+			description: "empty database",
+			expected:    []int{1, 2},
+		},
+		{
+			description: "partially migrated database",
+			existing:    map[int]bool{1: true},
+			expected:    []int{2},
+		},
+		{
+			description: "migrated database",
+			existing:    map[int]bool{1: true, 2: true},
+		},
+		{
+			description: "failing migration",
+			failing:     2,
+			expected:    []int{1},
+			expectErr:   true,
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			db, mock, err := dbMock.New(dbMock.QueryMatcherOption(dbMock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("cannot open database mock: %s", err)
+			}
+
+			defer db.Close()
+
+			mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER NOT NULL, description TEXT NOT NULL, applied TIMESTAMPTZ NOT NULL DEFAULT now(), CONSTRAINT schema_migrations_pk PRIMARY KEY ("version"))`).
+				WillReturnResult(dbMock.NewResult(0, 0))
+
+			for _, m := range migrations {
+				mock.ExpectBegin()
+				mock.ExpectExec("SELECT pg_advisory_xact_lock($1)").WithArgs(migrationLock).WillReturnResult(dbMock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)").
+					WithArgs(m.Version).
+					WillReturnRows(dbMock.NewRows([]string{"exists"}).AddRow(test.existing[m.Version]))
+
+				if test.existing[m.Version] {
+					mock.ExpectRollback()
+					continue
+				}
+
+				stmt := mock.ExpectExec(fmt.Sprintf("CREATE TABLE %s (id TEXT)", m.Description))
+				if test.failing == m.Version {
+					stmt.WillReturnError(fmt.Errorf("syntax error"))
+					mock.ExpectRollback()
+					break
+				}
+				stmt.WillReturnResult(dbMock.NewResult(0, 0))
+
+				mock.ExpectExec("INSERT INTO schema_migrations (version, description) VALUES ($1, $2)").
+					WithArgs(m.Version, m.Description).
+					WillReturnResult(dbMock.NewResult(0, 1))
+				mock.ExpectCommit()
+			}
+
+			applied, err := Migrate(db, migrations)
+			if (err != nil) != test.expectErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(applied, test.expected) {
+				t.Errorf("unexpected applied migrations: %v != %v", applied, test.expected)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestSeconds(t *testing.T) {
+	testTable := []struct {
+		duration time.Duration
+		expected int64
+	}{
+		{duration: 5 * time.Minute, expected: 300},
+		{duration: 1500 * time.Millisecond, expected: 2},
+		{duration: 0, expected: 0},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.duration.String(), func(t *testing.T) {
+			if s := seconds(test.duration); s != test.expected {
+				t.Errorf("unexpected seconds: %d != %d", s, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Migrations are the migrations of the edge database ordered by their versions. A
+// migration must not be changed after it has been released; changes of the schema are
+// added as new migration. The first migrations create the schema idempotent, so that they
+// can be applied to databases, which have been created by a previous version.
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Description: "create contracts and machine sensors",
+		Up: statements(
+			`CREATE TABLE IF NOT EXISTS contract (
+				contract TEXT NOT NULL,
+				duration TEXT NOT NULL,
+				version TEXT NOT NULL,
+				CONSTRAINT contract_pk PRIMARY KEY ("contract")
+			)`,
+			`CREATE TABLE IF NOT EXISTS machine_sensor (
+				id BIGSERIAL,
+				machine TEXT NOT NULL,
+				sensor TEXT NOT NULL,
+				CONSTRAINT machie_sensor_pk PRIMARY KEY ("id"),
+				CONSTRAINT uniqueness UNIQUE("machine", "sensor")
+			)`,
+			`CREATE TABLE IF NOT EXISTS contract_machine_sensor (
+				contract TEXT NOT NULL,
+				machine_sensor BIGINT NOT NULL,
+				CONSTRAINT contract_machine_sensor_contract_fk FOREIGN KEY ("contract") REFERENCES contract(contract) ON DELETE CASCADE,
+				CONSTRAINT contract_machine_sensor_machine_sensor_fk FOREIGN KEY ("machine_sensor") REFERENCES machine_sensor(id)
+			)`,
+		),
+	},
+	{
+		Version:     2,
+		Description: "store validity, signature requirement, definition and parent of contracts",
+		Up: statements(
+			`ALTER TABLE contract
+				ADD COLUMN IF NOT EXISTS valid_start TIMESTAMPTZ,
+				ADD COLUMN IF NOT EXISTS valid_end TIMESTAMPTZ,
+				ADD COLUMN IF NOT EXISTS check_signatures BOOLEAN NOT NULL DEFAULT false,
+				ADD COLUMN IF NOT EXISTS definition TEXT,
+				ADD COLUMN IF NOT EXISTS parent TEXT`,
+		),
+	},
+	{
+		Version:     3,
+		Description: "store the last analysis result of every target",
+		Up: statements(
+			`CREATE TABLE IF NOT EXISTS analysis_result (
+				contract TEXT NOT NULL,
+				last_result BIGINT NOT NULL,
+				CONSTRAINT analysis_result_contract_fk FOREIGN KEY ("contract") REFERENCES contract(contract) ON DELETE CASCADE
+			)`,
+			`ALTER TABLE analysis_result ADD COLUMN IF NOT EXISTS target TEXT NOT NULL DEFAULT 'cloud'`,
+			`ALTER TABLE analysis_result DROP CONSTRAINT IF EXISTS analysis_result_pk`,
+			`ALTER TABLE analysis_result ADD CONSTRAINT analysis_result_pk PRIMARY KEY ("contract", "target")`,
+		),
+	},
+	{
+		Version:     4,
+		Description: "create contract history and upload audit",
+		Up: statements(
+			`CREATE TABLE IF NOT EXISTS contract_history (
+				id BIGSERIAL,
+				contract TEXT NOT NULL,
+				version TEXT NOT NULL,
+				changes TEXT NOT NULL,
+				definition TEXT,
+				changed TIMESTAMPTZ NOT NULL DEFAULT now(),
+				CONSTRAINT contract_history_pk PRIMARY KEY ("id")
+			)`,
+			`CREATE TABLE IF NOT EXISTS upload_audit (
+				id BIGSERIAL,
+				contract TEXT NOT NULL,
+				target TEXT NOT NULL,
+				machine TEXT NOT NULL,
+				sensor TEXT NOT NULL,
+				recipients TEXT NOT NULL,
+				updates INTEGER NOT NULL,
+				bytes BIGINT NOT NULL,
+				queued BOOLEAN NOT NULL DEFAULT false,
+				forwarded TIMESTAMPTZ NOT NULL DEFAULT now(),
+				CONSTRAINT upload_audit_pk PRIMARY KEY ("id")
+			)`,
+		),
+	},
+	{
+		// the outbox has been created by gorm before, so the tables and columns follow
+		// the naming of gorm
+		Version:     5,
+		Description: "create outbox and dead letter table",
+		Up: statements(
+			`CREATE TABLE IF NOT EXISTS messages (
+				method TEXT,
+				address TEXT,
+				message BYTEA
+			)`,
+			`ALTER TABLE messages
+				ADD COLUMN IF NOT EXISTS id SERIAL PRIMARY KEY,
+				ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ,
+				ADD COLUMN IF NOT EXISTS idempotency_key TEXT,
+				ADD COLUMN IF NOT EXISTS queue TEXT,
+				ADD COLUMN IF NOT EXISTS target TEXT,
+				ADD COLUMN IF NOT EXISTS attempts INTEGER,
+				ADD COLUMN IF NOT EXISTS next_attempt TIMESTAMPTZ,
+				ADD COLUMN IF NOT EXISTS expires TIMESTAMPTZ`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS uix_messages_idempotency_key ON messages (idempotency_key)`,
+			`CREATE INDEX IF NOT EXISTS idx_messages_queue ON messages (queue)`,
+			`CREATE INDEX IF NOT EXISTS idx_messages_target ON messages (target)`,
+			// the messages, which have been stored before the outbox has been separated
+			// by analysis targets, belong to the default target
+			`UPDATE messages SET target = 'cloud' WHERE target IS NULL`,
+			`CREATE TABLE IF NOT EXISTS dead_messages (
+				id SERIAL PRIMARY KEY,
+				created_at TIMESTAMPTZ,
+				idempotency_key TEXT,
+				method TEXT,
+				address TEXT,
+				message BYTEA,
+				queue TEXT,
+				attempts INTEGER,
+				reason TEXT,
+				failed TIMESTAMPTZ
+			)`,
+			`ALTER TABLE dead_messages
+				ADD COLUMN IF NOT EXISTS target TEXT,
+				ADD COLUMN IF NOT EXISTS expires TIMESTAMPTZ`,
+		),
+	},
+	{
+		Version:     6,
+		Description: "store durations of contracts in seconds",
+		Up:          durationSeconds,
+	},
+}
+
+// durationSeconds converts the durations of the contracts, which have been stored as text,
+// into seconds, so that the minimal duration can be calculated by the database
+func durationSeconds(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT contract, duration FROM contract")
+	if err != nil {
+		return err
+	}
+
+	durations := make(map[string]int64)
+	for rows.Next() {
+		var contract, duration string
+		if err := rows.Scan(&contract, &duration); err != nil {
+			_ = rows.Close()
+			return err
+		}
+
+		d, err := time.ParseDuration(duration)
+		if err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("cannot parse duration %s of contract %s: %s", duration, contract, err)
+		}
+		durations[contract] = seconds(d)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("ALTER TABLE contract ADD COLUMN duration_seconds BIGINT"); err != nil {
+		return err
+	}
+
+	for contract, duration := range durations {
+		if _, err := tx.Exec("UPDATE contract SET duration_seconds = $2 WHERE contract = $1", contract, duration); err != nil {
+			return err
+		}
+	}
+
+	return statements(
+		"ALTER TABLE contract DROP COLUMN duration",
+		"ALTER TABLE contract RENAME COLUMN duration_seconds TO duration",
+		"ALTER TABLE contract ALTER COLUMN duration SET NOT NULL",
+	)(tx)
+}
+
+// seconds returns the duration in whole seconds; parts of a second are rounded up, so that
+// a positive duration is stored as positive number
+func seconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
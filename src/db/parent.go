@@ -0,0 +1,31 @@
+package db
+
+import (
+	"database/sql"
+)
+
+// SetContractParent stores the parent contract of a contract; an empty parent removes the
+// parent of the contract
+func SetContractParent(db Executor, contract, parent string) error {
+	_, err := db.Exec("UPDATE contract SET parent = $2 WHERE contract = $1", contract, sql.NullString{String: parent, Valid: parent != ""})
+	return err
+}
+
+// ContractChildren returns the contracts, which inherit from the parent contract
+func ContractChildren(db *sql.DB, parent string) ([]string, error) {
+	rows, err := db.Query("SELECT contract FROM contract WHERE parent = $1 ORDER BY contract", parent)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var children []string
+	for rows.Next() {
+		var child string
+		if err := rows.Scan(&child); err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+	return children, rows.Err()
+}
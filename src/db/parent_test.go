@@ -0,0 +1,75 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+
+	dbMock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSetContractParent(t *testing.T) {
+	testTable := []struct {
+		description string
+		parent      string
+		expected    sql.NullString
+	}{
+		{
+			description: "child contract",
+			parent:      "parent",
+			expected:    sql.NullString{String: "parent", Valid: true},
+		},
+		{
+			description: "contract without parent",
+			expected:    sql.NullString{},
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			db, mock, err := dbMock.New(dbMock.QueryMatcherOption(dbMock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("cannot open database mock: %s", err)
+			}
+
+			defer db.Close()
+
+			mock.ExpectExec("UPDATE contract SET parent = $2 WHERE contract = $1").
+				WithArgs("contract", test.expected).
+				WillReturnResult(dbMock.NewResult(0, 1))
+
+			if err := SetContractParent(db, "contract", test.parent); err != nil {
+				t.Errorf("cannot set parent: %s", err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("not all expectaions were met: %s\n", err)
+			}
+		})
+	}
+}
+
+func TestContractChildren(t *testing.T) {
+	db, mock, err := dbMock.New(dbMock.QueryMatcherOption(dbMock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("cannot open database mock: %s", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT contract FROM contract WHERE parent = $1 ORDER BY contract").
+		WithArgs("parent").
+		WillReturnRows(dbMock.NewRows([]string{"contract"}).AddRow("child1").AddRow("child2"))
+
+	children, err := ContractChildren(db, "parent")
+	if err != nil {
+		t.Fatalf("cannot query children: %s", err)
+	}
+
+	if len(children) != 2 || children[0] != "child1" || children[1] != "child2" {
+		t.Errorf("unexpected children: %v", children)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("not all expectaions were met: %s\n", err)
+	}
+}
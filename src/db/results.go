@@ -0,0 +1,23 @@
+package db
+
+import (
+	"database/sql"
+)
+
+// LastResult returns the id of the last published analysis result of a contract on an
+// analysis target; 0 is returned, if no result has been published
+func LastResult(db *sql.DB, contract, target string) (int, error) {
+	var id int
+	err := db.QueryRow("SELECT last_result FROM analysis_result WHERE contract = $1 AND target = $2", contract, target).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// SetLastResult stores the id of the last published analysis result of a contract on an
+// analysis target
+func SetLastResult(db *sql.DB, contract, target string, id int) error {
+	_, err := db.Exec("INSERT INTO analysis_result (contract, target, last_result) VALUES ($1, $2, $3) ON CONFLICT (contract, target) DO UPDATE SET last_result = $3", contract, target, id)
+	return err
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"testing"
+
+	dbMock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestLastResult(t *testing.T) {
+	testTable := []struct {
+		description string
+		rows        *dbMock.Rows
+		expected    int
+	}{
+		{
+			description: "results have been published",
+			rows:        dbMock.NewRows([]string{"last_result"}).AddRow(42),
+			expected:    42,
+		},
+		{
+			description: "no result has been published",
+			rows:        dbMock.NewRows([]string{"last_result"}),
+			expected:    0,
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			db, mock, err := dbMock.New(dbMock.QueryMatcherOption(dbMock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("cannot open database mock: %s", err)
+			}
+
+			defer db.Close()
+
+			mock.ExpectQuery("SELECT last_result FROM analysis_result WHERE contract = $1 AND target = $2").
+				WithArgs("contract", "cloud").
+				WillReturnRows(test.rows)
+
+			id, err := LastResult(db, "contract", "cloud")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if id != test.expected {
+				t.Errorf("unexpected last result: %d != %d", id, test.expected)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("not all expectaions were met: %s\n", err)
+			}
+		})
+	}
+}
+
+func TestSetLastResult(t *testing.T) {
+	db, mock, err := dbMock.New(dbMock.QueryMatcherOption(dbMock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("cannot open database mock: %s", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectExec("INSERT INTO analysis_result (contract, target, last_result) VALUES ($1, $2, $3) ON CONFLICT (contract, target) DO UPDATE SET last_result = $3").
+		WithArgs("contract", "cloud", 42).
+		WillReturnResult(dbMock.NewResult(0, 1))
+
+	if err := SetLastResult(db, "contract", "cloud", 42); err != nil {
+		t.Errorf("cannot set last result: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("not all expectaions were met: %s\n", err)
+	}
+}
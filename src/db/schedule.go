@@ -0,0 +1,56 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// ContractSchedule contains the validity window of a contract; a zero time is unbounded
+type ContractSchedule struct {
+	Contract string
+	Start    time.Time
+	End      time.Time
+}
+
+// nullTime converts a zero time into a database NULL value
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// SetContractValidity stores the validity window of a contract
+func SetContractValidity(db Executor, contract string, start, end time.Time) error {
+	_, err := db.Exec("UPDATE contract SET valid_start = $2, valid_end = $3 WHERE contract = $1", contract, nullTime(start), nullTime(end))
+	return err
+}
+
+// GetContractSchedules returns the validity windows of all contracts with a defined version
+func GetContractSchedules(db *sql.DB, version string) ([]ContractSchedule, error) {
+	res, err := db.Query("SELECT contract, valid_start, valid_end FROM contract WHERE version = $1", version)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := res.Close(); err != nil {
+			klog.Errorf("cannot close query object: %s\n", err)
+		}
+	}()
+
+	var schedules []ContractSchedule
+	for res.Next() {
+		var (
+			contract   string
+			start, end sql.NullTime
+		)
+
+		if err := res.Scan(&contract, &start, &end); err != nil {
+			return nil, err
+		}
+
+		schedules = append(schedules, ContractSchedule{Contract: contract, Start: start.Time, End: end.Time})
+	}
+
+	return schedules, nil
+}
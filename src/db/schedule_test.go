@@ -0,0 +1,67 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	dbMock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSetContractValidity(t *testing.T) {
+	db, mock, err := dbMock.New(dbMock.QueryMatcherOption(dbMock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("cannot open database mock: %s", err)
+	}
+
+	defer db.Close()
+
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectExec("UPDATE contract SET valid_start = $2, valid_end = $3 WHERE contract = $1").
+		WithArgs("contract", start, nil).
+		WillReturnResult(dbMock.NewResult(0, 1))
+
+	if err := SetContractValidity(db, "contract", start, time.Time{}); err != nil {
+		t.Errorf("cannot set validity: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("not all expectaions were met: %s\n", err)
+	}
+}
+
+func TestGetContractSchedules(t *testing.T) {
+	db, mock, err := dbMock.New(dbMock.QueryMatcherOption(dbMock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("cannot open database mock: %s", err)
+	}
+
+	defer db.Close()
+
+	end := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT contract, valid_start, valid_end FROM contract WHERE version = $1").
+		WithArgs("version").
+		WillReturnRows(dbMock.NewRows([]string{"contract", "valid_start", "valid_end"}).
+			AddRow("contract1", nil, end).
+			AddRow("contract2", nil, nil))
+
+	schedules, err := GetContractSchedules(db, "version")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(schedules) != 2 {
+		t.Fatalf("unexpected length of the result: %d", len(schedules))
+	}
+
+	if !schedules[0].Start.IsZero() || !schedules[0].End.Equal(end) {
+		t.Errorf("unexpected schedule: %v", schedules[0])
+	}
+
+	if !schedules[1].Start.IsZero() || !schedules[1].End.IsZero() {
+		t.Errorf("unexpected schedule: %v", schedules[1])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("not all expectaions were met: %s\n", err)
+	}
+}
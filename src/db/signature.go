@@ -0,0 +1,21 @@
+package db
+
+import (
+	"database/sql"
+)
+
+// SetContractCheckSignatures stores if a contract requires signed sensor updates
+func SetContractCheckSignatures(db Executor, contract string, check bool) error {
+	_, err := db.Exec("UPDATE contract SET check_signatures = $2 WHERE contract = $1", contract, check)
+	return err
+}
+
+// ContractCheckSignatures returns true, if a contract requires signed sensor updates
+func ContractCheckSignatures(db *sql.DB, contract string) (bool, error) {
+	var check bool
+	err := db.QueryRow("SELECT check_signatures FROM contract WHERE contract = $1", contract).Scan(&check)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return check, err
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"testing"
+
+	dbMock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSetContractCheckSignatures(t *testing.T) {
+	db, mock, err := dbMock.New(dbMock.QueryMatcherOption(dbMock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("cannot open database mock: %s", err)
+	}
+
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE contract SET check_signatures = $2 WHERE contract = $1").
+		WithArgs("contract", true).
+		WillReturnResult(dbMock.NewResult(0, 1))
+
+	if err := SetContractCheckSignatures(db, "contract", true); err != nil {
+		t.Errorf("cannot set check signatures: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("not all expectaions were met: %s\n", err)
+	}
+}
+
+func TestContractCheckSignatures(t *testing.T) {
+	testTable := []struct {
+		description string
+		rows        *dbMock.Rows
+		expected    bool
+	}{
+		{
+			description: "signed sensor updates are required",
+			rows:        dbMock.NewRows([]string{"check_signatures"}).AddRow(true),
+			expected:    true,
+		},
+		{
+			description: "unknown contract",
+			rows:        dbMock.NewRows([]string{"check_signatures"}),
+			expected:    false,
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			db, mock, err := dbMock.New(dbMock.QueryMatcherOption(dbMock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("cannot open database mock: %s", err)
+			}
+
+			defer db.Close()
+
+			mock.ExpectQuery("SELECT check_signatures FROM contract WHERE contract = $1").
+				WithArgs("contract").
+				WillReturnRows(test.rows)
+
+			check, err := ContractCheckSignatures(db, "contract")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if check != test.expected {
+				t.Errorf("unexpected check signatures: %t != %t", check, test.expected)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("not all expectaions were met: %s\n", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+// Package lifecycle contains the logic to shut down the connector gracefully
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// Hook is executed during the shutdown; the context expires with the shutdown deadline
+type Hook func(ctx context.Context) error
+
+type hook struct {
+	name string
+	fn   Hook
+}
+
+// finalTimeout bounds the final hooks, which are executed after the other hooks even if
+// the shutdown deadline has been exceeded
+const finalTimeout = 5 * time.Second
+
+// Manager executes the registered hooks in the order of their registration, if the
+// process receives a termination signal
+type Manager struct {
+	timeout time.Duration
+	hooks   []hook
+	final   []hook
+}
+
+// NewManager create a new lifecycle manager; all hooks have to be finished within the
+// timeout
+func NewManager(timeout time.Duration) *Manager {
+	return &Manager{timeout: timeout}
+}
+
+// Register adds a hook, which is executed on shutdown
+func (m *Manager) Register(name string, fn Hook) {
+	m.hooks = append(m.hooks, hook{name: name, fn: fn})
+}
+
+// RegisterFinal adds a hook, which is executed after the other hooks; the final hooks are
+// executed even if the other hooks have exceeded the deadline
+func (m *Manager) RegisterFinal(name string, fn Hook) {
+	m.final = append(m.final, hook{name: name, fn: fn})
+}
+
+// Wait blocks until SIGINT or SIGTERM is received and shuts down afterwards
+func (m *Manager) Wait() error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+	signal.Stop(signals)
+
+	klog.Infof("received signal %s, shutting down", sig)
+	return m.Shutdown()
+}
+
+// Shutdown executes all hooks. An error is returned, if the hooks are not finished
+// within the timeout; the final hooks are executed nevertheless.
+func (m *Manager) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+	graceful := run(ctx, m.hooks)
+
+	finalCtx, finalCancel := context.WithTimeout(context.Background(), finalTimeout)
+	defer finalCancel()
+	final := run(finalCtx, m.final)
+
+	switch {
+	case !graceful:
+		return fmt.Errorf("shutdown deadline of %s exceeded", m.timeout)
+	case !final:
+		return fmt.Errorf("final shutdown steps exceeded %s", finalTimeout)
+	}
+	klog.Info("shutdown finished")
+	return nil
+}
+
+// run executes the hooks in order until the context is done; a hook, which does not return
+// before the context is done, is abandoned. It returns false, if the context is done.
+func run(ctx context.Context, hooks []hook) bool {
+	for _, h := range hooks {
+		if ctx.Err() != nil {
+			klog.Errorf("shutdown step %s is skipped: %s", h.name, ctx.Err())
+			continue
+		}
+
+		klog.Infof("shutdown: %s", h.name)
+		done := make(chan error, 1)
+		go func(h hook) {
+			done <- h.fn(ctx)
+		}(h)
+
+		select {
+		case err := <-done:
+			if err != nil {
+				klog.Errorf("shutdown step %s failed: %s", h.name, err)
+			}
+		case <-ctx.Done():
+			klog.Errorf("shutdown step %s is abandoned: %s", h.name, ctx.Err())
+		}
+	}
+	return ctx.Err() == nil
+}
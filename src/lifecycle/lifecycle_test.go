@@ -0,0 +1,69 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShutdownOrder(t *testing.T) {
+	var executed []string
+	m := NewManager(time.Second)
+	for _, name := range []string{"first", "second", "third"} {
+		name := name
+		m.Register(name, func(ctx context.Context) error {
+			executed = append(executed, name)
+			if name == "second" {
+				return fmt.Errorf("error")
+			}
+			return nil
+		})
+	}
+
+	if err := m.Shutdown(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if strings.Join(executed, ",") != "first,second,third" {
+		t.Errorf("unexpected execution order: %v", executed)
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	var executed bool
+	final := make(chan struct{})
+	m := NewManager(10 * time.Millisecond)
+	m.Register("blocking", func(ctx context.Context) error {
+		// the hook ignores the context
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	})
+	m.Register("skipped", func(ctx context.Context) error {
+		executed = true
+		return nil
+	})
+	m.RegisterFinal("final", func(ctx context.Context) error {
+		if ctx.Err() != nil {
+			t.Errorf("final hook is executed with an expired context")
+		}
+		close(final)
+		return nil
+	})
+
+	if err := m.Shutdown(); err == nil {
+		t.Errorf("expected deadline error")
+	}
+
+	select {
+	case <-final:
+	default:
+		t.Errorf("final hook is not executed after the deadline")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if executed {
+		t.Errorf("hook is executed after the deadline")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"database/sql"
 	"encoding/json"
@@ -8,8 +9,11 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/go-yaml/yaml"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
 	_ "github.com/lib/pq"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -21,8 +25,16 @@ import (
 	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/connection"
 	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/constants"
 	database "github.com/kosmos-industrie40/kosmos-analyse-connector/src/db"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/lifecycle"
 	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/mapper"
 	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/mqtt"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/reject"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/results"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/schema"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/secret"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/signature"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/target"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/tlsconfig"
 	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/uploader"
 )
 
@@ -31,6 +43,7 @@ var (
 		ConfigFile  string
 		Monitoring  string
 		WriteConfig bool
+		PrintConfig bool
 		ConfigDir   string
 	}
 	vi      *viper.Viper
@@ -50,12 +63,14 @@ func init() {
 	flag.StringVar(&cli.ConfigFile, "config", "exampleConfiguration.yaml", "is the name to the configuration file")
 	flag.StringVar(&cli.Monitoring, "address", ":8081", "The address to listen for the http requests of prometheus.")
 	flag.BoolVar(&cli.WriteConfig, "configDefault", false, "generates a default configuration and exit the program")
+	flag.BoolVar(&cli.PrintConfig, "print-config", false, "prints the effective configuration with masked secrets and exit the program")
 
 	flag.Parse()
 
 	vi = viper.New()
 	vi.AutomaticEnv()
 	vi.SetEnvPrefix("cc")
+	vi.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	vi.SetConfigFile(cli.ConfigFile)
 
 	// set default values in the configuration
@@ -66,25 +81,107 @@ func init() {
 	vi.SetDefault(constants.EdgeDatabasePort, 5432)
 	vi.SetDefault(constants.EdgeDatabaseUser, "kosmos")
 	vi.SetDefault(constants.EdgeDatabasePassword, "")
+	vi.SetDefault(constants.EdgeDatabasePasswordFile, "")
 	vi.SetDefault(constants.EdgeDatabaseDatabase, "edge")
+	vi.SetDefault(constants.EdgeDatabaseSSLMode, "disable")
+	vi.SetDefault(constants.EdgeDatabaseTLSCA, "")
+	vi.SetDefault(constants.EdgeDatabaseTLSCert, "")
+	vi.SetDefault(constants.EdgeDatabaseTLSKey, "")
 
 	// mqtt
 	vi.SetDefault(constants.EdgeMqttURL, "localhost")
 	vi.SetDefault(constants.EdgeMqttPort, 1883)
 	vi.SetDefault(constants.EdgeMqttUser, "")
 	vi.SetDefault(constants.EdgeMqttPassword, "")
+	vi.SetDefault(constants.EdgeMqttPasswordFile, "")
+	vi.SetDefault(constants.EdgeMqttTLSCA, "")
+	vi.SetDefault(constants.EdgeMqttTLSCert, "")
+	vi.SetDefault(constants.EdgeMqttTLSKey, "")
+	vi.SetDefault(constants.EdgeMqttTLSServerName, "")
+
+	// tls
+	vi.SetDefault(constants.EdgeTLSReloadInterval, "1m")
+
+	// secrets
+	vi.SetDefault(constants.EdgeSecretsReloadInterval, "1m")
+
+	// buffer
+	vi.SetDefault(constants.EdgeBufferType, "memory")
+	vi.SetDefault(constants.EdgeBufferPath, "buffer")
+	vi.SetDefault(constants.EdgeBufferOverflow, string(buffer.DropOldest))
+	vi.SetDefault(constants.EdgeBufferLimitsSensorCount, 0)
+	vi.SetDefault(constants.EdgeBufferLimitsSensorBytes, 0)
+	vi.SetDefault(constants.EdgeBufferLimitsGlobalCount, 0)
+	vi.SetDefault(constants.EdgeBufferLimitsGlobalBytes, 0)
+	vi.SetDefault(constants.EdgeBufferPurgeInterval, "1m")
+
+	// shutdown
+	vi.SetDefault(constants.EdgeShutdownTimeout, "30s")
+
+	// signature
+	vi.SetDefault(constants.EdgeSignatureEnabled, false)
+	vi.SetDefault(constants.EdgeSignatureTrustStore, "trust")
+	vi.SetDefault(constants.EdgeSignatureRejectionTopic, "kosmos/analyses-connector/rejected")
+	vi.SetDefault(constants.EdgeSignatureKey, "")
+
+	// schema
+	vi.SetDefault(constants.EdgeSchemaEnabled, true)
+	vi.SetDefault(constants.EdgeSchemaErrorTopic, "kosmos/analyses-connector/error")
+
+	// contracts
+	vi.SetDefault(constants.EdgeContractsParentDeletion, string(mapper.BlockChildren))
 
 	// analysis cloud
+	vi.SetDefault(constants.AnalysisCloudEnabled, true)
+	vi.SetDefault(constants.AnalysisCloudInterval, "1m")
+	vi.SetDefault(constants.AnalysisCloudAllowedHosts, []string{})
+
 	// connector
 	vi.SetDefault(constants.AnalysisCloudConnectorURL, "localhost")
 	vi.SetDefault(constants.AnalysisCloudConnectorPort, 80)
+	vi.SetDefault(constants.AnalysisCloudConnectorTimeout, "30s")
+	vi.SetDefault(constants.AnalysisCloudConnectorTLSCA, "")
+	vi.SetDefault(constants.AnalysisCloudConnectorTLSCert, "")
+	vi.SetDefault(constants.AnalysisCloudConnectorTLSKey, "")
+	vi.SetDefault(constants.AnalysisCloudConnectorTLSServerName, "")
+
+	// outbox
+	vi.SetDefault(constants.AnalysisCloudOutboxInterval, "1m")
+	vi.SetDefault(constants.AnalysisCloudOutboxMaxAttempts, 10)
+	vi.SetDefault(constants.AnalysisCloudOutboxBackoffBase, "10s")
+	vi.SetDefault(constants.AnalysisCloudOutboxBackoffMax, "1h")
+
+	// results
+	vi.SetDefault(constants.AnalysisCloudResultsInterval, "1m")
 
 	// userMgmt
 	vi.SetDefault(constants.AnalysisCloudUserMgmtSchema, "https")
 	vi.SetDefault(constants.AnalysisCloudUserMgmtPath, "auth")
 	vi.SetDefault(constants.AnalysisCloudUserMgmtPort, 443)
+	vi.SetDefault(constants.AnalysisCloudUserMgmtTimeout, "30s")
 	vi.SetDefault(constants.AnalysisCloudUserMgmtUser, "test user")
 	vi.SetDefault(constants.AnalysisCloudUserMgmtPassword, "")
+	vi.SetDefault(constants.AnalysisCloudUserMgmtPasswordFile, "")
+	vi.SetDefault(constants.AnalysisCloudUserMgmtProvider, "form")
+	vi.SetDefault(constants.AnalysisCloudUserMgmtTLSCA, "")
+	vi.SetDefault(constants.AnalysisCloudUserMgmtTLSCert, "")
+	vi.SetDefault(constants.AnalysisCloudUserMgmtTLSKey, "")
+	vi.SetDefault(constants.AnalysisCloudUserMgmtTLSServerName, "")
+	vi.SetDefault(constants.AnalysisCloudUserMgmtTokenPath, "protocol/openid-connect/token")
+	vi.SetDefault(constants.AnalysisCloudUserMgmtRevocationPath, "protocol/openid-connect/revoke")
+	vi.SetDefault(constants.AnalysisCloudUserMgmtLogoutPath, "protocol/openid-connect/logout")
+	vi.SetDefault(constants.AnalysisCloudUserMgmtClientID, "")
+	vi.SetDefault(constants.AnalysisCloudUserMgmtClientSecret, "")
+	vi.SetDefault(constants.AnalysisCloudUserMgmtClientSecretFile, "")
+	vi.SetDefault(constants.AnalysisCloudUserMgmtScope, "")
+	vi.SetDefault(constants.AnalysisCloudUserMgmtRefreshToken, "")
+	vi.SetDefault(constants.AnalysisCloudUserMgmtRefreshTokenFile, "")
+	vi.SetDefault(constants.AnalysisCloudUserMgmtToken, "")
+	vi.SetDefault(constants.AnalysisCloudUserMgmtTokenFile, "")
+	vi.SetDefault(constants.AnalysisCloudUserMgmtHeader, "Authorization")
+	vi.SetDefault(constants.AnalysisCloudUserMgmtRenewalFraction, 0.75)
+	vi.SetDefault(constants.AnalysisCloudUserMgmtRenewalBackoffBase, "5s")
+	vi.SetDefault(constants.AnalysisCloudUserMgmtRenewalBackoffMax, "5m")
 
 	// read in configuration
 	err := vi.ReadInConfig()
@@ -102,29 +199,314 @@ func init() {
 		fmt.Printf("The default config is written to: %s/%s\n", cli.ConfigDir, cli.ConfigFile)
 		os.Exit(0)
 	}
+
+	if err := secret.Resolve(vi, secrets()); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if cli.PrintConfig {
+		out, err := yaml.Marshal(secret.Redact(vi.AllSettings(), secrets()))
+		if err != nil {
+			klog.Errorf("cannot marshal configuration: %s", err)
+			os.Exit(1)
+		}
+		fmt.Print(string(out))
+		os.Exit(0)
+	}
+}
+
+// userMgmtSecrets are the config strings of the credentials at the user management
+var userMgmtSecrets = []string{
+	constants.AnalysisCloudUserMgmtPassword,
+	constants.AnalysisCloudUserMgmtClientSecret,
+	constants.AnalysisCloudUserMgmtRefreshToken,
+	constants.AnalysisCloudUserMgmtToken,
 }
 
-func sendStatus(mqtt mqtt.Mqtt) {
+// secrets returns the config strings of the secrets including the secrets of the named
+// analysis targets
+func secrets() []string {
+	keys := []string{constants.EdgeDatabasePassword, constants.EdgeMqttPassword}
+	for _, key := range userMgmtSecrets {
+		keys = append(keys, key)
+		for name := range vi.GetStringMap(constants.AnalysisTargets) {
+			keys = append(keys, constants.AnalysisTargets+"."+name+strings.TrimPrefix(key, constants.AnalysisCloud))
+		}
+	}
+	return keys
+}
+
+func sendStatus(mqtt mqtt.Mqtt, quit <-chan struct{}) {
 	for {
-		var stat status
-		stat.Body.From = "analysis"
-		stat.Body.Status = "alive"
-		time.Sleep(1 * time.Minute)
-		dat, err := json.Marshal(stat)
+		select {
+		case <-quit:
+			return
+		case <-time.After(1 * time.Minute):
+		}
+
+		publishStatus(mqtt, "alive")
+	}
+}
+
+func publishStatus(mqtt mqtt.Mqtt, value string) {
+	var stat status
+	stat.Body.From = "analysis"
+	stat.Body.Status = value
+	dat, err := json.Marshal(stat)
+	if err != nil {
+		klog.Errorf("cannot marshal status: %s", err)
+		return
+	}
+
+	if err := mqtt.Send("kosmos/status", dat); err != nil {
+		klog.Errorf("cannot publish status: %s", err)
+	}
+}
+
+// targetNames returns the names of the configured analysis targets; without named targets
+// the analysis cloud section is the default target
+func targetNames() []string {
+	var names []string
+	for name := range vi.GetStringMap(constants.AnalysisTargets) {
+		names = append(names, name)
+	}
+
+	if len(names) == 0 {
+		return []string{target.Default}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// targetKey returns the config string of a key of the analysis cloud section for a target;
+// keys, which are not set for the target, fall back to the analysis cloud section
+func targetKey(name, key string) string {
+	targetKey := constants.AnalysisTargets + "." + name + strings.TrimPrefix(key, constants.AnalysisCloud)
+	if vi.IsSet(targetKey) {
+		return targetKey
+	}
+	return key
+}
+
+// newAuth creates the token provider of a target, which is configured in the user
+// management section, for a user management; the secret files are read again, so that a
+// new login uses the current credentials
+func newAuth(name string, mgmt target.UserMgmt, tokenChan chan<- auth.Token, client *http.Client) (auth.Auth, error) {
+	credentials := make(map[string]string)
+	for _, key := range userMgmtSecrets {
+		value, err := secret.Read(vi, targetKey(name, key))
 		if err != nil {
-			klog.Errorf("cannot marshal status: %s", err)
+			return nil, err
 		}
+		credentials[key] = value
+	}
 
-		if err := mqtt.Send("kosmos/status", dat); err != nil {
-			klog.Errorf("cannot publish status: %s", err)
+	endpoint := func(key string) string {
+		path := strings.Trim(vi.GetString(targetKey(name, key)), "/")
+		if path == "" {
+			return ""
 		}
+		return fmt.Sprintf("%s://%s:%d/%s/%s", mgmt.Schema, mgmt.Host, mgmt.Port, strings.Trim(mgmt.Path, "/"), path)
+	}
+
+	config := auth.OAuth2Config{
+		TokenURL:      endpoint(constants.AnalysisCloudUserMgmtTokenPath),
+		RevocationURL: endpoint(constants.AnalysisCloudUserMgmtRevocationPath),
+		Client:        client,
+		ClientID:      vi.GetString(targetKey(name, constants.AnalysisCloudUserMgmtClientID)),
+		ClientSecret:  credentials[constants.AnalysisCloudUserMgmtClientSecret],
+		Scope:         vi.GetString(targetKey(name, constants.AnalysisCloudUserMgmtScope)),
+		User:          vi.GetString(targetKey(name, constants.AnalysisCloudUserMgmtUser)),
+		Password:      credentials[constants.AnalysisCloudUserMgmtPassword],
+		RefreshToken:  credentials[constants.AnalysisCloudUserMgmtRefreshToken],
+	}
+	renewal := auth.Renewal{
+		Fraction:    vi.GetFloat64(targetKey(name, constants.AnalysisCloudUserMgmtRenewalFraction)),
+		BaseBackoff: vi.GetDuration(targetKey(name, constants.AnalysisCloudUserMgmtRenewalBackoffBase)),
+		MaxBackoff:  vi.GetDuration(targetKey(name, constants.AnalysisCloudUserMgmtRenewalBackoffMax)),
+	}
+
+	switch provider := vi.GetString(targetKey(name, constants.AnalysisCloudUserMgmtProvider)); provider {
+	case "form":
+		logoutURL := endpoint(constants.AnalysisCloudUserMgmtLogoutPath)
+		return auth.NewOidcAuth(tokenChan, mgmt.Schema, mgmt.Host, mgmt.Path, mgmt.Port, config.User, config.Password, logoutURL, renewal, client), nil
+	case "clientCredentials":
+		config.Grant = auth.ClientCredentials
+	case "password":
+		config.Grant = auth.PasswordGrant
+	case "refreshToken":
+		config.Grant = auth.RefreshTokenGrant
+	case "static":
+		return auth.NewStaticAuth(tokenChan,
+			vi.GetString(targetKey(name, constants.AnalysisCloudUserMgmtHeader)),
+			credentials[constants.AnalysisCloudUserMgmtToken],
+		), nil
+	default:
+		return nil, fmt.Errorf("unknown token provider %s", provider)
+	}
+	return auth.NewOAuth2Auth(tokenChan, config, renewal)
+}
+
+// dialTarget returns the dialer of a target, which logs in at the user management and
+// starts the outbox of the connection to an endpoint of the target. Endpoints of contracts
+// use the configured credentials and certificates of the target, so the target only dials
+// the endpoints on its allowed hosts.
+func dialTarget(name string, persist connection.Persist, connectorTLS, userMgmtTLS *tls.Config) target.Dialer {
+	client := &http.Client{
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: userMgmtTLS},
+		Timeout:   vi.GetDuration(targetKey(name, constants.AnalysisCloudUserMgmtTimeout)),
+	}
+	return func(address, userMgmt, outbox string) (auth.Auth, *connection.Connection, error) {
+		mgmt := target.UserMgmt{
+			Schema: vi.GetString(targetKey(name, constants.AnalysisCloudUserMgmtSchema)),
+			Host:   vi.GetString(targetKey(name, constants.AnalysisCloudUserMgmtURL)),
+			Path:   vi.GetString(targetKey(name, constants.AnalysisCloudUserMgmtPath)),
+			Port:   vi.GetInt(targetKey(name, constants.AnalysisCloudUserMgmtPort)),
+		}
+		if userMgmt != "" {
+			var err error
+			if mgmt, err = target.ParseUserMgmt(userMgmt, mgmt); err != nil {
+				return nil, nil, fmt.Errorf("cannot parse user management: %s", err)
+			}
+		}
+
+		tokenChan := make(chan auth.Token, 2)
+		oidc, err := newAuth(name, mgmt, tokenChan, client)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if err := oidc.Login(); err != nil {
+			return nil, nil, fmt.Errorf("cannot login to the system: %v", err)
+		}
+
+		baseURL := fmt.Sprintf("%s:%d", vi.GetString(targetKey(name, constants.AnalysisCloudConnectorURL)), vi.GetInt(targetKey(name, constants.AnalysisCloudConnectorPort)))
+		if address != "" {
+			baseURL = strings.TrimSuffix(address, "/")
+		}
+
+		endpoint := connection.NewConnection(baseURL, tokenChan, persist.Target(outbox))
+		endpoint.SetAuth(oidc)
+		endpoint.SetTLSConfig(connectorTLS)
+		endpoint.SetTimeout(vi.GetDuration(targetKey(name, constants.AnalysisCloudConnectorTimeout)))
+		endpoint.SetRetryPolicy(connection.RetryPolicy{
+			Interval:    vi.GetDuration(targetKey(name, constants.AnalysisCloudOutboxInterval)),
+			BaseBackoff: vi.GetDuration(targetKey(name, constants.AnalysisCloudOutboxBackoffBase)),
+			MaxBackoff:  vi.GetDuration(targetKey(name, constants.AnalysisCloudOutboxBackoffMax)),
+			MaxAttempts: vi.GetInt(targetKey(name, constants.AnalysisCloudOutboxMaxAttempts)),
+		})
+		go endpoint.SendMissingData()
+
+		return oidc, endpoint, nil
 	}
 }
 
+// watchCredentials logs out of the sessions of a target and logs in again with the new
+// credentials, when a secret file of its user management changes
+func watchCredentials(t *target.Target) {
+	var files []string
+	for _, key := range userMgmtSecrets {
+		if file := vi.GetString(targetKey(t.Name, key) + secret.FileSuffix); file != "" {
+			files = append(files, file)
+		}
+	}
+
+	secret.Watch(files, vi.GetDuration(constants.EdgeSecretsReloadInterval), func() {
+		klog.Infof("credentials of analysis target %s have changed, log in again", t.Name)
+		if err := t.Redial(); err != nil {
+			klog.Errorf("cannot log in with the changed credentials: %s", err)
+		}
+	})
+}
+
+// loadTLS loads the certificates of a tls section, which are reloaded, when their files
+// change
+func loadTLS(ca, cert, key, serverName string) (*tls.Config, error) {
+	reloader, err := tlsconfig.New(tlsconfig.Config{
+		CA:         vi.GetString(ca),
+		Cert:       vi.GetString(cert),
+		Key:        vi.GetString(key),
+		ServerName: vi.GetString(serverName),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	reloader.Watch(vi.GetDuration(constants.EdgeTLSReloadInterval))
+	return reloader.TLSConfig(), nil
+}
+
+// databaseConnection returns the connection string of the edge database; postgres reads
+// the certificates on every new connection
+func databaseConnection() string {
+	quote := func(value string) string {
+		return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+	}
+
+	conStr := fmt.Sprintf("host=%s user=%s password=%s port=%d sslmode=%s dbname=%s",
+		quote(vi.GetString(constants.EdgeDatabaseURL)),
+		quote(vi.GetString(constants.EdgeDatabaseUser)),
+		quote(vi.GetString(constants.EdgeDatabasePassword)),
+		vi.GetInt(constants.EdgeDatabasePort),
+		quote(vi.GetString(constants.EdgeDatabaseSSLMode)),
+		quote(vi.GetString(constants.EdgeDatabaseDatabase)),
+	)
+
+	for _, param := range []struct{ name, key string }{
+		{"sslrootcert", constants.EdgeDatabaseTLSCA},
+		{"sslcert", constants.EdgeDatabaseTLSCert},
+		{"sslkey", constants.EdgeDatabaseTLSKey},
+	} {
+		if value := vi.GetString(param.key); value != "" {
+			conStr += fmt.Sprintf(" %s=%s", param.name, quote(value))
+		}
+	}
+	return conStr
+}
+
 func main() {
 
+	conStr := databaseConnection()
+	db, err := sql.Open("postgres", conStr)
+	if err != nil {
+		klog.Errorf("cannot connect to database: %s\n", err)
+		os.Exit(1)
+	}
+
+	for i := 0; i < 10; i++ {
+		if err = db.Ping(); err != nil {
+			klog.Infof("DB connection retry: %d/10\n", i+1)
+			time.Sleep(15 * time.Second)
+		} else {
+			i = 10
+		}
+	}
+	if err != nil {
+		klog.Errorf("cannot connect to database: %s\n", err)
+		os.Exit(1)
+	}
+
+	applied, err := database.Migrate(db, database.Migrations)
+	if err != nil {
+		klog.Errorf("cannot migrate the database schema: %s\n", err)
+		os.Exit(1)
+	}
+
+	if flag.Arg(0) == "migrate" {
+		klog.Infof("applied %d migrations: %v", len(applied), applied)
+		klog.Flush()
+		os.Exit(0)
+	}
+
+	mqttTLS, err := loadTLS(constants.EdgeMqttTLSCA, constants.EdgeMqttTLSCert, constants.EdgeMqttTLSKey, constants.EdgeMqttTLSServerName)
+	if err != nil {
+		klog.Errorf("cannot load the certificates of the mqtt broker: %s\n", err)
+		os.Exit(1)
+	}
+
 	var mqttClient mqtt.Mqtt
-	var err error
 	for i := 0; i < 10; i++ {
 		err = mqttClient.Connect(
 			vi.GetString(constants.EdgeMqttURL),
@@ -132,7 +514,7 @@ func main() {
 			vi.GetString(constants.EdgeMqttPassword),
 			"static",
 			vi.GetInt(constants.EdgeMqttPort),
-			&tls.Config{},
+			mqttTLS,
 		)
 		if err != nil {
 			klog.Infof("MQTT connection retry: %d/10\n", i+1)
@@ -147,34 +529,12 @@ func main() {
 		os.Exit(1)
 	}
 
-	go sendStatus(mqttClient)
-
-	tokenChan := make(chan auth.Token, 2)
-	auth := auth.NewOidcAuth(
-		tokenChan,
-		vi.GetString(constants.AnalysisCloudUserMgmtSchema),
-		vi.GetString(constants.AnalysisCloudUserMgmtURL),
-		vi.GetString(constants.AnalysisCloudUserMgmtPath),
-		vi.GetInt(constants.AnalysisCloudUserMgmtPort),
-		vi.GetString(constants.AnalysisCloudUserMgmtUser),
-		vi.GetString(constants.AnalysisCloudUserMgmtPassword),
-	)
-
-	err = auth.Login()
-	if err != nil {
-		klog.Errorf("cannot login to the system: %v", err)
-		os.Exit(1)
-	}
+	statusQuit := make(chan struct{})
+	go sendStatus(mqttClient, statusQuit)
 
 	var persist connection.Persist
 	for i := 0; i < 10; i++ {
-		persist, err = connection.NewPersistPostgreSQL(
-			vi.GetString(constants.EdgeDatabaseURL),
-			vi.GetString(constants.EdgeDatabaseUser),
-			vi.GetString(constants.EdgeDatabasePassword),
-			vi.GetString(constants.EdgeDatabaseDatabase),
-			vi.GetInt(constants.EdgeDatabasePort),
-		)
+		persist, err = connection.NewPersistPostgreSQL(conStr)
 		if err != nil {
 			klog.Infof("DB connection retry: %d/10\n", i+1)
 			time.Sleep(15 * time.Second)
@@ -189,53 +549,227 @@ func main() {
 		os.Exit(1)
 	}
 
-	endpoint := connection.NewConnection(fmt.Sprintf("%s:%d", vi.GetString(constants.AnalysisCloudConnectorURL), vi.GetInt(constants.AnalysisCloudConnectorPort)), tokenChan, persist)
+	var targets []*target.Target
+	for _, name := range targetNames() {
+		if !vi.GetBool(targetKey(name, constants.AnalysisCloudEnabled)) {
+			klog.Infof("analysis target %s is disabled", name)
+			continue
+		}
+
+		connectorTLS, err := loadTLS(
+			targetKey(name, constants.AnalysisCloudConnectorTLSCA),
+			targetKey(name, constants.AnalysisCloudConnectorTLSCert),
+			targetKey(name, constants.AnalysisCloudConnectorTLSKey),
+			targetKey(name, constants.AnalysisCloudConnectorTLSServerName),
+		)
+		if err != nil {
+			klog.Errorf("cannot load the certificates of analysis target %s: %s", name, err)
+			os.Exit(1)
+		}
 
-	buf := buffer.NewLocalBuffer()
+		userMgmtTLS, err := loadTLS(
+			targetKey(name, constants.AnalysisCloudUserMgmtTLSCA),
+			targetKey(name, constants.AnalysisCloudUserMgmtTLSCert),
+			targetKey(name, constants.AnalysisCloudUserMgmtTLSKey),
+			targetKey(name, constants.AnalysisCloudUserMgmtTLSServerName),
+		)
+		if err != nil {
+			klog.Errorf("cannot load the certificates of the user management of analysis target %s: %s", name, err)
+			os.Exit(1)
+		}
+
+		t, err := target.New(name, vi.GetString(targetKey(name, constants.AnalysisCloudInterval)), dialTarget(name, persist, connectorTLS, userMgmtTLS))
+		if err != nil {
+			klog.Errorf("cannot connect to analysis target %s: %s", name, err)
+			os.Exit(1)
+		}
+		t.AllowedHosts = vi.GetStringSlice(targetKey(name, constants.AnalysisCloudAllowedHosts))
+		if outboxes, err := persist.Outboxes(); err != nil {
+			klog.Errorf("cannot read the outboxes of analysis target %s: %s", name, err)
+		} else {
+			t.DrainOutboxes(outboxes)
+		}
+		watchCredentials(t)
+		klog.Infof("connected to analysis target %s", name)
+		targets = append(targets, t)
+	}
+	targetRegistry := target.NewRegistry(targets...)
+
+	var buf buffer.Data
+	switch vi.GetString(constants.EdgeBufferType) {
+	case "memory":
+		limits := buffer.Limits{
+			SensorCount: vi.GetInt(constants.EdgeBufferLimitsSensorCount),
+			SensorBytes: vi.GetInt(constants.EdgeBufferLimitsSensorBytes),
+			GlobalCount: vi.GetInt(constants.EdgeBufferLimitsGlobalCount),
+			GlobalBytes: vi.GetInt(constants.EdgeBufferLimitsGlobalBytes),
+		}
+		if limits == (buffer.Limits{}) {
+			buf = buffer.NewLocalBuffer()
+			break
+		}
+
+		policy := buffer.OverflowPolicy(vi.GetString(constants.EdgeBufferOverflow))
+		var spill buffer.Data
+		if policy == buffer.SpillToDisk {
+			spill, err = buffer.NewFileBuffer(vi.GetString(constants.EdgeBufferPath))
+			if err != nil {
+				klog.Errorf("cannot create spill buffer: %s", err)
+				os.Exit(1)
+			}
+		}
+
+		buf, err = buffer.NewBoundedBuffer(limits, policy, spill)
+		if err != nil {
+			klog.Errorf("cannot create bounded buffer: %s", err)
+			os.Exit(1)
+		}
+	case "file":
+		buf, err = buffer.NewFileBuffer(vi.GetString(constants.EdgeBufferPath))
+		if err != nil {
+			klog.Errorf("cannot create file buffer: %s", err)
+			os.Exit(1)
+		}
+	default:
+		klog.Errorf("unknown buffer type: %s", vi.GetString(constants.EdgeBufferType))
+		os.Exit(1)
+	}
 
 	//var uploaderSens uploader.UploaderSensor
 	//uploaderSens := uploader.InitUploaderSensor(buf, endpoint)
 	uploaderSens := uploader.Sensor{}
 	uploaderSensor := &uploaderSens
-	uploaderSensor.Init(buf, endpoint)
-
-	conStr := fmt.Sprintf("host=%s user=%s password=%s port=%d sslmode=disable dbname=%s",
-		vi.GetString(constants.EdgeDatabaseURL),
-		vi.GetString(constants.EdgeDatabaseUser),
-		vi.GetString(constants.EdgeDatabasePassword),
-		vi.GetInt(constants.EdgeDatabasePort),
-		vi.GetString(constants.EdgeDatabaseDatabase),
-	)
-	db, err := sql.Open("postgres", conStr)
-	if err != nil {
-		klog.Errorf("cannot connect to database: %s\n", err)
-		os.Exit(1)
+	uploaderSensor.Init(buf, targetRegistry)
+	uploaderSensor.StartPurge(vi.GetDuration(constants.EdgeBufferPurgeInterval))
+
+	checks := mapper.Checks{
+		Rejecter: reject.NewRejecter(mqttClient, map[string]string{
+			reject.Signature: vi.GetString(constants.EdgeSignatureRejectionTopic),
+			reject.Schema:    vi.GetString(constants.EdgeSchemaErrorTopic),
+		}),
 	}
 
-	_ = mapper.NewContractMapper(mqttClient, endpoint, version, db, uploaderSensor)
-
-	sensors, err := database.HandleSensors(db, version)
-	if err != nil {
-		klog.Errorf("cannot receive sensors which should be handled: %s", err)
+	if vi.GetBool(constants.EdgeSignatureEnabled) {
+		checks.Verifier, err = signature.NewTrustStore(vi.GetString(constants.EdgeSignatureTrustStore))
+		if err != nil {
+			klog.Errorf("cannot load trust store: %s", err)
+			os.Exit(1)
+		}
 	}
 
-	for _, v := range sensors {
-		klog.Infof("start handle machine %s sensor %s and duration %s", v.Machine, v.Sensor, v.Duration)
-		mapper := mapper.SensorData{}
-		if err := mapper.Init(mqttClient, buf, v.Machine, v.Sensor); err != nil {
-			klog.Errorf("cannot create mapper on machine %s sensor %s and duration %v", v.Machine, v.Sensor, v.Duration)
+	if vi.GetString(constants.EdgeSignatureKey) != "" {
+		checks.Signer, err = signature.NewKeySigner(vi.GetString(constants.EdgeSignatureKey))
+		if err != nil {
+			klog.Errorf("cannot load signature key: %s", err)
 			os.Exit(1)
 		}
+		uploaderSensor.SetSigner(checks.Signer)
+	}
 
-		duration, err := time.ParseDuration(v.Duration)
+	if vi.GetBool(constants.EdgeSchemaEnabled) {
+		checks.Validator, err = schema.NewValidator()
 		if err != nil {
-			klog.Errorf("cannot parse v.Duration %s err: %s", v.Duration, err)
+			klog.Errorf("cannot compile json schemas: %s", err)
 			os.Exit(1)
 		}
+		uploaderSensor.SetValidator(checks.Validator, checks.Rejecter)
+	}
+
+	uploaderSensor.SetAudit(func(a uploader.Audit) error {
+		return database.AddUploadAudit(db, a.Contract, a.Target, a.Machine, a.Sensor, a.Recipients, a.Updates, a.Bytes, a.Queued)
+	})
 
-		uploaderSensor.StartHandler(v.Machine, v.Sensor, duration)
+	registry := mapper.NewSensorRegistry(mqttClient, uploaderSensor, checks)
+	deletion := mapper.DeletionPolicy(vi.GetString(constants.EdgeContractsParentDeletion))
+	if deletion != mapper.BlockChildren && deletion != mapper.CascadeChildren {
+		klog.Errorf("unknown deletion policy of parent contracts: %s", deletion)
+		os.Exit(1)
+	}
+
+	contractMapper := mapper.NewContractMapper(mqttClient, targetRegistry, version, db, registry, checks, deletion)
+	if err := contractMapper.Restore(); err != nil {
+		klog.Errorf("cannot restore the handling of the stored contracts: %s", err)
+		os.Exit(1)
+	}
+
+	var pollers []*results.Poller
+	for _, t := range targetRegistry.Targets() {
+		name := t.Name
+		if interval := vi.GetDuration(targetKey(name, constants.AnalysisCloudResultsInterval)); interval > 0 {
+			poller := results.NewPoller(t, mqttClient, db, func() []string { return registry.Contracts(name) }, interval)
+			pollers = append(pollers, poller)
+			go poller.Run()
+		}
 	}
 
 	http.Handle("/metrics", promhttp.Handler())
-	klog.Fatal(http.ListenAndServe(cli.Monitoring, nil))
+	http.Handle("/sensors", registry)
+	http.Handle("/contracts/", contractMapper)
+	http.Handle("/retention", uploaderSensor)
+	server := &http.Server{Addr: cli.Monitoring}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			klog.Fatal(err)
+		}
+	}()
+
+	manager := lifecycle.NewManager(vi.GetDuration(constants.EdgeShutdownTimeout))
+	manager.Register("stop contract scheduler", func(ctx context.Context) error {
+		contractMapper.Close()
+		return nil
+	})
+	manager.Register("stop results poller", func(ctx context.Context) error {
+		for _, poller := range pollers {
+			poller.Stop()
+		}
+		return nil
+	})
+	manager.Register("stop status", func(ctx context.Context) error {
+		close(statusQuit)
+		return nil
+	})
+	manager.Register("unsubscribe mqtt topics", func(ctx context.Context) error {
+		return mqttClient.UnsubscribeAll()
+	})
+	manager.Register("upload buffered data", func(ctx context.Context) error {
+		uploaderSensor.Shutdown(ctx)
+		return nil
+	})
+	manager.Register("drain outbox", func(ctx context.Context) error {
+		for _, t := range targetRegistry.Targets() {
+			for _, endpoint := range t.Connections() {
+				endpoint.Drain(ctx)
+			}
+		}
+		return nil
+	})
+	manager.Register("log out", func(ctx context.Context) error {
+		for _, t := range targetRegistry.Targets() {
+			t.Logout()
+		}
+		return nil
+	})
+	// the final steps are executed, even if the cloud is unreachable and the steps above
+	// exceed the deadline
+	manager.RegisterFinal("publish offline status", func(ctx context.Context) error {
+		publishStatus(mqttClient, "offline")
+		mqttClient.Disconnect()
+		return nil
+	})
+	manager.RegisterFinal("stop http server", server.Shutdown)
+	manager.RegisterFinal("persist buffered data", func(ctx context.Context) error {
+		uploaderSensor.Persist()
+		return nil
+	})
+	manager.RegisterFinal("close outbox", func(ctx context.Context) error {
+		return persist.Close()
+	})
+	manager.RegisterFinal("close database", func(ctx context.Context) error {
+		return db.Close()
+	})
+
+	if err := manager.Wait(); err != nil {
+		klog.Errorf("cannot shutdown gracefully: %s", err)
+		os.Exit(1)
+	}
 }
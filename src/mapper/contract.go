@@ -14,24 +14,38 @@ import (
 	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/connection"
 	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/db"
 	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/mqtt"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/reject"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/schema"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/signature"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/target"
 	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/uploader"
 )
 
 // Contract contains the logic to handle a contract message
 type Contract struct {
-	connector *connection.Connection
+	targets   *target.Registry
 	db        *sql.DB
 	version   string
-	uploader  *uploader.Sensor
+	registry  *SensorRegistry
+	scheduler *Scheduler
+	checks    Checks
+	deletion  DeletionPolicy
 }
 
-// NewContractMapper initialise the contract struct
-func NewContractMapper(mClient mqtt.Mqtt, connector *connection.Connection, version string, db *sql.DB, upload *uploader.Sensor) Contract {
-	var c Contract
-	c.connector = connector
+// NewContractMapper initialise the contract struct. A contract is sent to the targets of
+// its enabled analysis systems. Contracts are rejected, if they violate the schema or have
+// no valid signature, and the contracts sent to the targets are signed, if the checks are
+// enabled. The deletion policy defines if the deletion of a parent contract is blocked by or
+// cascades to its child contracts.
+func NewContractMapper(mClient mqtt.Mqtt, targets *target.Registry, version string, db *sql.DB, registry *SensorRegistry, checks Checks, deletion DeletionPolicy) *Contract {
+	c := &Contract{}
+	c.targets = targets
 	c.version = version
 	c.db = db
-	c.uploader = upload
+	c.registry = registry
+	c.checks = checks
+	c.deletion = deletion
+	c.scheduler = NewScheduler(c.activateContract, c.expireContract)
 	klog.Infof("subscribe to contracts create")
 	if err := mClient.Subscribe("kosmos/contracts/create", c.createMessageHandler); err != nil {
 		klog.Errorf("cannot subscribe to kosmos/contracts/create: %s\n", err)
@@ -42,6 +56,11 @@ func NewContractMapper(mClient mqtt.Mqtt, connector *connection.Connection, vers
 		klog.Errorf("cannot subscribe to kosmos/contracts/all: %s", err)
 	}
 
+	klog.Infof("subscribe to contracts update")
+	if err := mClient.Subscribe("kosmos/contracts/update", c.updateMessageHandler); err != nil {
+		klog.Errorf("cannot subscribe to kosmos/contracts/update: %s\n", err)
+	}
+
 	klog.Infof("subscribe to contracts delete")
 	if err := mClient.Subscribe("kosmos/contracts/delete", c.deleteMessageHandler); err != nil {
 		klog.Errorf("cannot subscribe to kosmos/contracts/delete: %s\n", err)
@@ -50,7 +69,302 @@ func NewContractMapper(mClient mqtt.Mqtt, connector *connection.Connection, vers
 	return c
 }
 
-func (c Contract) deleteMessageHandler(client MQTT.Client, m MQTT.Message) {
+// sign signs the body of a contract, which is sent to the analysis cloud
+func (c *Contract) sign(cCon *connection.Contract) error {
+	if c.checks.Signer == nil {
+		return nil
+	}
+
+	sig, err := signature.SignJSON(c.checks.Signer, cCon.Body)
+	if err != nil {
+		return err
+	}
+
+	cCon.Signature = connection.Signature{
+		Signature: sig,
+		Meta: connection.SignatureMeta{
+			Date:      time.Now().UTC().Format(time.RFC3339),
+			Algorithm: c.checks.Signer.Algorithm(),
+		},
+	}
+	return nil
+}
+
+// marshal signs a contract for an analysis target and validates the encoded contract
+func (c *Contract) marshal(cCon *connection.Contract) ([]byte, error) {
+	if err := c.sign(cCon); err != nil {
+		return nil, fmt.Errorf("cannot sign contract: %s", err)
+	}
+
+	byteData, err := json.Marshal(cCon)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal connector contract: %s", err)
+	}
+
+	if err := c.checks.Validator.Validate(schema.AnalysisContract, byteData); err != nil {
+		c.checks.Rejecter.Reject("analysisContract", reject.Schema, "contract/", byteData, err)
+		return nil, err
+	}
+	return byteData, nil
+}
+
+// prepare returns the encoded contract for the target of each analysis system; the
+// contract sent to a target only contains the analysis system of the target
+func (c *Contract) prepare(cCon connection.Contract) map[*target.Target][]byte {
+	prepared := make(map[*target.Target][]byte)
+	for _, system := range cCon.Body.Analysis.Systems {
+		t, ok := c.targets.Get(system.System)
+		if !ok {
+			continue
+		}
+
+		sCon := cCon
+		sCon.Body.Analysis.Systems = []connection.ContractAnalysisSystem{system}
+		data, err := c.marshal(&sCon)
+		if err != nil {
+			klog.Errorf("cannot prepare contract %s for target %s: %s", cCon.Body.Contract.ID, t.Name, err)
+			continue
+		}
+		prepared[t] = data
+	}
+	return prepared
+}
+
+// bind assigns the endpoints of the analysis systems of a contract at their targets;
+// systems without url and user management use the configured endpoint of the target
+func (c *Contract) bind(contract string, systems []connection.ContractAnalysisSystem) error {
+	for _, system := range systems {
+		t, ok := c.targets.Get(system.System)
+		if !ok {
+			continue
+		}
+
+		if err := t.Bind(contract, system.Connection.URL, system.Connection.UserMgmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unbind removes the endpoint assignments of a contract, which could not be stored
+func (c *Contract) unbind(contract string, systems []connection.ContractAnalysisSystem) {
+	for _, system := range systems {
+		if t, ok := c.targets.Get(system.System); ok {
+			t.Unbind(contract)
+		}
+	}
+}
+
+// Restore re-arms the validity windows of all stored contracts. Valid contracts are
+// activated and expired contracts are deleted.
+func (c *Contract) Restore() error {
+	schedules, err := db.GetContractSchedules(c.db, c.version)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range schedules {
+		c.scheduler.Schedule(v.Contract, v.Start, v.End)
+	}
+	return nil
+}
+
+// Close stops the activation and expiration of the contracts
+func (c *Contract) Close() {
+	c.scheduler.Stop()
+}
+
+// activateContract registers the sensors of a stored contract
+func (c *Contract) activateContract(contract string) {
+	machineSensor, err := db.GetMachineSensorFromContract(c.db, contract)
+	if err != nil {
+		klog.Errorf("cannot get machineSensor from a contract %s err: %s", contract, err)
+		return
+	}
+
+	checkSignatures, err := db.ContractCheckSignatures(c.db, contract)
+	if err != nil {
+		klog.Errorf("cannot get check signatures of contract %s: %s", contract, err)
+		return
+	}
+
+	stored, err := c.storedContract(contract)
+	if err != nil {
+		klog.Errorf("cannot get analysis systems of contract %s: %s", contract, err)
+		return
+	}
+
+	var systems []connection.ContractAnalysisSystem
+	if stored != nil {
+		systems = stored.Body.Analysis.Systems
+		c.restrictRecipients(stored.Body.Contract)
+		for _, v := range stored.Body.Sensors {
+			retention, err := sensorRetention(v)
+			if err != nil {
+				klog.Errorf("cannot apply storage duration of contract %s: %s", contract, err)
+				continue
+			}
+			c.registry.uploader.SetRetention(contract, v.Name, retention)
+		}
+	}
+
+	if err := c.bind(contract, systems); err != nil {
+		klog.Errorf("cannot activate contract %s: %s", contract, err)
+		return
+	}
+
+	for _, v := range machineSensor {
+		var routes map[uploader.Route][]uploader.Trigger
+		if systems != nil {
+			routes, err = c.contractRoutes(contract, systems, v.Sensor)
+		} else {
+			// contracts stored without definition are uploaded untagged with the interval
+			// to the default target
+			var duration time.Duration
+			duration, err = db.MinDuration(c.db, v.Machine, v.Sensor, c.version)
+			routes = map[uploader.Route][]uploader.Trigger{
+				{Target: target.Default, Contract: contract, Pipeline: -1}: {{Type: uploader.TimeTrigger, Interval: duration}},
+			}
+		}
+		if err != nil {
+			klog.Errorf("cannot receive routes of machine %s sensor %s: %s", v.Machine, v.Sensor, err)
+			continue
+		}
+
+		if len(routes) == 0 {
+			klog.Infof("sensor %s of machine %s is not analysed by a pipeline of contract %s", v.Sensor, v.Machine, contract)
+			continue
+		}
+
+		if err := c.registry.Add(contract, v.Machine, v.Sensor, routes, checkSignatures); err != nil {
+			klog.Errorf("cannot register machine %s sensor %s: %s", v.Machine, v.Sensor, err)
+		}
+	}
+}
+
+// restrictRecipients restricts the batches of a contract, which defines partners, to the
+// partners with read permission; the batches of contracts without partners are forwarded
+// without recipients
+func (c *Contract) restrictRecipients(infos connection.ContractInfos) {
+	if len(infos.Partners) == 0 {
+		c.registry.uploader.RemoveRecipients(infos.ID)
+		return
+	}
+
+	recipients := uploader.Recipients(infos.Partners, infos.Permissions.Read)
+	if len(recipients) == 0 {
+		klog.Warningf("no partner of contract %s has the read permission, its data is not forwarded", infos.ID)
+	}
+	c.registry.uploader.SetRecipients(infos.ID, recipients)
+}
+
+// sensorRetention returns the storage durations of a contract sensor on the systems edge
+// and analysis; the storage durations of other systems are not applied by the edge
+func sensorRetention(sensor connection.ContractSensor) (uploader.Retention, error) {
+	var retention uploader.Retention
+	for _, v := range sensor.StorageDuration {
+		var duration *time.Duration
+		switch strings.ToLower(v.SystemName) {
+		case "edge":
+			duration = &retention.Edge
+		case "analysis":
+			duration = &retention.Analysis
+		default:
+			continue
+		}
+
+		d, err := uploader.ParseRetention(v.Duration)
+		if err != nil {
+			return uploader.Retention{}, fmt.Errorf("cannot parse storage duration of sensor %s on %s: %s", sensor.Name, v.SystemName, err)
+		}
+		*duration = d
+	}
+	return retention, nil
+}
+
+// contractRoutes returns the routes of a sensor to the pipelines of every analysis system
+func (c *Contract) contractRoutes(contract string, systems []connection.ContractAnalysisSystem, sensor string) (map[uploader.Route][]uploader.Trigger, error) {
+	routes := make(map[uploader.Route][]uploader.Trigger)
+	for _, system := range systems {
+		systemRoutes, err := sensorRoutes(contract, system, sensor)
+		if err != nil {
+			return nil, fmt.Errorf("analysis system %s: %s", system.System, err)
+		}
+
+		for route, triggers := range systemRoutes {
+			routes[route] = triggers
+		}
+	}
+	return routes, nil
+}
+
+// storedContract returns the converted definition of a stored contract; nil is returned,
+// if the contract has been stored without definition
+func (c *Contract) storedContract(contract string) (*connection.Contract, error) {
+	definition, err := db.ContractDefinition(c.db, contract)
+	if err != nil || definition == nil {
+		return nil, err
+	}
+
+	var mCon mqtt.Contract
+	if err := json.Unmarshal(definition, &mCon); err != nil {
+		return nil, err
+	}
+
+	if mCon, err = c.resolveContract(mCon); err != nil {
+		return nil, err
+	}
+
+	cCon, found := c.convertContract(mCon)
+	if !found {
+		return nil, fmt.Errorf("contract does not define an enabled analysis system")
+	}
+	return &cCon, nil
+}
+
+// analysisSystems returns the analysis systems of the stored contract definition, which
+// have a configured target; nil is returned, if the contract has been stored without
+// definition
+func (c *Contract) analysisSystems(contract string) ([]connection.ContractAnalysisSystem, error) {
+	cCon, err := c.storedContract(contract)
+	if err != nil || cCon == nil {
+		return nil, err
+	}
+	return cCon.Body.Analysis.Systems, nil
+}
+
+// contractTargets returns the targets of the stored contract with the endpoints of the
+// contract bound; contracts stored without definition have been sent to the default target
+func (c *Contract) contractTargets(contract string) []*target.Target {
+	systems, err := c.analysisSystems(contract)
+	if err != nil {
+		klog.Errorf("cannot get analysis systems of contract %s: %s", contract, err)
+	}
+
+	var targets []*target.Target
+	if systems == nil {
+		if t, ok := c.targets.Get(target.Default); ok {
+			targets = append(targets, t)
+		}
+		return targets
+	}
+
+	for _, system := range systems {
+		t, ok := c.targets.Get(system.System)
+		if !ok {
+			continue
+		}
+
+		if err := t.Bind(contract, system.Connection.URL, system.Connection.UserMgmt); err != nil {
+			klog.Errorf("cannot connect to the endpoint of contract %s: %s", contract, err)
+			continue
+		}
+		targets = append(targets, t)
+	}
+	return targets
+}
+
+func (c *Contract) deleteMessageHandler(client MQTT.Client, m MQTT.Message) {
 	klog.Infof("handle contract delete message")
 	var dCon struct {
 		Body struct {
@@ -58,176 +372,406 @@ func (c Contract) deleteMessageHandler(client MQTT.Client, m MQTT.Message) {
 		} `json:"body"`
 	}
 
+	if err := c.checks.Validator.Validate(schema.ContractRemove, m.Payload()); err != nil {
+		c.checks.Rejecter.Reject("contractRemove", reject.Schema, m.Topic(), m.Payload(), err)
+		return
+	}
+
 	if err := json.Unmarshal(m.Payload(), &dCon); err != nil {
 		klog.Errorf("cannot unmarshal contract deletion message")
 		return
 	}
 
-	req, err := c.connector.Request("DELETE", fmt.Sprintf("contract/%s", dCon.Body.Contract), nil, strings.NewReader(""))
+	if c.blocked(dCon.Body.Contract) {
+		return
+	}
+
+	c.deleteContract(dCon.Body.Contract)
+}
+
+// blocked returns true, if the deletion policy blocks the deletion of a contract, because
+// it is the parent of other contracts
+func (c *Contract) blocked(contract string) bool {
+	if c.deletion != BlockChildren {
+		return false
+	}
+
+	children, err := db.ContractChildren(c.db, contract)
+	if err != nil {
+		klog.Errorf("cannot get children of contract %s: %s", contract, err)
+		return true
+	}
+	if len(children) > 0 {
+		klog.Errorf("contract %s is not deleted, because it is the parent of the contracts %s", contract, strings.Join(children, ", "))
+		return true
+	}
+	return false
+}
+
+// expireContract deletes a contract at the end of its validity. A contract, whose deletion
+// is blocked, is kept for its children, but its own sensors are not uploaded anymore; it is
+// deleted, when it expires again after a restart without children.
+func (c *Contract) expireContract(contract string) {
+	if !c.blocked(contract) {
+		c.deleteContract(contract)
+		return
+	}
+
+	machineSensor, err := db.GetMachineSensorFromContract(c.db, contract)
+	if err != nil {
+		klog.Errorf("cannot get machineSensor from a contract %s err: %s", contract, err)
+	}
+	for _, v := range machineSensor {
+		if _, err := c.registry.Remove(contract, v.Machine, v.Sensor); err != nil {
+			klog.Errorf("cannot unsubscribe machine %s sensor %s: %s", v.Machine, v.Sensor, err)
+		}
+	}
+}
+
+// deleteContract removes the contract and its child contracts from their analysis targets
+// and the database and stops the handling of sensors, which are not required by other
+// contracts
+func (c *Contract) deleteContract(contract string) {
+	c.scheduler.Cancel(contract)
+
+	// the children inherit from the contract and cannot be handled without it
+	children, err := db.ContractChildren(c.db, contract)
 	if err != nil {
-		klog.Errorf("cannot successful delete contract: %s\n", err)
+		klog.Errorf("cannot get children of contract %s: %s", contract, err)
+	}
+	for _, child := range children {
+		klog.Infof("delete child contract %s of contract %s", child, contract)
+		c.deleteContract(child)
 	}
 
-	if req.StatusCode != 204 {
-		klog.Errorf("cannot successful delete contract; transmitted status code is: %d", req.StatusCode)
+	path := fmt.Sprintf("contract/%s", contract)
+	for _, t := range c.contractTargets(contract) {
+		c.upload(t, contract, "DELETE", path, nil, 204)
+		// an unused endpoint is closed, after its outbox including the deletion is sent
+		t.Unbind(contract)
 	}
 
-	machineSensor, err := db.GetMachineSensorFromContract(c.db, dCon.Body.Contract)
+	machineSensor, err := db.GetMachineSensorFromContract(c.db, contract)
 	if err != nil {
-		klog.Errorf("cannot get machineSensor from a contract %s err: %s", dCon.Body.Contract, err)
+		klog.Errorf("cannot get machineSensor from a contract %s err: %s", contract, err)
 	}
-	if err := db.ContractRemove(c.db, dCon.Body.Contract); err != nil {
+	if err := db.ContractRemove(c.db, contract); err != nil {
 		klog.Errorf("cannot remove contract from db %s", err)
 	}
 
 	for _, v := range machineSensor {
-		exists, err := db.ContractToMachineSensorExists(c.db, v.Machine, v.Sensor)
+		if _, err := c.registry.Remove(contract, v.Machine, v.Sensor); err != nil {
+			klog.Errorf("cannot unsubscribe machine %s sensor %s: %s", v.Machine, v.Sensor, err)
+		}
+	}
+	c.registry.uploader.RemoveRecipients(contract)
+	c.registry.uploader.RemoveRetention(contract)
+}
+
+// parseContract validates and unmarshals a contract message. If the signature verification
+// is enabled, contracts without a valid signature are rejected.
+func (c *Contract) parseContract(topic string, payload []byte) (mqtt.Contract, bool) {
+	if err := c.checks.Validator.Validate(schema.Contract, payload); err != nil {
+		c.checks.Rejecter.Reject("contract", reject.Schema, topic, payload, err)
+		return mqtt.Contract{}, false
+	}
+
+	var mCon mqtt.Contract
+	if err := json.Unmarshal(payload, &mCon); err != nil {
+		klog.Errorf("cannot unmarshal contract message: %s\n", err)
+		return mqtt.Contract{}, false
+	}
+
+	if c.checks.Verifier == nil {
+		return mCon, true
+	}
+
+	var signed struct {
+		Body json.RawMessage `json:"body"`
+	}
+	if err := json.Unmarshal(payload, &signed); err != nil {
+		klog.Errorf("cannot unmarshal contract message: %s\n", err)
+		return mqtt.Contract{}, false
+	}
+
+	if err := verify(c.checks.Verifier, "contract", signed.Body, mCon.Signature.Signature, mCon.Signature.Meta.Algorithm); err != nil {
+		c.checks.Rejecter.Reject("contract", reject.Signature, topic, payload, err)
+		return mqtt.Contract{}, false
+	}
+
+	return mCon, true
+}
+
+// contractPlan is the validated validity window and upload interval of a contract
+type contractPlan struct {
+	start    time.Time
+	end      time.Time
+	interval time.Duration
+}
+
+// validateContract validates the validity window, the upload intervals, the routes and the
+// storage durations of a contract, before anything of the contract is changed
+func (c *Contract) validateContract(cCon connection.Contract) (contractPlan, error) {
+	start, end, err := parseValidity(cCon.Body.Contract.Valid.Start, cCon.Body.Contract.Valid.End)
+	if err != nil {
+		return contractPlan{}, fmt.Errorf("cannot parse validity: %s", err)
+	}
+
+	if !end.IsZero() && !time.Now().Before(end) {
+		return contractPlan{}, fmt.Errorf("contract has already expired at %s", end)
+	}
+
+	// parse the frequencies with which data is sent to the targets; the shortest interval
+	// is stored with the sensors
+	var interval string
+	var shortest time.Duration
+	for _, system := range cCon.Body.Analysis.Systems {
+		duration, err := time.ParseDuration(system.Connection.Interval)
 		if err != nil {
-			klog.Errorf("cannot query existence of machine sensor: %s\n", err)
+			return contractPlan{}, fmt.Errorf("duration parsing uploading interval of system %s failed: %s", system.System, err)
 		}
 
-		if !exists {
-			return
+		if interval == "" || duration < shortest {
+			interval, shortest = system.Connection.Interval, duration
 		}
+	}
 
-		duration, err := db.MinDuration(c.db, v.Machine, v.Sensor, c.version)
-		if err != nil {
-			klog.Errorf("cannot receive duration: %s", err)
+	for _, v := range cCon.Body.Sensors {
+		if _, err := c.contractRoutes(cCon.Body.Contract.ID, cCon.Body.Analysis.Systems, v.Name); err != nil {
+			return contractPlan{}, err
 		}
+		if _, err := sensorRetention(v); err != nil {
+			return contractPlan{}, err
+		}
+	}
+
+	return contractPlan{start: start, end: end, interval: shortest}, nil
+}
+
+// writeContract stores the sensors, the validity window, the signature requirement and the
+// definition of a contract
+func writeContract(exec db.Executor, cCon connection.Contract, plan contractPlan, version string, definition []byte) error {
+	for _, v := range cCon.Body.Sensors {
+		if err := db.Insert(exec, cCon.Body.Machine, v.Name, plan.interval, version, cCon.Body.Contract.ID); err != nil {
+			return fmt.Errorf("cannot insert new contract into database: %s", err)
+		}
+	}
+
+	if err := db.SetContractValidity(exec, cCon.Body.Contract.ID, plan.start, plan.end); err != nil {
+		return fmt.Errorf("cannot store validity: %s", err)
+	}
+
+	if err := db.SetContractCheckSignatures(exec, cCon.Body.Contract.ID, cCon.Body.CheckSignature); err != nil {
+		return fmt.Errorf("cannot store check signatures: %s", err)
+	}
+
+	if err := db.SetContractDefinition(exec, cCon.Body.Contract.ID, definition); err != nil {
+		return fmt.Errorf("cannot store definition: %s", err)
+	}
+
+	if err := db.SetContractParent(exec, cCon.Body.Contract.ID, cCon.Body.Contract.ParentContract); err != nil {
+		return fmt.Errorf("cannot store parent contract: %s", err)
+	}
+	return nil
+}
+
+// storeContract validates a contract, assigns its endpoints and stores it together with
+// the further changes in one transaction; the activation of the contract is scheduled, after
+// the transaction has been committed. If an error is returned, the database is unchanged,
+// but the endpoints of the contract may have been assigned.
+func (c *Contract) storeContract(cCon connection.Contract, definition []byte, changes func(db.Executor) error) error {
+	plan, err := c.validateContract(cCon)
+	if err != nil {
+		return err
+	}
+
+	if err := c.bind(cCon.Body.Contract.ID, cCon.Body.Analysis.Systems); err != nil {
+		return err
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return fmt.Errorf("cannot begin transaction: %s", err)
+	}
 
-		c.uploader.ChangeInterval(v.Machine, v.Sensor, duration)
+	if changes != nil {
+		err = changes(tx)
+	}
+	if err == nil {
+		err = writeContract(tx, cCon, plan, c.version, definition)
+	}
+	if err != nil {
+		if rErr := tx.Rollback(); rErr != nil {
+			klog.Errorf("cannot roll back contract %s: %s", cCon.Body.Contract.ID, rErr)
+		}
+		return err
 	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot commit contract: %s", err)
+	}
+
+	// the sensors are subscribed and uploaded during the validity of the contract
+	c.scheduler.Schedule(cCon.Body.Contract.ID, plan.start, plan.end)
+	return nil
 }
 
-func (c Contract) allMessageHandler(client MQTT.Client, m MQTT.Message) {
+func (c *Contract) allMessageHandler(client MQTT.Client, m MQTT.Message) {
 	klog.Infof("receive mqtt message to handler all contracts")
 	klog.V(2).Infof("qos: %d, duplication: %t, messageID: %d", m.Qos(), m.Duplicate(), m.MessageID())
 
-	var contracts []mqtt.Contract
+	var contracts []json.RawMessage
 	if err := json.Unmarshal(m.Payload(), &contracts); err != nil {
 		klog.Errorf("cannot unmarshal contract message: %s\n", err)
 		return
 	}
 
-	var mcCon []connection.Contract
-	for _, con := range contracts {
-		cCon, analysisCloud, found := c.convertContract(con)
-		if found {
+	// the contracts are uploaded in one request per endpoint
+	type batch struct {
+		target    *target.Target
+		contracts []json.RawMessage
+	}
+	var endpoints []*connection.Connection
+	mcCon := make(map[*connection.Connection]*batch)
+	for _, payload := range contracts {
+		con, ok := c.parseContract(m.Topic(), payload)
+		if !ok {
 			continue
 		}
 
-		for _, v := range cCon.Body.Sensors {
-			if err := db.Insert(c.db, cCon.Body.Machine, v.Name, analysisCloud.Connection.Interval, c.version, cCon.Body.Contract.ID); err != nil {
-				klog.Errorf("cannot insert new contract into database: %s", err)
-				continue
-			}
+		// stored contracts are updated like a contract of the update topic, so that the
+		// changes are validated before they are applied and recorded in the history
+		exists, err := db.ContractExists(c.db, con.Body.Contract.ID)
+		if err != nil {
+			klog.Errorf("cannot test if contract %s exists: %s", con.Body.Contract.ID, err)
+			continue
+		}
+		if exists {
+			c.updateContract(con, payload)
+			continue
+		}
 
-			duration, err := time.ParseDuration(analysisCloud.Connection.Interval)
-			if err != nil {
-				klog.Errorf("duration parsing uploading interval failed: %s", err)
-				continue
-			}
+		cCon, found := c.convertContract(con)
+		if !found {
+			continue
+		}
 
-			c.uploader.StartHandler(cCon.Body.Machine, v.Name, duration)
+		if err := c.storeContract(cCon, payload, nil); err != nil {
+			klog.Errorf("cannot store contract %s: %s", cCon.Body.Contract.ID, err)
+			c.unbind(cCon.Body.Contract.ID, cCon.Body.Analysis.Systems)
+			continue
+		}
 
-			dura, err := db.MinDuration(c.db, cCon.Body.Machine, v.Name, c.version)
-			if err != nil {
-				klog.Errorf("cannot receive min duration: %s\n", err)
-				continue
+		for t, data := range c.prepare(cCon) {
+			endpoint := t.For(cCon.Body.Contract.ID)
+			if _, ok := mcCon[endpoint]; !ok {
+				endpoints = append(endpoints, endpoint)
+				mcCon[endpoint] = &batch{target: t}
 			}
-
-			klog.Infof("change interval")
-
-			c.uploader.ChangeInterval(cCon.Body.Machine, v.Name, dura)
+			mcCon[endpoint].contracts = append(mcCon[endpoint].contracts, data)
 		}
+	}
 
-		mcCon = append(mcCon, cCon)
+	for _, endpoint := range endpoints {
+		t := mcCon[endpoint].target
+		byteData, err := json.Marshal(mcCon[endpoint].contracts)
+		if err != nil {
+			klog.Errorf("cannot marshal connector contract: %s\n", err)
+			continue
+		}
 
-	}
+		klog.Infof("start to make the http request against target %s; with data\n%s", t.Name, string(byteData))
+		req, err := endpoint.Request("POST", "contract/", nil, strings.NewReader(string(byteData)))
+		if err != nil {
+			klog.Errorf("cannot upload contract to analysis target %s: %s\n", t.Name, err)
+			continue
+		}
 
-	byteData, err := json.Marshal(mcCon)
-	if err != nil {
-		klog.Errorf("cannot marshal connector contract: %s\n", err)
-	}
+		if err := req.Body.Close(); err != nil {
+			klog.Errorf("cannot close response body: %s", err)
+		}
 
-	klog.Infof("start to make the http request; with data\n%s", string(byteData))
-	req, err := c.connector.Request("POST", "contract/", nil, strings.NewReader(string(byteData)))
-	if err != nil {
-		klog.Errorf("cannot upload contract to analysis cloud %s\n", err)
+		if req.StatusCode != 201 {
+			klog.Errorf("status code of post contract to target %s has not the expected value with %d", t.Name, req.StatusCode)
+		}
 	}
+}
 
-	if req.StatusCode != 201 {
-		klog.Errorf("status code of post contract has not the expected value with %d", req.StatusCode)
-	}
+// convertContract converts a contract into the contract of the analysis targets. Only the
+// enabled analysis systems, which are configured as target, are converted; false is
+// returned, if the contract has no such system.
+func (c *Contract) convertContract(mCon mqtt.Contract) (connection.Contract, bool) {
+	var systems []connection.ContractAnalysisSystem
+	for _, v := range mCon.Body.Analysis.Systems {
+		if !v.Enable || v.System == "" {
+			continue
+		}
 
-}
+		t, ok := c.targets.Get(v.System)
+		if !ok {
+			klog.Infof("analysis system %s of contract %s is not configured as target", v.System, mCon.Body.Contract.ID)
+			continue
+		}
 
-func (c Contract) convertContract(mCon mqtt.Contract) (connection.Contract, connection.ContractAnalysisSystem, bool) {
-	var analysisCloud connection.ContractAnalysisSystem
+		analysisSystem := connection.ContractAnalysisSystem{
+			System: v.System,
+			Enable: v.Enable,
+			Connection: connection.AnalysisConnection{
+				Container: connection.Container{
+					URL:         v.Connection.Container.URL,
+					Tag:         v.Connection.Container.Tag,
+					Arguments:   v.Connection.Container.Arguments,
+					Environment: v.Connection.Container.Environment,
+				},
+				Interval: v.Connection.Interval,
+				URL:      v.Connection.URL,
+				UserMgmt: v.Connection.UserMgmt,
+			},
+		}
+		// systems without interval are uploaded with the interval of the target
+		if analysisSystem.Connection.Interval == "" {
+			analysisSystem.Connection.Interval = t.Interval
+		}
 
-	found := false
-	for _, v := range mCon.Body.Analysis.Systems {
-		if v.System == "cloud" {
-			analysisCloud = connection.ContractAnalysisSystem{
-				System: v.System,
-				Enable: v.Enable,
-				Connection: connection.AnalysisConnection{
-					Container: connection.Container{
-						URL:         v.Connection.Container.URL,
-						Tag:         v.Connection.Container.Tag,
-						Arguments:   v.Connection.Container.Arguments,
-						Environment: v.Connection.Container.Environment,
+		for _, y := range v.Pipelines {
+			pipe := connection.Pipelines{
+				Sensor: y.Sensor,
+				MlTrigger: connection.PipelinesMlTrigger{
+					Type: y.MlTrigger.Type,
+					Definition: connection.PipelinesMlTriggerDefinition{
+						After: y.MlTrigger.Definition.After,
 					},
-					Interval: v.Connection.Interval,
-					URL:      v.Connection.URL,
-					UserMgmt: v.Connection.UserMgmt,
 				},
 			}
-			for _, y := range v.Pipelines {
-				pipe := connection.Pipelines{
-					Sensor: y.Sensor,
-					MlTrigger: connection.PipelinesMlTrigger{
-						Type: y.MlTrigger.Type,
-						Definition: connection.PipelinesMlTriggerDefinition{
-							After: y.MlTrigger.Definition.After,
-						},
+
+			for _, x := range y.Pipeline {
+				pip := connection.PipelinesPipeline{
+					Container: connection.Container{
+						URL:         x.Container.URL,
+						Tag:         x.Container.Tag,
+						Arguments:   x.Container.Arguments,
+						Environment: x.Container.Environment,
 					},
-				}
+					PersistOutput: x.PersistOutput,
 
-				for _, x := range y.Pipeline {
-					pip := connection.PipelinesPipeline{
-						Container: connection.Container{
-							URL:         x.Container.URL,
-							Tag:         x.Container.Tag,
-							Arguments:   x.Container.Arguments,
-							Environment: x.Container.Environment,
-						},
-						PersistOutput: x.PersistOutput,
-
-						From: (*connection.Model)(x.From),
-						To:   (*connection.Model)(x.To),
-					}
-					pipe.Pipeline = append(pipe.Pipeline, pip)
+					From: (*connection.Model)(x.From),
+					To:   (*connection.Model)(x.To),
 				}
-				analysisCloud.Pipelines = append(analysisCloud.Pipelines, pipe)
+				pipe.Pipeline = append(pipe.Pipeline, pip)
 			}
-			found = true
-			break
+			analysisSystem.Pipelines = append(analysisSystem.Pipelines, pipe)
 		}
+		systems = append(systems, analysisSystem)
 	}
 
-	if !found {
-		return connection.Contract{}, connection.ContractAnalysisSystem{}, false
-	}
-
-	if !analysisCloud.Enable || analysisCloud.System == "" {
-		klog.Infof("analysis cloud is not enabled in contract: %s", mCon.Body.Contract.ID)
-		return connection.Contract{}, connection.ContractAnalysisSystem{}, false
+	if len(systems) == 0 {
+		klog.Infof("no analysis target is enabled in contract: %s", mCon.Body.Contract.ID)
+		return connection.Contract{}, false
 	}
 
 	var cCon connection.Contract
 	cCon.Body.Analysis.Enable = mCon.Body.Analysis.Enable
-	cCon.Body.Analysis.Systems = append(cCon.Body.Analysis.Systems, analysisCloud)
+	cCon.Body.Analysis.Systems = systems
 
 	cCon.Body.Contract = connection.ContractInfos{
 		Valid: connection.ContractInfosValid{
@@ -246,6 +790,7 @@ func (c Contract) convertContract(mCon mqtt.Contract) (connection.Contract, conn
 	}
 
 	cCon.Body.Machine = mCon.Body.Machine
+	cCon.Body.CheckSignature = mCon.Body.CheckSignature
 	cCon.Body.KosmosLocalSystems = mCon.Body.KosmosLocalSystems
 
 	klog.Infof("count of sensors in the contract: %d", len(mCon.Body.Sensors))
@@ -262,80 +807,80 @@ func (c Contract) convertContract(mCon mqtt.Contract) (connection.Contract, conn
 		}
 		cCon.Body.Sensors = append(cCon.Body.Sensors, sensor)
 	}
-	return cCon, analysisCloud, true
+	return cCon, true
 }
 
 // createMessageHandler is the function that is called everytime a contract is sent to the MQTT-Topic
 // kosmos/contracts/create. The Contract is then parsed and written to the database as well as send
 // to the cloud.
-func (c Contract) createMessageHandler(client MQTT.Client, m MQTT.Message) {
+func (c *Contract) createMessageHandler(client MQTT.Client, m MQTT.Message) {
 	klog.Info("receive mqtt message to handle a contract")
 	klog.Infof("qos: %d, duplication: %t, messageID: %d", m.Qos(), m.Duplicate(), m.MessageID())
-	// Unmarshal received Contract into a Golang object
-	var mCon mqtt.Contract
-	if err := json.Unmarshal(m.Payload(), &mCon); err != nil {
-		klog.Errorf("can not unmarshal contract message: %s\n", err)
+	// Unmarshal received Contract into a Golang object and verify its signature
+	mCon, ok := c.parseContract(m.Topic(), m.Payload())
+	if !ok {
 		return
 	}
-	// Convert contract into parts which are relevant to the cloud e.g. pipelines
-	cCon, analysisCloud, found := c.convertContract(mCon)
-	if !found {
+	// A contract, which has already been stored, is updated to the received version
+	exists, err := db.ContractExists(c.db, mCon.Body.Contract.ID)
+	if err != nil {
+		klog.Errorf("Can not test if contract %s exists: %s", mCon.Body.Contract.ID, err)
+		return
+	}
+	if exists {
+		klog.Infof("contract %s already exists and will be updated", mCon.Body.Contract.ID)
+		c.updateContract(mCon, m.Payload())
 		return
 	}
-	// For every sensor in the contract...
-	for _, v := range cCon.Body.Sensors {
-
-		// ... store the sensor in the database...
-		if err := db.Insert(c.db, mCon.Body.Machine, v.Name, analysisCloud.Connection.Interval, c.version, mCon.Body.Contract.ID); err != nil {
-			klog.Errorf("Can not insert new contract into database: %s", err)
-			return
-		}
-
-		// ...parse the frequency with which data is sent to the cloud...
-		duration, err := time.ParseDuration(analysisCloud.Connection.Interval)
-		if err != nil {
-			klog.Errorf("Duration parsing uploading interval failed: %s", err)
-			continue
-		}
-
-		//... start a mqtt-handler which subscribes to the necessary data topics...
-		klog.Infof("start handle machine %s sensor %s and duration %s", mCon.Body.Machine, v.Name, duration)
-		sensor_mapper := SensorData{}
-		buf := c.uploader.GetBuffer()
-		mClient := mqtt.NewMqtt(client)
-		if err := sensor_mapper.Init(mClient, *buf, mCon.Body.Machine, v.Name); err != nil {
-			klog.Errorf("cannot create mapper on machine %s sensor %s and duration %v", mCon.Body.Machine, v.Name, duration)
-			return
-		}
 
-		// ...and start an upload-handler which sends the data to the cloud...
-		c.uploader.StartHandler(mCon.Body.Machine, v.Name, duration)
-		//...parse the minimal frequency per sensor so only that frequency is used...
-		dura, err := db.MinDuration(c.db, mCon.Body.Machine, v.Name, c.version)
-		if err != nil {
-			klog.Errorf("Can not receive minimal duration: %s\n", err)
-			return
-		}
+	c.createContract(mCon, m.Payload())
+}
 
-		// ...change the interval for the upload handler to the minimal frequency.
-		klog.Infof("Change interval...")
-		c.uploader.ChangeInterval(mCon.Body.Machine, v.Name, dura)
+// createContract stores a new contract and sends it to its targets
+func (c *Contract) createContract(mCon mqtt.Contract, payload []byte) {
+	// Inherit the settings of the parent contracts, which are not defined by the contract
+	resolved, err := c.resolveContract(mCon)
+	if err != nil {
+		klog.Errorf("Can not resolve contract %s: %s", mCon.Body.Contract.ID, err)
+		return
+	}
+	// Convert contract into parts which are relevant to the targets e.g. pipelines
+	cCon, found := c.convertContract(resolved)
+	if !found {
+		return
+	}
+	// Store the contract and start the handling of the sensor data during its validity
+	if err := c.storeContract(cCon, payload, nil); err != nil {
+		klog.Errorf("Can not store contract %s: %s", cCon.Body.Contract.ID, err)
+		c.unbind(cCon.Body.Contract.ID, cCon.Body.Analysis.Systems)
+		return
 	}
 
+	c.addHistory(cCon.Body.Contract.ID, cCon.Body.Contract.Version, "created", payload)
+
 	klog.Infof("Marshal JSON of new contract...")
-	byteData, err := json.Marshal(cCon)
-	if err != nil {
-		klog.Errorf("Cannot marshal connector contract: %s\n", err)
+	for t, byteData := range c.prepare(cCon) {
+		c.upload(t, cCon.Body.Contract.ID, "POST", "contract/", byteData, 201)
 	}
+}
 
-	klog.Infof("Start to make the http request; with data\n%s", string(byteData))
-	req, err := c.connector.Request("POST", "contract/", nil, strings.NewReader(string(byteData)))
+// upload sends a request of a contract to the endpoint of the contract at the target. The
+// requests of a contract are uploaded in order.
+func (c *Contract) upload(t *target.Target, contract, method, path string, data []byte, expected int) {
+	klog.Infof("Start to make the %s request against target %s; with data\n%s", method, t.Name, string(data))
+	req, err := t.For(contract).RequestOrdered(fmt.Sprintf("contract/%s", contract), method, path, nil, strings.NewReader(string(data)))
 	if err != nil {
-		klog.Errorf("Can not upload contract to analyses cloud: %s\n", err)
+		klog.Errorf("Can not upload contract %s to analyses target %s: %s\n", contract, t.Name, err)
 		return
 	}
 
-	if req.StatusCode != 201 {
-		klog.Errorf("status code of post contract has not the expected value with %d", req.StatusCode)
+	defer func() {
+		if err := req.Body.Close(); err != nil {
+			klog.Errorf("cannot close response body: %s", err)
+		}
+	}()
+
+	if req.StatusCode != expected {
+		klog.Errorf("status code of %s contract %s to target %s has not the expected value with %d", method, contract, t.Name, req.StatusCode)
 	}
 }
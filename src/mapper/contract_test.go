@@ -0,0 +1,96 @@
+package mapper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/connection"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/mqtt"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/target"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/uploader"
+)
+
+func TestConvertContract(t *testing.T) {
+	system := func(name string, enable bool, interval string) mqtt.ContractAnalysisSystem {
+		var s mqtt.ContractAnalysisSystem
+		s.System = name
+		s.Enable = enable
+		s.Connection.Interval = interval
+		return s
+	}
+
+	testTable := []struct {
+		description string
+		systems     []mqtt.ContractAnalysisSystem
+		expected    []string
+	}{
+		{
+			description: "every configured system",
+			systems:     []mqtt.ContractAnalysisSystem{system("cloud", true, "10s"), system("OnPrem", true, "")},
+			expected:    []string{"cloud 10s", "OnPrem 5m"},
+		},
+		{
+			description: "disabled and unknown systems",
+			systems:     []mqtt.ContractAnalysisSystem{system("cloud", false, "10s"), system("edge", true, "10s")},
+		},
+	}
+
+	c := &Contract{targets: target.NewRegistry(&target.Target{Name: "cloud", Interval: "1m"}, &target.Target{Name: "onprem", Interval: "5m"})}
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			var mCon mqtt.Contract
+			mCon.Body.Contract.ID = "contract"
+			mCon.Body.Analysis.Systems = test.systems
+
+			cCon, found := c.convertContract(mCon)
+			if found != (len(test.expected) > 0) {
+				t.Fatalf("unexpected conversion: %t", found)
+			}
+
+			var systems []string
+			for _, v := range cCon.Body.Analysis.Systems {
+				systems = append(systems, v.System+" "+v.Connection.Interval)
+			}
+			if !equalEvents(systems, test.expected) {
+				t.Errorf("unexpected analysis systems: %v != %v", systems, test.expected)
+			}
+		})
+	}
+}
+
+func TestSensorRetention(t *testing.T) {
+	testTable := []struct {
+		description string
+		durations   []connection.ContractSensorDuration
+		expected    uploader.Retention
+		expectErr   bool
+	}{
+		{
+			description: "edge and analysis",
+			durations: []connection.ContractSensorDuration{
+				{SystemName: "Edge", Duration: "1d"},
+				{SystemName: "analysis", Duration: "12h"},
+				{SystemName: "cloud", Duration: "forever"},
+			},
+			expected: uploader.Retention{Edge: 24 * time.Hour, Analysis: 12 * time.Hour},
+		},
+		{
+			description: "invalid duration",
+			durations:   []connection.ContractSensorDuration{{SystemName: "edge", Duration: "forever"}},
+			expectErr:   true,
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			retention, err := sensorRetention(connection.ContractSensor{Name: "sensor", StorageDuration: test.durations})
+			if (err != nil) != test.expectErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if retention != test.expected {
+				t.Errorf("unexpected retention: %v != %v", retention, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package mapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"k8s.io/klog"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/db"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/mqtt"
+)
+
+// DeletionPolicy defines how the deletion of a contract, which is the parent of other
+// contracts, is handled
+type DeletionPolicy string
+
+const (
+	// BlockChildren rejects the deletion of a contract as long as it has child contracts
+	BlockChildren DeletionPolicy = "block"
+	// CascadeChildren deletes the child contracts together with their parent
+	CascadeChildren DeletionPolicy = "cascade"
+)
+
+// resolveContract merges a contract with the chain of its parent contracts, which are
+// stored in the database. An error is returned, if a parent has not been stored or the
+// chain contains a cycle.
+func (c *Contract) resolveContract(mCon mqtt.Contract) (mqtt.Contract, error) {
+	visited := map[string]bool{mCon.Body.Contract.ID: true}
+	for parent := mCon.Body.Contract.ParentContract; parent != ""; {
+		if visited[parent] {
+			return mqtt.Contract{}, fmt.Errorf("parent contract %s is its own ancestor", parent)
+		}
+		visited[parent] = true
+
+		definition, err := db.ContractDefinition(c.db, parent)
+		if err != nil {
+			return mqtt.Contract{}, fmt.Errorf("cannot load parent contract %s: %s", parent, err)
+		}
+		if definition == nil {
+			return mqtt.Contract{}, fmt.Errorf("parent contract %s has not been stored", parent)
+		}
+
+		var pCon mqtt.Contract
+		if err := json.Unmarshal(definition, &pCon); err != nil {
+			return mqtt.Contract{}, fmt.Errorf("cannot unmarshal parent contract %s: %s", parent, err)
+		}
+
+		if mCon, err = mergeContracts(pCon, mCon); err != nil {
+			return mqtt.Contract{}, fmt.Errorf("cannot inherit from parent contract %s: %s", parent, err)
+		}
+		parent = pCon.Body.Contract.ParentContract
+	}
+	return mCon, nil
+}
+
+// mergeContracts returns the child contract, which inherits every setting from the parent,
+// that it does not define itself. The sensors and analysis systems of the parent are
+// inherited, if the child does not define a sensor or a system with the same name. The
+// validity of the child is limited by the validity of the parent.
+func mergeContracts(parent, child mqtt.Contract) (mqtt.Contract, error) {
+	merged := child
+	body := &merged.Body
+
+	valid, err := mergeValidity(parent.Body.Contract.Valid, child.Body.Contract.Valid)
+	if err != nil {
+		return mqtt.Contract{}, err
+	}
+	body.Contract.Valid = valid
+
+	if body.Contract.Partners == nil {
+		body.Contract.Partners = parent.Body.Contract.Partners
+	}
+	if body.Contract.Permissions.Read == nil {
+		body.Contract.Permissions.Read = parent.Body.Contract.Permissions.Read
+	}
+	if body.Contract.Permissions.Write == nil {
+		body.Contract.Permissions.Write = parent.Body.Contract.Permissions.Write
+	}
+
+	if body.Machine == "" {
+		body.Machine = parent.Body.Machine
+	}
+	if body.RequiredTechnicalContainers == nil {
+		body.RequiredTechnicalContainers = parent.Body.RequiredTechnicalContainers
+	}
+	if body.KosmosLocalSystems == nil {
+		body.KosmosLocalSystems = parent.Body.KosmosLocalSystems
+	}
+	// signed sensor updates required by the parent are required by the child, too
+	body.CheckSignature = body.CheckSignature || parent.Body.CheckSignature
+	if body.Blockchain == nil {
+		body.Blockchain = parent.Body.Blockchain
+	}
+	if body.MachineConnection == nil {
+		body.MachineConnection = parent.Body.MachineConnection
+	}
+	if body.Metadata == nil {
+		body.Metadata = parent.Body.Metadata
+	}
+
+	sensors := make(map[string]bool)
+	body.Sensors = append([]mqtt.ContractSensor(nil), child.Body.Sensors...)
+	for _, v := range child.Body.Sensors {
+		sensors[v.Name] = true
+	}
+	for _, v := range parent.Body.Sensors {
+		if !sensors[v.Name] {
+			body.Sensors = append(body.Sensors, v)
+		}
+	}
+
+	if len(child.Body.Analysis.Systems) == 0 {
+		body.Analysis = parent.Body.Analysis
+		return merged, nil
+	}
+
+	systems := make(map[string]bool)
+	body.Analysis.Systems = append([]mqtt.ContractAnalysisSystem(nil), child.Body.Analysis.Systems...)
+	for _, v := range child.Body.Analysis.Systems {
+		systems[strings.ToLower(v.System)] = true
+	}
+	for _, v := range parent.Body.Analysis.Systems {
+		if !systems[strings.ToLower(v.System)] {
+			body.Analysis.Systems = append(body.Analysis.Systems, v)
+		}
+	}
+	return merged, nil
+}
+
+// mergeValidity returns the validity of the child, which inherits the start or the end of
+// the parent, if it does not define them, and which is limited by the validity of the parent
+func mergeValidity(parent, child mqtt.ContractInfosValid) (mqtt.ContractInfosValid, error) {
+	parentStart, parentEnd, err := parseValidity(parent.Start, parent.End)
+	if err != nil {
+		return mqtt.ContractInfosValid{}, err
+	}
+
+	childStart, childEnd, err := parseValidity(child.Start, child.End)
+	if err != nil {
+		return mqtt.ContractInfosValid{}, err
+	}
+
+	valid := child
+	if child.Start == "" || (!parentStart.IsZero() && childStart.Before(parentStart)) {
+		valid.Start = parent.Start
+	}
+	if child.End == "" || (!parentEnd.IsZero() && childEnd.After(parentEnd)) {
+		valid.End = parent.End
+	}
+	return valid, nil
+}
+
+// descendants returns the children of a contract and their descendants; every child is
+// returned after its parent
+func (c *Contract) descendants(contract string) ([]string, error) {
+	var descendants []string
+	visited := map[string]bool{contract: true}
+	for queue := []string{contract}; len(queue) > 0; queue = queue[1:] {
+		children, err := db.ContractChildren(c.db, queue[0])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, child := range children {
+			if !visited[child] {
+				visited[child] = true
+				descendants = append(descendants, child)
+				queue = append(queue, child)
+			}
+		}
+	}
+	return descendants, nil
+}
+
+// inspection is the effective contract, which is returned by the inspection endpoint
+type inspection struct {
+	Contract string            `json:"contract"`
+	Parent   string            `json:"parent,omitempty"`
+	Children []string          `json:"children"`
+	Body     mqtt.ContractBody `json:"body"`
+}
+
+// ServeHTTP returns the effective contract of the path /contracts/<id> as json, which is
+// the contract merged with the chain of its parent contracts
+func (c *Contract) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	contract := strings.Trim(strings.TrimPrefix(req.URL.Path, "/contracts"), "/")
+	if contract == "" {
+		http.NotFound(w, req)
+		return
+	}
+
+	definition, err := db.ContractDefinition(c.db, contract)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if definition == nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	var mCon mqtt.Contract
+	if err := json.Unmarshal(definition, &mCon); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resolved, err := c.resolveContract(mCon)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	children, err := db.ContractChildren(c.db, contract)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(inspection{
+		Contract: contract,
+		Parent:   resolved.Body.Contract.ParentContract,
+		Children: children,
+		Body:     resolved.Body,
+	}); err != nil {
+		klog.Errorf("cannot encode contract %s: %s", contract, err)
+	}
+}
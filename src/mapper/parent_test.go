@@ -0,0 +1,87 @@
+package mapper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/mqtt"
+)
+
+func TestMergeContracts(t *testing.T) {
+	contract := func(machine, start, end string, sensors []string, systems ...string) mqtt.Contract {
+		var mCon mqtt.Contract
+		mCon.Body.Machine = machine
+		mCon.Body.Contract.Valid.Start = start
+		mCon.Body.Contract.Valid.End = end
+		for _, v := range sensors {
+			mCon.Body.Sensors = append(mCon.Body.Sensors, mqtt.ContractSensor{Name: v})
+		}
+		for _, v := range systems {
+			var system mqtt.ContractAnalysisSystem
+			system.System = v
+			mCon.Body.Analysis.Systems = append(mCon.Body.Analysis.Systems, system)
+		}
+		return mCon
+	}
+
+	parent := contract("machine", "2020-01-01T00:00:00Z", "2030-01-01T00:00:00Z", []string{"temperature", "pressure"}, "cloud", "onprem")
+
+	testTable := []struct {
+		description string
+		child       mqtt.Contract
+		expected    string
+		expectErr   bool
+	}{
+		{
+			description: "inherit every setting",
+			child:       contract("", "", "", nil),
+			expected:    "machine 2020-01-01T00:00:00Z 2030-01-01T00:00:00Z temperature,pressure cloud,onprem",
+		},
+		{
+			description: "override settings",
+			child:       contract("other", "2021-01-01T00:00:00Z", "2022-01-01T00:00:00Z", []string{"humidity", "temperature"}, "Cloud"),
+			expected:    "other 2021-01-01T00:00:00Z 2022-01-01T00:00:00Z humidity,temperature,pressure Cloud,onprem",
+		},
+		{
+			description: "validity limited by the parent",
+			child:       contract("", "2019-01-01T00:00:00Z", "2031-01-01T00:00:00Z", nil),
+			expected:    "machine 2020-01-01T00:00:00Z 2030-01-01T00:00:00Z temperature,pressure cloud,onprem",
+		},
+		{
+			description: "invalid validity",
+			child:       contract("", "tomorrow", "", nil),
+			expectErr:   true,
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			merged, err := mergeContracts(parent, test.child)
+			if (err != nil) != test.expectErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err != nil {
+				return
+			}
+
+			var sensors, systems []string
+			for _, v := range merged.Body.Sensors {
+				sensors = append(sensors, v.Name)
+			}
+			for _, v := range merged.Body.Analysis.Systems {
+				systems = append(systems, v.System)
+			}
+
+			result := strings.Join([]string{
+				merged.Body.Machine,
+				merged.Body.Contract.Valid.Start,
+				merged.Body.Contract.Valid.End,
+				strings.Join(sensors, ","),
+				strings.Join(systems, ","),
+			}, " ")
+			if result != test.expected {
+				t.Errorf("unexpected merged contract: %s != %s", result, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package mapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/klog"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/db"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/mqtt"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/uploader"
+)
+
+// Subscription describes a subscribed machine sensor combination and the contracts,
+// which require it
+type Subscription struct {
+	Machine         string   `json:"machine"`
+	Sensor          string   `json:"sensor"`
+	Contracts       []string `json:"contracts"`
+	CheckSignatures bool     `json:"checkSignatures"`
+	Routes          []string `json:"routes"`
+}
+
+// SensorRegistry counts the contracts of each machine sensor combination. The sensor
+// update topic is subscribed and the upload handler is started with the first contract,
+// both are stopped when the last contract is removed.
+type SensorRegistry struct {
+	mqtt     mqtt.Mqtt
+	uploader *uploader.Sensor
+	checks   Checks
+	lock     sync.Mutex
+	sensors  map[db.MachineSensor]*registration
+}
+
+type registration struct {
+	contracts map[string]subscriber
+	mapper    *SensorData
+}
+
+// subscriber contains the requirements of a contract on a machine sensor combination
+type subscriber struct {
+	routes          map[uploader.Route][]uploader.Trigger
+	checkSignatures bool
+}
+
+// checkSignatures returns true, if any contract requires signed sensor updates
+func (reg *registration) checkSignatures() bool {
+	for _, sub := range reg.contracts {
+		if sub.checkSignatures {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSensorRegistry initialise an empty sensor registry. The checks are applied on the
+// sensor updates.
+func NewSensorRegistry(mClient mqtt.Mqtt, upload *uploader.Sensor, checks Checks) *SensorRegistry {
+	return &SensorRegistry{
+		mqtt:     mClient,
+		uploader: upload,
+		checks:   checks,
+		sensors:  make(map[db.MachineSensor]*registration),
+	}
+}
+
+// Add registers the routes of a contract on a machine sensor combination. The data of
+// each route is uploaded, when one of its triggers fires, and sensor updates with an
+// invalid signature are dropped, if the contract requires signed updates.
+func (r *SensorRegistry) Add(contract, machine, sensor string, routes map[uploader.Route][]uploader.Trigger, checkSignatures bool) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if checkSignatures && r.checks.Verifier == nil {
+		klog.Warningf("contract %s requires signed sensor updates, but the signature verification is disabled", contract)
+	}
+
+	key := db.MachineSensor{Machine: machine, Sensor: sensor}
+	reg, ok := r.sensors[key]
+	if !ok {
+		klog.Infof("start handle machine %s sensor %s", machine, sensor)
+		sensorMapper := &SensorData{checks: r.checks, checkSignatures: checkSignatures}
+		if err := sensorMapper.Init(r.mqtt, r.uploader, machine, sensor); err != nil {
+			return err
+		}
+
+		reg = &registration{contracts: make(map[string]subscriber), mapper: sensorMapper}
+		r.sensors[key] = reg
+	}
+
+	// stop the routes of a previous registration, which are not required anymore
+	for route := range reg.contracts[contract].routes {
+		if _, ok := routes[route]; !ok {
+			r.stopRoute(machine, sensor, route)
+		}
+	}
+
+	reg.contracts[contract] = subscriber{routes: routes, checkSignatures: checkSignatures}
+	reg.mapper.setCheckSignatures(reg.checkSignatures())
+	for route, triggers := range routes {
+		r.uploader.ChangeTriggers(machine, sensor, route, triggers)
+	}
+	return nil
+}
+
+// Remove unregisters the routes of a contract from a machine sensor combination and
+// discards their buffered data. If it was the last contract, the topic is unsubscribed
+// and true is returned.
+func (r *SensorRegistry) Remove(contract, machine, sensor string) (bool, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	key := db.MachineSensor{Machine: machine, Sensor: sensor}
+	reg, ok := r.sensors[key]
+	if !ok {
+		return false, nil
+	}
+
+	sub, ok := reg.contracts[contract]
+	if !ok {
+		return false, nil
+	}
+
+	for route := range sub.routes {
+		r.stopRoute(machine, sensor, route)
+	}
+
+	delete(reg.contracts, contract)
+	if len(reg.contracts) > 0 {
+		reg.mapper.setCheckSignatures(reg.checkSignatures())
+		return false, nil
+	}
+
+	klog.Infof("stop handle machine %s sensor %s", machine, sensor)
+	delete(r.sensors, key)
+	return true, reg.mapper.Close(r.mqtt)
+}
+
+// stopRoute stops the upload of a route and discards its buffered data, which is not
+// required by the pipeline anymore
+func (r *SensorRegistry) stopRoute(machine, sensor string, route uploader.Route) {
+	r.uploader.Stop(machine, sensor, route)
+	if discarded := r.uploader.Discard(machine, sensor, route); discarded > 0 {
+		klog.Infof("discard %d buffered updates of machine %s sensor %s route %s", discarded, machine, sensor, route)
+	}
+}
+
+// Sensors returns the currently subscribed machine sensor combinations
+func (r *SensorRegistry) Sensors() []Subscription {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	subscriptions := []Subscription{}
+	for key, reg := range r.sensors {
+		sub := Subscription{Machine: key.Machine, Sensor: key.Sensor, CheckSignatures: reg.checkSignatures()}
+		for contract, s := range reg.contracts {
+			sub.Contracts = append(sub.Contracts, contract)
+			for route, triggers := range s.routes {
+				sub.Routes = append(sub.Routes, fmt.Sprintf("%s: %v", route, triggers))
+			}
+		}
+		sort.Strings(sub.Contracts)
+		sort.Strings(sub.Routes)
+		subscriptions = append(subscriptions, sub)
+	}
+
+	sort.Slice(subscriptions, func(i, j int) bool {
+		if subscriptions[i].Machine != subscriptions[j].Machine {
+			return subscriptions[i].Machine < subscriptions[j].Machine
+		}
+		return subscriptions[i].Sensor < subscriptions[j].Sensor
+	})
+	return subscriptions
+}
+
+// Contracts returns the contracts, which route a registered machine sensor combination
+// to the analysis target
+func (r *SensorRegistry) Contracts(target string) []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	found := make(map[string]bool)
+	contracts := []string{}
+	for _, reg := range r.sensors {
+		for contract, sub := range reg.contracts {
+			for route := range sub.routes {
+				if !found[contract] && strings.EqualFold(route.Target, target) {
+					found[contract] = true
+					contracts = append(contracts, contract)
+				}
+			}
+		}
+	}
+
+	sort.Strings(contracts)
+	return contracts
+}
+
+// ServeHTTP returns the subscribed machine sensor combinations as json
+func (r *SensorRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(r.Sensors()); err != nil {
+		klog.Errorf("cannot encode subscriptions: %s", err)
+	}
+}
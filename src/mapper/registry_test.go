@@ -0,0 +1,111 @@
+package mapper
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/buffer"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/mqtt"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/uploader"
+)
+
+// fakeClient is a mqtt client, which only records the subscribed topics
+type fakeClient struct {
+	MQTT.Client
+	subscribed map[string]bool
+}
+
+func (f *fakeClient) Subscribe(topic string, qos byte, callback MQTT.MessageHandler) MQTT.Token {
+	f.subscribed[topic] = true
+	return &MQTT.DummyToken{}
+}
+
+func (f *fakeClient) Unsubscribe(topics ...string) MQTT.Token {
+	for _, topic := range topics {
+		delete(f.subscribed, topic)
+	}
+	return &MQTT.DummyToken{}
+}
+
+func (f *fakeClient) topics() string {
+	var topics []string
+	for topic := range f.subscribed {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return strings.Join(topics, ",")
+}
+
+func TestSensorRegistry(t *testing.T) {
+	client := &fakeClient{subscribed: make(map[string]bool)}
+	var upload uploader.Sensor
+	upload.Init(buffer.NewLocalBuffer(), nil)
+	registry := NewSensorRegistry(mqtt.NewMqtt(client), &upload, Checks{})
+
+	hourly := []uploader.Trigger{{Type: uploader.TimeTrigger, Interval: time.Hour}}
+	counted := []uploader.Trigger{{Type: uploader.CountTrigger, Count: 10}}
+	contract1 := map[uploader.Route][]uploader.Trigger{{Target: "cloud", Contract: "contract1", Pipeline: 0}: hourly}
+	contract2 := map[uploader.Route][]uploader.Trigger{
+		{Target: "cloud", Contract: "contract2", Pipeline: 0}: counted,
+		{Target: "cloud", Contract: "contract2", Pipeline: 1}: hourly,
+	}
+	if err := registry.Add("contract1", "machine", "sensor", contract1, true); err != nil {
+		t.Fatalf("cannot add sensor: %s", err)
+	}
+	if err := registry.Add("contract2", "machine", "sensor", contract2, false); err != nil {
+		t.Fatalf("cannot add sensor: %s", err)
+	}
+	if err := registry.Add("contract2", "machine", "other", contract2, false); err != nil {
+		t.Fatalf("cannot add sensor: %s", err)
+	}
+
+	expected := "kosmos/machine-data/machine/sensor/other/update,kosmos/machine-data/machine/sensor/sensor/update"
+	if client.topics() != expected {
+		t.Errorf("unexpected subscribed topics: %s != %s", client.topics(), expected)
+	}
+
+	sensors := registry.Sensors()
+	if len(sensors) != 2 || sensors[1].Sensor != "sensor" || strings.Join(sensors[1].Contracts, ",") != "contract1,contract2" || !sensors[1].CheckSignatures ||
+		strings.Join(sensors[1].Routes, ",") != "cloud/contract1/0: [time after 1h0m0s],cloud/contract2/0: [count after 10],cloud/contract2/1: [time after 1h0m0s]" {
+		t.Errorf("unexpected registered sensors: %v", sensors)
+	}
+
+	if contracts := strings.Join(registry.Contracts("cloud"), ","); contracts != "contract1,contract2" {
+		t.Errorf("unexpected registered contracts: %s", contracts)
+	}
+
+	if contracts := registry.Contracts("onprem"); len(contracts) != 0 {
+		t.Errorf("unexpected registered contracts of an other target: %v", contracts)
+	}
+
+	last, err := registry.Remove("contract1", "machine", "sensor")
+	if err != nil || last {
+		t.Errorf("sensor is removed, although an other contract requires it: %t, %v", last, err)
+	}
+
+	if sensors := registry.Sensors(); sensors[1].CheckSignatures || strings.Join(sensors[1].Routes, ",") != "cloud/contract2/0: [count after 10],cloud/contract2/1: [time after 1h0m0s]" {
+		t.Errorf("requirements of the removed contract are still active: %v", sensors)
+	}
+
+	last, err = registry.Remove("contract2", "machine", "sensor")
+	if err != nil || !last {
+		t.Errorf("sensor is not removed with the last contract: %t, %v", last, err)
+	}
+
+	expected = "kosmos/machine-data/machine/sensor/other/update"
+	if client.topics() != expected {
+		t.Errorf("unexpected subscribed topics: %s != %s", client.topics(), expected)
+	}
+
+	if sensors := registry.Sensors(); len(sensors) != 1 {
+		t.Errorf("unexpected registered sensors: %v", sensors)
+	}
+
+	if _, err := registry.Remove("contract2", "machine", "other"); err != nil {
+		t.Errorf("cannot remove sensor: %s", err)
+	}
+}
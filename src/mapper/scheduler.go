@@ -0,0 +1,106 @@
+package mapper
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// Scheduler activates a contract at the begin of its validity and expires the contract
+// at the end of its validity
+type Scheduler struct {
+	lock     sync.Mutex
+	timers   map[string][]*time.Timer
+	activate func(contract string)
+	expire   func(contract string)
+}
+
+// NewScheduler initialise a scheduler with the functions, which are called on activation
+// and on expiration of a contract
+func NewScheduler(activate, expire func(contract string)) *Scheduler {
+	return &Scheduler{
+		timers:   make(map[string][]*time.Timer),
+		activate: activate,
+		expire:   expire,
+	}
+}
+
+// Schedule arms the timers of a contract; a zero start or end time is unbounded. A
+// contract, which is already valid, is activated immediately and an expired contract is
+// expired immediately.
+func (s *Scheduler) Schedule(contract string, start, end time.Time) {
+	s.Cancel(contract)
+
+	now := time.Now()
+	if !end.IsZero() && !now.Before(end) {
+		klog.Infof("contract %s has expired at %s", contract, end)
+		s.expire(contract)
+		return
+	}
+
+	s.lock.Lock()
+	if !start.IsZero() && now.Before(start) {
+		klog.Infof("contract %s will be activated at %s", contract, start)
+		s.timers[contract] = append(s.timers[contract], time.AfterFunc(start.Sub(now), func() {
+			klog.Infof("validity of contract %s begins", contract)
+			s.activate(contract)
+		}))
+	}
+
+	if !end.IsZero() {
+		klog.Infof("contract %s will expire at %s", contract, end)
+		s.timers[contract] = append(s.timers[contract], time.AfterFunc(end.Sub(now), func() {
+			klog.Infof("validity of contract %s ends", contract)
+			s.expire(contract)
+		}))
+	}
+	s.lock.Unlock()
+
+	if start.IsZero() || !now.Before(start) {
+		s.activate(contract)
+	}
+}
+
+// Cancel stops the timers of a contract
+func (s *Scheduler) Cancel(contract string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, timer := range s.timers[contract] {
+		timer.Stop()
+	}
+	delete(s.timers, contract)
+}
+
+// Stop stops the timers of all contracts
+func (s *Scheduler) Stop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for contract, timers := range s.timers {
+		for _, timer := range timers {
+			timer.Stop()
+		}
+		delete(s.timers, contract)
+	}
+}
+
+// parseValidity parses the validity window of a contract; an empty string is unbounded
+func parseValidity(start, end string) (time.Time, time.Time, error) {
+	var startTime, endTime time.Time
+	var err error
+	if start != "" {
+		if startTime, err = time.Parse(time.RFC3339, start); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+
+	if end != "" {
+		if endTime, err = time.Parse(time.RFC3339, end); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+
+	return startTime, endTime, nil
+}
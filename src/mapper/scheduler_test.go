@@ -0,0 +1,125 @@
+package mapper
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type scheduleRecorder struct {
+	lock   sync.Mutex
+	events []string
+}
+
+func (r *scheduleRecorder) record(event string) func(string) {
+	return func(contract string) {
+		r.lock.Lock()
+		r.events = append(r.events, event+" "+contract)
+		r.lock.Unlock()
+	}
+}
+
+func (r *scheduleRecorder) get() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string{}, r.events...)
+}
+
+func TestScheduler(t *testing.T) {
+	testTable := []struct {
+		description string
+		start       time.Duration
+		end         time.Duration
+		immediately []string
+		later       []string
+	}{
+		{
+			description: "unbounded contract",
+			immediately: []string{"activate contract"},
+			later:       []string{"activate contract"},
+		},
+		{
+			description: "valid contract",
+			start:       -time.Hour,
+			end:         50 * time.Millisecond,
+			immediately: []string{"activate contract"},
+			later:       []string{"activate contract", "expire contract"},
+		},
+		{
+			description: "future contract",
+			start:       20 * time.Millisecond,
+			end:         50 * time.Millisecond,
+			later:       []string{"activate contract", "expire contract"},
+		},
+		{
+			description: "expired contract",
+			start:       -time.Hour,
+			end:         -time.Minute,
+			immediately: []string{"expire contract"},
+			later:       []string{"expire contract"},
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			var recorder scheduleRecorder
+			scheduler := NewScheduler(recorder.record("activate"), recorder.record("expire"))
+			var start, end time.Time
+			if test.start != 0 {
+				start = time.Now().Add(test.start)
+			}
+			if test.end != 0 {
+				end = time.Now().Add(test.end)
+			}
+			scheduler.Schedule("contract", start, end)
+
+			if !equalEvents(recorder.get(), test.immediately) {
+				t.Errorf("unexpected immediate events: %v != %v", recorder.get(), test.immediately)
+			}
+
+			time.Sleep(150 * time.Millisecond)
+			if !equalEvents(recorder.get(), test.later) {
+				t.Errorf("unexpected events: %v != %v", recorder.get(), test.later)
+			}
+		})
+	}
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	var recorder scheduleRecorder
+	scheduler := NewScheduler(recorder.record("activate"), recorder.record("expire"))
+	scheduler.Schedule("contract", time.Now().Add(20*time.Millisecond), time.Time{})
+	scheduler.Cancel("contract")
+
+	time.Sleep(50 * time.Millisecond)
+	if events := recorder.get(); len(events) != 0 {
+		t.Errorf("canceled contract has been activated: %v", events)
+	}
+}
+
+func TestParseValidity(t *testing.T) {
+	start, end, err := parseValidity("2020-01-01T00:00:00Z", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !start.Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)) || !end.IsZero() {
+		t.Errorf("unexpected validity: %s - %s", start, end)
+	}
+
+	if _, _, err := parseValidity("", "tomorrow"); err == nil {
+		t.Errorf("expected error on invalid end")
+	}
+}
+
+func equalEvents(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
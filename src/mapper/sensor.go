@@ -3,6 +3,7 @@ package mapper
 import (
 	"encoding/json"
 	"fmt"
+	"sync"
 
 	MQTT "github.com/eclipse/paho.mqtt.golang"
 	"k8s.io/klog"
@@ -10,38 +11,97 @@ import (
 	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/buffer"
 	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/connection"
 	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/mqtt"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/reject"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/schema"
 )
 
 // SensorData is the logic to handle sensor update data
 type SensorData struct {
 	machine string
 	sensor  string
-	buffer  buffer.Data
-	//exitChan chan bool TODO enable an unsubscribe mechanism
+	buffer  buffer.Inserter
+
+	checks          Checks
+	lock            sync.Mutex
+	checkSignatures bool
 }
 
 // Init initialize the SensorData handler
-func (s SensorData) Init(mClient mqtt.Mqtt, buf buffer.Data, machine, sensor string) error {
+func (s *SensorData) Init(mClient mqtt.Mqtt, buf buffer.Inserter, machine, sensor string) error {
 	s.machine = machine
 	s.sensor = sensor
 	s.buffer = buf
 
-	if err := mClient.Subscribe(fmt.Sprintf("kosmos/machine-data/%s/sensor/%s/update", s.machine, s.sensor), s.handler); err != nil {
+	if err := mClient.Subscribe(s.topic(), s.handler); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (s SensorData) handler(client MQTT.Client, m MQTT.Message) {
+// Close unsubscribe the sensor update topic
+func (s *SensorData) Close(mClient mqtt.Mqtt) error {
+	return mClient.Unsubscribe(s.topic())
+}
+
+// setCheckSignatures defines if the signatures of the sensor updates are verified
+func (s *SensorData) setCheckSignatures(check bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.checkSignatures = check
+}
+
+// verified returns false, if the signature of a sensor update has to be verified and
+// cannot be verified
+func (s *SensorData) verified(m MQTT.Message) bool {
+	s.lock.Lock()
+	check := s.checkSignatures
+	s.lock.Unlock()
+
+	if !check || s.checks.Verifier == nil {
+		return true
+	}
+
+	var signed struct {
+		Body      json.RawMessage `json:"body"`
+		Signature string          `json:"signature"`
+	}
+
+	err := json.Unmarshal(m.Payload(), &signed)
+	if err == nil {
+		err = verify(s.checks.Verifier, "sensor", signed.Body, signed.Signature, "")
+	}
+
+	if err != nil {
+		s.checks.Rejecter.Reject("sensor", reject.Signature, m.Topic(), m.Payload(), err)
+		return false
+	}
+	return true
+}
+
+func (s *SensorData) topic() string {
+	return fmt.Sprintf("kosmos/machine-data/%s/sensor/%s/update", s.machine, s.sensor)
+}
+
+func (s *SensorData) handler(client MQTT.Client, m MQTT.Message) {
 	klog.Infof("a sensor handle message received for machine %s sensor %s and topic:\n\t%s", s.machine, s.sensor, m.Topic())
 	var (
 		mData mqtt.SensorData
 		cData connection.SensorData
 	)
 
+	if err := s.checks.Validator.Validate(schema.SensorUpdate, m.Payload()); err != nil {
+		s.checks.Rejecter.Reject("sensor", reject.Schema, m.Topic(), m.Payload(), err)
+		return
+	}
+
+	if !s.verified(m) {
+		return
+	}
+
 	if err := json.Unmarshal(m.Payload(), &mData); err != nil {
 		klog.Errorf("cannot unmarshal sensor upload data: %s", err)
+		return
 	}
 
 	for _, column := range mData.Body.Columns {
@@ -0,0 +1,150 @@
+package mapper
+
+import (
+	"testing"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/buffer"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/schema"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/signature"
+)
+
+// fakeMessage is a mqtt message with a fixed topic and payload
+type fakeMessage struct {
+	MQTT.Message
+	topic   string
+	payload []byte
+}
+
+func (f fakeMessage) Topic() string {
+	return f.topic
+}
+
+func (f fakeMessage) Payload() []byte {
+	return f.payload
+}
+
+// fakeVerifier accepts only the signature "valid"
+type fakeVerifier struct{}
+
+func (fakeVerifier) Verify(data []byte, sig, algorithm string) error {
+	switch sig {
+	case "":
+		return signature.ErrUnsigned
+	case "valid":
+		return nil
+	}
+	return signature.ErrInvalid
+}
+
+func TestSensorDataSignature(t *testing.T) {
+	testTable := []struct {
+		description     string
+		checkSignatures bool
+		signature       string
+		buffered        int
+	}{
+		{
+			description: "signatures are not checked",
+			signature:   "invalid",
+			buffered:    1,
+		},
+		{
+			description:     "valid signature",
+			checkSignatures: true,
+			signature:       "valid",
+			buffered:        1,
+		},
+		{
+			description:     "invalid signature",
+			checkSignatures: true,
+			signature:       "invalid",
+		},
+		{
+			description:     "unsigned update",
+			checkSignatures: true,
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			buf := buffer.NewLocalBuffer()
+			sensorData := &SensorData{
+				machine:         "machine",
+				sensor:          "sensor",
+				buffer:          buf,
+				checks:          Checks{Verifier: fakeVerifier{}},
+				checkSignatures: test.checkSignatures,
+			}
+
+			sensorData.handler(nil, fakeMessage{
+				topic:   sensorData.topic(),
+				payload: []byte(`{"body":{"timestamp":"2021-01-01T00:00:00Z"},"signature":"` + test.signature + `"}`),
+			})
+
+			if values := buf.GetValues("machine", "sensor"); len(values) != test.buffered {
+				t.Errorf("unexpected number of buffered updates: %d != %d", len(values), test.buffered)
+			}
+		})
+	}
+}
+
+func TestSensorDataSchema(t *testing.T) {
+	validator, err := schema.NewValidatorFromSchemas(map[string]string{
+		schema.SensorUpdate: `{
+			"type": "object",
+			"required": ["body"],
+			"properties": {
+				"body": {
+					"type": "object",
+					"required": ["timestamp", "columns", "data"],
+					"properties": {
+						"data": {"type": "array", "items": {"type": "array", "items": {"type": "string"}}}
+					}
+				}
+			}
+		}`,
+	})
+	if err != nil {
+		t.Fatalf("cannot compile schemas: %s", err)
+	}
+
+	testTable := []struct {
+		description string
+		payload     string
+		buffered    int
+	}{
+		{
+			description: "valid update",
+			payload:     `{"body":{"timestamp":"2021-01-01T00:00:00Z","columns":[{"name":"a","type":"number"}],"data":[["1"]]}}`,
+			buffered:    1,
+		},
+		{
+			description: "update without data",
+			payload:     `{"body":{"timestamp":"2021-01-01T00:00:00Z","columns":[]}}`,
+		},
+		{
+			description: "no json",
+			payload:     `update`,
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			buf := buffer.NewLocalBuffer()
+			sensorData := &SensorData{
+				machine: "machine",
+				sensor:  "sensor",
+				buffer:  buf,
+				checks:  Checks{Validator: validator},
+			}
+
+			sensorData.handler(nil, fakeMessage{topic: sensorData.topic(), payload: []byte(test.payload)})
+
+			if values := buf.GetValues("machine", "sensor"); len(values) != test.buffered {
+				t.Errorf("unexpected number of buffered updates: %d != %d", len(values), test.buffered)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package mapper
+
+import (
+	"fmt"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/connection"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/uploader"
+)
+
+// sensorRoutes returns the pipelines of a contract on an analysis system, which analyse the
+// sensor, with their ml-triggers; a pipeline without sensors analyses every sensor and a
+// pipeline without ml-trigger is uploaded with the interval of the connection. A sensor,
+// which is not analysed by any pipeline, has no route.
+func sensorRoutes(contract string, system connection.ContractAnalysisSystem, sensor string) (map[uploader.Route][]uploader.Trigger, error) {
+	routes := make(map[uploader.Route][]uploader.Trigger)
+	for i, pipeline := range system.Pipelines {
+		if !analyses(pipeline, sensor) {
+			continue
+		}
+
+		triggerType, after := pipeline.MlTrigger.Type, pipeline.MlTrigger.Definition.After
+		if triggerType == "" {
+			triggerType, after = uploader.TimeTrigger, system.Connection.Interval
+		}
+
+		trigger, err := uploader.ParseTrigger(triggerType, after)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ml-trigger of pipeline %d: %s", i, err)
+		}
+		routes[uploader.Route{Target: system.System, Contract: contract, Pipeline: i}] = []uploader.Trigger{trigger}
+	}
+
+	return routes, nil
+}
+
+// analyses returns true, if the pipeline analyses the sensor
+func analyses(pipeline connection.Pipelines, sensor string) bool {
+	if len(pipeline.Sensor) == 0 {
+		return true
+	}
+
+	for _, v := range pipeline.Sensor {
+		if v == sensor {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package mapper
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/connection"
+)
+
+func TestSensorRoutes(t *testing.T) {
+	pipeline := func(triggerType, after string, sensors ...string) connection.Pipelines {
+		return connection.Pipelines{
+			Sensor: sensors,
+			MlTrigger: connection.PipelinesMlTrigger{
+				Type:       triggerType,
+				Definition: connection.PipelinesMlTriggerDefinition{After: after},
+			},
+		}
+	}
+
+	testTable := []struct {
+		description string
+		pipelines   []connection.Pipelines
+		expected    []string
+		expectErr   bool
+	}{
+		{
+			description: "no pipeline",
+		},
+		{
+			description: "pipelines of the sensor",
+			pipelines: []connection.Pipelines{
+				pipeline("count", "100", "sensor"),
+				pipeline("event", "state=error", "sensor", "other"),
+				pipeline("time", "10s", "other"),
+			},
+			expected: []string{"cloud/contract/0: [count after 100]", "cloud/contract/1: [event on state=error]"},
+		},
+		{
+			description: "pipeline of all sensors",
+			pipelines:   []connection.Pipelines{pipeline("time", "10s")},
+			expected:    []string{"cloud/contract/0: [time after 10s]"},
+		},
+		{
+			description: "pipeline without trigger",
+			pipelines:   []connection.Pipelines{pipeline("", "", "sensor")},
+			expected:    []string{"cloud/contract/0: [time after 1m0s]"},
+		},
+		{
+			description: "invalid trigger",
+			pipelines:   []connection.Pipelines{pipeline("count", "many", "sensor")},
+			expectErr:   true,
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			system := connection.ContractAnalysisSystem{
+				System:     "cloud",
+				Pipelines:  test.pipelines,
+				Connection: connection.AnalysisConnection{Interval: "1m"},
+			}
+
+			routes, err := sensorRoutes("contract", system, "sensor")
+			if (err != nil) != test.expectErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var names []string
+			for route, triggers := range routes {
+				names = append(names, fmt.Sprintf("%s: %v", route, triggers))
+			}
+			sort.Strings(names)
+			if !equalEvents(names, test.expected) {
+				t.Errorf("unexpected routes: %v != %v", names, test.expected)
+			}
+		})
+	}
+}
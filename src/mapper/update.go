@@ -0,0 +1,350 @@
+package mapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"k8s.io/klog"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/connection"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/db"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/mqtt"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/target"
+)
+
+// contractDiff contains the changes between two versions of a contract
+type contractDiff struct {
+	oldVersion     string
+	newVersion     string
+	addedSensors   []db.MachineSensor
+	removedSensors []db.MachineSensor
+	// changedSensors are the remaining sensors with a changed storage duration or meta data
+	changedSensors []db.MachineSensor
+	addedSystems   []string
+	removedSystems []string
+	// intervals are the systems with a changed upload interval
+	intervals []string
+	// systems are the systems with changed pipelines or endpoints
+	systems []string
+	// infos is true, if the validity, the partners, the permissions or the signature
+	// requirement have been changed
+	infos bool
+}
+
+// diffContracts compares the stored version of a contract with its stored machine sensor
+// combinations against a new version
+func diffContracts(old connection.Contract, oldSensors []db.MachineSensor, new connection.Contract) contractDiff {
+	diff := contractDiff{oldVersion: old.Body.Contract.Version, newVersion: new.Body.Contract.Version}
+
+	newSensors := make(map[db.MachineSensor]bool)
+	for _, v := range new.Body.Sensors {
+		newSensors[db.MachineSensor{Machine: new.Body.Machine, Sensor: v.Name}] = true
+	}
+
+	stored := make(map[db.MachineSensor]bool)
+	for _, v := range oldSensors {
+		stored[v] = true
+		if !newSensors[v] {
+			diff.removedSensors = append(diff.removedSensors, v)
+		}
+	}
+
+	oldDefinitions := make(map[string]connection.ContractSensor)
+	for _, v := range old.Body.Sensors {
+		oldDefinitions[v.Name] = v
+	}
+
+	for _, v := range new.Body.Sensors {
+		key := db.MachineSensor{Machine: new.Body.Machine, Sensor: v.Name}
+		if !stored[key] {
+			diff.addedSensors = append(diff.addedSensors, key)
+			continue
+		}
+
+		oldSensor := oldDefinitions[v.Name]
+		if !reflect.DeepEqual(oldSensor.StorageDuration, v.StorageDuration) || !reflect.DeepEqual(oldSensor.Meta, v.Meta) {
+			diff.changedSensors = append(diff.changedSensors, key)
+		}
+	}
+
+	oldSystems := systemsByName(old.Body.Analysis.Systems)
+	newSystems := systemsByName(new.Body.Analysis.Systems)
+	for name, system := range newSystems {
+		oldSystem, ok := oldSystems[name]
+		// the names of the systems are compared case-insensitive
+		oldSystem.System = system.System
+		switch {
+		case !ok:
+			diff.addedSystems = append(diff.addedSystems, system.System)
+		case oldSystem.Connection.Interval != system.Connection.Interval:
+			diff.intervals = append(diff.intervals, system.System)
+		case !reflect.DeepEqual(oldSystem, system):
+			diff.systems = append(diff.systems, system.System)
+		}
+	}
+
+	for name, system := range oldSystems {
+		if _, ok := newSystems[name]; !ok {
+			diff.removedSystems = append(diff.removedSystems, system.System)
+		}
+	}
+
+	sort.Strings(diff.addedSystems)
+	sort.Strings(diff.removedSystems)
+	sort.Strings(diff.intervals)
+	sort.Strings(diff.systems)
+
+	diff.infos = !reflect.DeepEqual(old.Body.Contract.Valid, new.Body.Contract.Valid) ||
+		!reflect.DeepEqual(old.Body.Contract.Partners, new.Body.Contract.Partners) ||
+		!reflect.DeepEqual(old.Body.Contract.Permissions, new.Body.Contract.Permissions) ||
+		old.Body.CheckSignature != new.Body.CheckSignature
+	return diff
+}
+
+// systemsByName returns the analysis systems by their case-insensitive names
+func systemsByName(systems []connection.ContractAnalysisSystem) map[string]connection.ContractAnalysisSystem {
+	byName := make(map[string]connection.ContractAnalysisSystem)
+	for _, v := range systems {
+		byName[strings.ToLower(v.System)] = v
+	}
+	return byName
+}
+
+// empty returns true, if the versions of the contract do not differ
+func (d contractDiff) empty() bool {
+	return d.oldVersion == d.newVersion && len(d.addedSensors) == 0 && len(d.removedSensors) == 0 &&
+		len(d.changedSensors) == 0 && len(d.addedSystems) == 0 && len(d.removedSystems) == 0 && len(d.intervals) == 0 &&
+		len(d.systems) == 0 && !d.infos
+}
+
+// added returns true, if the analysis system has been added to the contract
+func (d contractDiff) added(system string) bool {
+	for _, v := range d.addedSystems {
+		if strings.EqualFold(v, system) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d contractDiff) String() string {
+	sensors := func(list []db.MachineSensor) string {
+		var names []string
+		for _, v := range list {
+			names = append(names, v.Machine+"/"+v.Sensor)
+		}
+		return strings.Join(names, ", ")
+	}
+
+	var changes []string
+	if d.oldVersion != d.newVersion {
+		changes = append(changes, fmt.Sprintf("version %s -> %s", d.oldVersion, d.newVersion))
+	}
+	if len(d.addedSensors) > 0 {
+		changes = append(changes, "added sensors "+sensors(d.addedSensors))
+	}
+	if len(d.removedSensors) > 0 {
+		changes = append(changes, "removed sensors "+sensors(d.removedSensors))
+	}
+	if len(d.changedSensors) > 0 {
+		changes = append(changes, "changed sensors "+sensors(d.changedSensors))
+	}
+	if len(d.addedSystems) > 0 {
+		changes = append(changes, "added systems "+strings.Join(d.addedSystems, ", "))
+	}
+	if len(d.removedSystems) > 0 {
+		changes = append(changes, "disabled systems "+strings.Join(d.removedSystems, ", "))
+	}
+	if len(d.intervals) > 0 {
+		changes = append(changes, "changed interval of "+strings.Join(d.intervals, ", "))
+	}
+	if len(d.systems) > 0 {
+		changes = append(changes, "changed systems "+strings.Join(d.systems, ", "))
+	}
+	if d.infos {
+		changes = append(changes, "changed contract infos")
+	}
+
+	if len(changes) == 0 {
+		return "no changes"
+	}
+	return strings.Join(changes, "; ")
+}
+
+// updateMessageHandler is called with a new version of a contract, which is sent to the
+// topic kosmos/contracts/update
+func (c *Contract) updateMessageHandler(client MQTT.Client, m MQTT.Message) {
+	klog.Info("receive mqtt message to update a contract")
+	mCon, ok := c.parseContract(m.Topic(), m.Payload())
+	if !ok {
+		return
+	}
+
+	c.updateContract(mCon, m.Payload())
+}
+
+// storedVersion is the stored version of a contract with its machine sensor combinations
+type storedVersion struct {
+	contract *connection.Contract
+	sensors  []db.MachineSensor
+}
+
+// loadVersion returns the stored version of a contract
+func (c *Contract) loadVersion(contract string) (storedVersion, error) {
+	stored, err := c.storedContract(contract)
+	if err != nil {
+		return storedVersion{}, err
+	}
+	if stored == nil {
+		// contracts stored without definition have been sent to the default target
+		stored = &connection.Contract{}
+		stored.Body.Analysis.Systems = []connection.ContractAnalysisSystem{{System: target.Default}}
+	}
+
+	sensors, err := db.GetMachineSensorFromContract(c.db, contract)
+	if err != nil {
+		return storedVersion{}, err
+	}
+	return storedVersion{contract: stored, sensors: sensors}, nil
+}
+
+// updateContract applies a new version of a stored contract and of its child contracts,
+// which inherit from it. A contract, which has not been stored, is created.
+func (c *Contract) updateContract(mCon mqtt.Contract, payload []byte) {
+	contract := mCon.Body.Contract.ID
+	exists, err := db.ContractExists(c.db, contract)
+	if err != nil {
+		klog.Errorf("cannot test if contract %s exists: %s", contract, err)
+		return
+	}
+	if !exists {
+		klog.Infof("contract %s does not exist and will be created", contract)
+		c.createContract(mCon, payload)
+		return
+	}
+
+	stored, err := c.loadVersion(contract)
+	if err != nil {
+		klog.Errorf("cannot load stored contract %s: %s", contract, err)
+		return
+	}
+
+	// the stored versions of the children are loaded before the parent is changed
+	children, err := c.descendants(contract)
+	if err != nil {
+		klog.Errorf("cannot get children of contract %s: %s", contract, err)
+	}
+	versions := make(map[string]storedVersion)
+	for _, child := range children {
+		if versions[child], err = c.loadVersion(child); err != nil {
+			klog.Errorf("cannot load stored contract %s: %s", child, err)
+			delete(versions, child)
+		}
+	}
+
+	c.applyUpdate(mCon, payload, stored)
+
+	for _, child := range children {
+		version, ok := versions[child]
+		if !ok {
+			continue
+		}
+
+		// children, which have been deleted with their parent, are skipped
+		definition, err := db.ContractDefinition(c.db, child)
+		if err != nil || definition == nil {
+			continue
+		}
+
+		var childCon mqtt.Contract
+		if err := json.Unmarshal(definition, &childCon); err != nil {
+			klog.Errorf("cannot unmarshal contract %s: %s", child, err)
+			continue
+		}
+
+		klog.Infof("update child contract %s of contract %s", child, contract)
+		c.applyUpdate(childCon, definition, version)
+	}
+}
+
+// applyUpdate compares a new version of a contract with the stored version. The new version
+// is validated and stored, before the removed sensors are unregistered, the routes of the
+// remaining sensors are changed and the new version is put to the targets. A contract, whose analysis is disabled, is deleted.
+func (c *Contract) applyUpdate(mCon mqtt.Contract, payload []byte, stored storedVersion) {
+	contract := mCon.Body.Contract.ID
+	resolved, err := c.resolveContract(mCon)
+	if err != nil {
+		klog.Errorf("cannot resolve contract %s: %s", contract, err)
+		return
+	}
+
+	cCon, found := c.convertContract(resolved)
+	if !found {
+		if c.blocked(contract) {
+			klog.Errorf("analysis of contract %s has been disabled, the stored version is kept", contract)
+			return
+		}
+		klog.Infof("analysis of contract %s has been disabled, the contract is deleted", contract)
+		c.addHistory(contract, mCon.Body.Contract.Version, "analysis disabled", payload)
+		c.deleteContract(contract)
+		return
+	}
+
+	diff := diffContracts(*stored.contract, stored.sensors, cCon)
+	if diff.empty() {
+		klog.Infof("contract %s has not been changed", contract)
+		return
+	}
+	klog.Infof("update contract %s: %s", contract, diff)
+
+	// the new version is validated and stored together with the removal of the sensors and
+	// its history, so a version, which cannot be applied, leaves the stored version intact
+	err = c.storeContract(cCon, payload, func(exec db.Executor) error {
+		for _, v := range diff.removedSensors {
+			if err := db.RemoveContractSensor(exec, contract, v.Machine, v.Sensor); err != nil {
+				return fmt.Errorf("cannot remove machine %s sensor %s: %s", v.Machine, v.Sensor, err)
+			}
+		}
+		return db.AddContractHistory(exec, contract, cCon.Body.Contract.Version, diff.String(), payload)
+	})
+	if err != nil {
+		klog.Errorf("cannot apply version %s of contract %s, the stored version is kept: %s", cCon.Body.Contract.Version, contract, err)
+		// the endpoints of the stored version are assigned again
+		if err := c.bind(contract, stored.contract.Body.Analysis.Systems); err != nil {
+			klog.Errorf("cannot restore the endpoints of contract %s: %s", contract, err)
+		}
+		return
+	}
+
+	for _, v := range diff.removedSensors {
+		if _, err := c.registry.Remove(contract, v.Machine, v.Sensor); err != nil {
+			klog.Errorf("cannot unsubscribe machine %s sensor %s: %s", v.Machine, v.Sensor, err)
+		}
+	}
+
+	for _, system := range diff.removedSystems {
+		if t, ok := c.targets.Get(system); ok {
+			c.upload(t, contract, "DELETE", fmt.Sprintf("contract/%s", contract), nil, 204)
+			t.Unbind(contract)
+		}
+	}
+
+	for t, data := range c.prepare(cCon) {
+		if diff.added(t.Name) {
+			c.upload(t, contract, "POST", "contract/", data, 201)
+		} else {
+			c.upload(t, contract, "PUT", fmt.Sprintf("contract/%s", contract), data, 200)
+		}
+	}
+}
+
+// addHistory stores a version of a contract in the contract history
+func (c *Contract) addHistory(contract, version, changes string, definition []byte) {
+	if err := db.AddContractHistory(c.db, contract, version, changes, definition); err != nil {
+		klog.Errorf("cannot store history of contract %s: %s", contract, err)
+	}
+}
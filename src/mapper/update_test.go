@@ -0,0 +1,216 @@
+package mapper
+
+import (
+	"fmt"
+	"testing"
+
+	dbMock "github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/connection"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/db"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/mqtt"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/target"
+)
+
+func TestDiffContracts(t *testing.T) {
+	contract := func(version, interval string, systems ...string) connection.Contract {
+		var cCon connection.Contract
+		cCon.Body.Contract.Version = version
+		cCon.Body.Machine = "machine"
+		cCon.Body.Sensors = []connection.ContractSensor{{Name: "temperature"}, {Name: "pressure"}}
+		for _, v := range systems {
+			var system connection.ContractAnalysisSystem
+			system.System = v
+			system.Connection.Interval = interval
+			cCon.Body.Analysis.Systems = append(cCon.Body.Analysis.Systems, system)
+		}
+		return cCon
+	}
+
+	sensors := []db.MachineSensor{{Machine: "machine", Sensor: "temperature"}, {Machine: "machine", Sensor: "pressure"}}
+	old := contract("1", "1m", "cloud")
+
+	testTable := []struct {
+		description string
+		oldSensors  []db.MachineSensor
+		new         connection.Contract
+		expected    string
+	}{
+		{
+			description: "unchanged contract",
+			oldSensors:  sensors,
+			new:         contract("1", "1m", "Cloud"),
+			expected:    "no changes",
+		},
+		{
+			description: "changed sensors",
+			oldSensors:  []db.MachineSensor{{Machine: "machine", Sensor: "temperature"}, {Machine: "machine", Sensor: "humidity"}},
+			new:         contract("2", "1m", "cloud"),
+			expected:    "version 1 -> 2; added sensors machine/pressure; removed sensors machine/humidity",
+		},
+		{
+			description: "changed systems",
+			oldSensors:  sensors,
+			new:         contract("2", "10s", "cloud", "onprem"),
+			expected:    "version 1 -> 2; added systems onprem; changed interval of cloud",
+		},
+		{
+			description: "disabled system",
+			oldSensors:  sensors,
+			new:         contract("2", "1m", "onprem"),
+			expected:    "version 1 -> 2; added systems onprem; disabled systems cloud",
+		},
+		{
+			description: "changed storage duration and meta data",
+			oldSensors:  sensors,
+			new: func() connection.Contract {
+				cCon := contract("1", "1m", "cloud")
+				cCon.Body.Sensors[0].StorageDuration = []connection.ContractSensorDuration{{SystemName: "edge", Duration: "1h"}}
+				cCon.Body.Sensors[1].Meta = map[string]interface{}{"unit": "bar"}
+				return cCon
+			}(),
+			expected: "changed sensors machine/temperature, machine/pressure",
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			diff := diffContracts(old, test.oldSensors, test.new)
+			if diff.String() != test.expected {
+				t.Errorf("unexpected changes: %s != %s", diff, test.expected)
+			}
+
+			if diff.empty() != (test.expected == "no changes") {
+				t.Errorf("unexpected empty diff: %t", diff.empty())
+			}
+		})
+	}
+}
+
+func TestApplyInvalidUpdate(t *testing.T) {
+	version := func(interval, end, duration string) mqtt.Contract {
+		var mCon mqtt.Contract
+		mCon.Body.Contract.ID = "contract"
+		mCon.Body.Contract.Version = "2"
+		mCon.Body.Contract.Valid.End = end
+		mCon.Body.Machine = "machine"
+		mCon.Body.Sensors = []mqtt.ContractSensor{{Name: "a", StorageDuration: []mqtt.ContractSensorDuration{{SystemName: "edge", Duration: duration}}}}
+
+		var system mqtt.ContractAnalysisSystem
+		system.System = "cloud"
+		system.Enable = true
+		system.Connection.Interval = interval
+		mCon.Body.Analysis.Systems = []mqtt.ContractAnalysisSystem{system}
+		return mCon
+	}
+
+	testTable := []struct {
+		description string
+		contract    mqtt.Contract
+		failingDb   bool
+	}{
+		{
+			description: "invalid interval",
+			contract:    version("soon", "", "1d"),
+		},
+		{
+			description: "expired validity",
+			contract:    version("1m", "2000-01-01T00:00:00Z", "1d"),
+		},
+		{
+			description: "invalid storage duration",
+			contract:    version("1m", "", "forever"),
+		},
+		{
+			description: "failing database",
+			contract:    version("1m", "", "1d"),
+			failingDb:   true,
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			database, mock, err := dbMock.New(dbMock.QueryMatcherOption(dbMock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer database.Close()
+
+			if test.failingDb {
+				mock.ExpectBegin()
+				mock.ExpectExec("DELETE FROM contract_machine_sensor WHERE contract = $1 AND machine_sensor IN (SELECT id FROM machine_sensor WHERE machine = $2 AND sensor = $3)").
+					WithArgs("contract", "machine", "b").
+					WillReturnError(fmt.Errorf("connection lost"))
+				mock.ExpectRollback()
+			}
+
+			// the registry is nil, so the test fails, if a sensor is unregistered
+			c := &Contract{targets: target.NewRegistry(&target.Target{Name: "cloud", Interval: "1m"}), db: database}
+
+			stored := &connection.Contract{}
+			stored.Body.Contract.ID = "contract"
+			stored.Body.Contract.Version = "1"
+			stored.Body.Machine = "machine"
+			stored.Body.Analysis.Systems = []connection.ContractAnalysisSystem{{System: "cloud"}}
+			sensors := []db.MachineSensor{{Machine: "machine", Sensor: "a"}, {Machine: "machine", Sensor: "b"}}
+
+			c.applyUpdate(test.contract, []byte("{}"), storedVersion{contract: stored, sensors: sensors})
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unexpected database calls: %s", err)
+			}
+		})
+	}
+}
+
+func TestBlockedDeletion(t *testing.T) {
+	testTable := []struct {
+		description string
+		delete      func(c *Contract)
+		sensors     bool
+	}{
+		{
+			description: "expired contract",
+			delete: func(c *Contract) {
+				c.expireContract("contract")
+			},
+			sensors: true,
+		},
+		{
+			description: "analysis disabled",
+			delete: func(c *Contract) {
+				var mCon mqtt.Contract
+				mCon.Body.Contract.ID = "contract"
+				mCon.Body.Contract.Version = "2"
+				c.applyUpdate(mCon, []byte("{}"), storedVersion{contract: &connection.Contract{}})
+			},
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			database, mock, err := dbMock.New(dbMock.QueryMatcherOption(dbMock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer database.Close()
+
+			mock.ExpectQuery("SELECT contract FROM contract WHERE parent = $1 ORDER BY contract").
+				WithArgs("contract").
+				WillReturnRows(dbMock.NewRows([]string{"contract"}).AddRow("child"))
+			if test.sensors {
+				mock.ExpectQuery("SELECT machine, sensor FROM machine_sensor JOIN contract_machine_sensor ON machine_sensor = id WHERE contract = $1").
+					WithArgs("contract").
+					WillReturnRows(dbMock.NewRows([]string{"machine", "sensor"}))
+			}
+
+			// the scheduler is nil, so the test fails, if the contract is deleted
+			c := &Contract{targets: target.NewRegistry(&target.Target{Name: "cloud", Interval: "1m"}), db: database, deletion: BlockChildren}
+			test.delete(c)
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unexpected database calls: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package mapper
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/reject"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/schema"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/signature"
+)
+
+var signatureVerifications = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "analysis_connector_signature_verifications_total",
+	Help: "The number of verified message signatures by result",
+}, []string{"kind", "result"})
+
+// Checks contains the optional checks of the incoming and outgoing messages; a nil
+// verifier, signer or validator disables the check
+type Checks struct {
+	Verifier  signature.Verifier
+	Signer    signature.Signer
+	Validator *schema.Validator
+	Rejecter  *reject.Rejecter
+}
+
+// verify verifies the signature of a message body and counts the result
+func verify(verifier signature.Verifier, kind string, body []byte, sig, algorithm string) error {
+	err := verifier.Verify(body, sig, algorithm)
+	switch err {
+	case nil:
+		signatureVerifications.WithLabelValues(kind, "valid").Inc()
+	case signature.ErrUnsigned:
+		signatureVerifications.WithLabelValues(kind, "unsigned").Inc()
+	default:
+		signatureVerifications.WithLabelValues(kind, "invalid").Inc()
+	}
+	return err
+}
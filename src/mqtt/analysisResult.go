@@ -0,0 +1,22 @@
+package mqtt
+
+// AnalysisModel is the model, which calculated an analysis result
+type AnalysisModel struct {
+	URL string `json:"url"`
+	Tag string `json:"tag"`
+}
+
+// AnalysisResultBody contains the body of an analysis result
+type AnalysisResultBody struct {
+	From       string        `json:"from"`
+	Timestamp  string        `json:"timestamp"`
+	Model      AnalysisModel `json:"model"`
+	Type       string        `json:"type"`
+	Calculated interface{}   `json:"calculated"`
+}
+
+// AnalysisResult is the analysis result message, which is published on the edge
+type AnalysisResult struct {
+	Body      AnalysisResultBody `json:"body"`
+	Signature interface{}        `json:"signature,omitempty"`
+}
@@ -3,6 +3,7 @@ package mqtt
 import (
 	"crypto/tls"
 	"fmt"
+	"sync"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"k8s.io/klog"
@@ -11,12 +12,20 @@ import (
 // Mqtt contains the mqtt functionality
 type Mqtt struct {
 	client mqtt.Client
+	topics *topics
+}
+
+// topics contains the subscribed topics, it is shared between copies of a Mqtt object
+type topics struct {
+	lock       sync.Mutex
+	subscribed map[string]bool
 }
 
 // NewMqtt returns a mqtt.Mqtt object from a paho MQTT.Client
 func NewMqtt(client mqtt.Client) Mqtt {
 	var mq Mqtt
 	mq.client = client
+	mq.topics = &topics{subscribed: make(map[string]bool)}
 	return mq
 }
 
@@ -36,6 +45,7 @@ func (m *Mqtt) Connect(url, user, password, clientID string, port int, tlsConfig
 	}
 
 	m.client = mqtt.NewClient(options)
+	m.topics = &topics{subscribed: make(map[string]bool)}
 	token := m.client.Connect()
 	if token.Wait() && token.Error() != nil {
 		return token.Error()
@@ -50,6 +60,10 @@ func (m *Mqtt) Subscribe(topic string, callbackFunc mqtt.MessageHandler) error {
 	if token.Wait() && token.Error() != nil {
 		return token.Error()
 	}
+
+	m.topics.lock.Lock()
+	m.topics.subscribed[topic] = true
+	m.topics.lock.Unlock()
 	return nil
 }
 
@@ -60,9 +74,35 @@ func (m *Mqtt) Unsubscribe(topic ...string) error {
 		return token.Error()
 	}
 
+	m.topics.lock.Lock()
+	for _, t := range topic {
+		delete(m.topics.subscribed, t)
+	}
+	m.topics.lock.Unlock()
 	return nil
 }
 
+// Topics returns all subscribed topics
+func (m *Mqtt) Topics() []string {
+	m.topics.lock.Lock()
+	defer m.topics.lock.Unlock()
+
+	var topics []string
+	for topic := range m.topics.subscribed {
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+// UnsubscribeAll unsubscribe of all subscribed topics
+func (m *Mqtt) UnsubscribeAll() error {
+	topics := m.Topics()
+	if len(topics) == 0 {
+		return nil
+	}
+	return m.Unsubscribe(topics...)
+}
+
 // Send a mqtt message to a specifc topic
 func (m *Mqtt) Send(topic string, msg []byte) error {
 	token := m.client.Publish(topic, 2, false, msg)
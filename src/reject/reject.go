@@ -0,0 +1,81 @@
+// Package reject counts rejected messages and publishes them on a mqtt topic
+package reject
+
+import (
+	"encoding/json"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"k8s.io/klog"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/mqtt"
+)
+
+// The reasons of a rejection
+const (
+	Signature = "signature"
+	Schema    = "schema"
+)
+
+var rejectedMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "analysis_connector_rejected_messages_total",
+	Help: "The number of rejected messages",
+}, []string{"kind", "reason"})
+
+// Reporter is implemented by errors, which contain a detailed report
+type Reporter interface {
+	Report() []string
+}
+
+// Rejection is published on the topic of the reason, if a message is rejected
+type Rejection struct {
+	Kind    string   `json:"kind"`
+	Reason  string   `json:"reason"`
+	Error   string   `json:"error"`
+	Report  []string `json:"report,omitempty"`
+	Topic   string   `json:"topic"`
+	Payload string   `json:"payload"`
+}
+
+// Rejecter counts rejected messages and publishes them on the topic of the reason
+type Rejecter struct {
+	mqtt   mqtt.Mqtt
+	topics map[string]string
+}
+
+// NewRejecter initialise a rejecter with the topic of each reason; a reason without topic
+// is only counted
+func NewRejecter(mClient mqtt.Mqtt, topics map[string]string) *Rejecter {
+	return &Rejecter{mqtt: mClient, topics: topics}
+}
+
+// Reject counts and publishes a rejected message. A nil rejecter only counts the message.
+func (r *Rejecter) Reject(kind, reason, topic string, payload []byte, err error) {
+	klog.Errorf("reject %s message of topic %s because of %s: %s", kind, topic, reason, err)
+	rejectedMessages.WithLabelValues(kind, reason).Inc()
+
+	if r == nil || r.topics[reason] == "" {
+		return
+	}
+
+	rejection := Rejection{
+		Kind:    kind,
+		Reason:  reason,
+		Error:   err.Error(),
+		Topic:   topic,
+		Payload: string(payload),
+	}
+	if reporter, ok := err.(Reporter); ok {
+		rejection.Report = reporter.Report()
+	}
+
+	data, mErr := json.Marshal(rejection)
+	if mErr != nil {
+		klog.Errorf("cannot marshal rejection: %s", mErr)
+		return
+	}
+
+	if err := r.mqtt.Send(r.topics[reason], data); err != nil {
+		klog.Errorf("cannot publish rejection: %s", err)
+	}
+}
@@ -0,0 +1,161 @@
+// Package results fetches the analysis results of the contracts from the analysis targets
+// and publishes them on the edge
+package results
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"k8s.io/klog"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/connection"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/db"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/mqtt"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/target"
+)
+
+var publishedResults = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "analysis_connector_published_results_total",
+	Help: "The number of analysis results published on the edge",
+}, []string{"target", "contract"})
+
+// Poller polls the analysis results of the active contracts of an analysis target
+type Poller struct {
+	target    *target.Target
+	mqtt      mqtt.Mqtt
+	db        *sql.DB
+	contracts func() []string
+	interval  time.Duration
+	done      chan struct{}
+}
+
+// NewPoller initialise a poller, which polls the results of the contracts returned by the
+// contracts function from the endpoints of the contracts at the target
+func NewPoller(t *target.Target, mClient mqtt.Mqtt, db *sql.DB, contracts func() []string, interval time.Duration) *Poller {
+	return &Poller{
+		target:    t,
+		mqtt:      mClient,
+		db:        db,
+		contracts: contracts,
+		interval:  interval,
+		done:      make(chan struct{}),
+	}
+}
+
+// Run polls the results until the poller is stopped
+func (p *Poller) Run() {
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-time.After(p.interval):
+		}
+
+		for _, contract := range p.contracts() {
+			if err := p.poll(contract); err != nil {
+				klog.Errorf("cannot poll results of contract %s from target %s: %s", contract, p.target.Name, err)
+			}
+		}
+	}
+}
+
+// Stop stops the polling
+func (p *Poller) Stop() {
+	close(p.done)
+}
+
+// Topic returns the topic, on which the results of a contract are published
+func Topic(contract string) string {
+	return fmt.Sprintf("kosmos/analyses/%s", contract)
+}
+
+// poll publishes the new results of a contract in the order of their ids
+func (p *Poller) poll(contract string) error {
+	last, err := db.LastResult(p.db, contract, p.target.Name)
+	if err != nil {
+		return err
+	}
+
+	var all []connection.AnalysisAll
+	if err := p.get(contract, fmt.Sprintf("analysis/%s", contract), &all); err != nil {
+		return err
+	}
+
+	sort.Slice(all, func(i, j int) bool { return all[i].ResultID < all[j].ResultID })
+	for _, v := range all {
+		if v.ResultID <= last {
+			continue
+		}
+
+		var result connection.AnalysisMsg
+		if err := p.get(contract, fmt.Sprintf("analysis/%s/%d", contract, v.ResultID), &result); err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(convert(result))
+		if err != nil {
+			return err
+		}
+
+		if err := p.mqtt.Send(Topic(contract), data); err != nil {
+			return err
+		}
+		publishedResults.WithLabelValues(p.target.Name, contract).Inc()
+		klog.Infof("published result %d of contract %s from target %s", v.ResultID, contract, p.target.Name)
+
+		if err := db.SetLastResult(p.db, contract, p.target.Name, v.ResultID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// get fetches a resource from the endpoint of the contract and unmarshals the json response
+func (p *Poller) get(contract, path string, v interface{}) error {
+	res, err := p.target.For(contract).Get(path, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			klog.Errorf("cannot close response body: %s", err)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d of %s", res.StatusCode, path)
+	}
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// convert converts an analysis result of the target into the edge result format
+func convert(msg connection.AnalysisMsg) mqtt.AnalysisResult {
+	return mqtt.AnalysisResult{
+		Body: mqtt.AnalysisResultBody{
+			From:      msg.Body.From,
+			Timestamp: msg.Body.Timestamp,
+			Model: mqtt.AnalysisModel{
+				URL: msg.Body.Model.URL,
+				Tag: msg.Body.Model.Tag,
+			},
+			Type:       msg.Body.Type,
+			Calculated: msg.Body.Calculated,
+		},
+		Signature: msg.Signature,
+	}
+}
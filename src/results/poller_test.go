@@ -0,0 +1,82 @@
+package results
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	dbMock "github.com/DATA-DOG/go-sqlmock"
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/connection"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/mqtt"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/target"
+)
+
+// fakeClient is a mqtt client, which records the published messages
+type fakeClient struct {
+	MQTT.Client
+	published map[string][]string
+}
+
+func (f *fakeClient) Publish(topic string, qos byte, retained bool, payload interface{}) MQTT.Token {
+	f.published[topic] = append(f.published[topic], string(payload.([]byte)))
+	return &MQTT.DummyToken{}
+}
+
+func TestPoll(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/analysis/contract":
+			fmt.Fprint(w, `[{"resultId":3,"machine":"machine"},{"resultId":1,"machine":"machine"},{"resultId":2,"machine":"machine"}]`)
+		case "/analysis/contract/2", "/analysis/contract/3":
+			fmt.Fprintf(w, `{"body":{"from":"cloud","timestamp":"2021-01-01T00:00:00Z","model":{"url":"model","tag":"%s"},"type":"text","calculated":{"message":"ok"}}}`, r.URL.Path)
+		default:
+			t.Errorf("unexpected request of %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	db, mock, err := dbMock.New(dbMock.QueryMatcherOption(dbMock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("cannot open database mock: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT last_result FROM analysis_result WHERE contract = $1 AND target = $2").
+		WithArgs("contract", "cloud").
+		WillReturnRows(dbMock.NewRows([]string{"last_result"}).AddRow(1))
+	for _, id := range []int{2, 3} {
+		mock.ExpectExec("INSERT INTO analysis_result (contract, target, last_result) VALUES ($1, $2, $3) ON CONFLICT (contract, target) DO UPDATE SET last_result = $3").
+			WithArgs("contract", "cloud", id).
+			WillReturnResult(dbMock.NewResult(0, 1))
+	}
+
+	client := &fakeClient{published: make(map[string][]string)}
+	poller := NewPoller(&target.Target{Name: "cloud", Connection: connection.NewConnection(ts.URL, nil, nil)}, mqtt.NewMqtt(client), db, nil, 0)
+	if err := poller.poll("contract"); err != nil {
+		t.Fatalf("cannot poll results: %s", err)
+	}
+
+	published := client.published["kosmos/analyses/contract"]
+	if len(published) != 2 {
+		t.Fatalf("unexpected number of published results: %d", len(published))
+	}
+
+	for i, tag := range []string{"/analysis/contract/2", "/analysis/contract/3"} {
+		var result mqtt.AnalysisResult
+		if err := json.Unmarshal([]byte(published[i]), &result); err != nil {
+			t.Fatalf("cannot unmarshal published result: %s", err)
+		}
+		if result.Body.Model.Tag != tag || result.Body.Type != "text" {
+			t.Errorf("unexpected published result: %s", published[i])
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("not all expectaions were met: %s\n", err)
+	}
+}
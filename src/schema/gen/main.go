@@ -0,0 +1,108 @@
+// gen embeds the json schemas of the kosmos-json-specifications into a go source file.
+// Every file with the suffix -schema.json is embedded with its relative path without the
+// suffix as name.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/schema"
+)
+
+const suffix = "-schema.json"
+
+func main() {
+	spec := flag.String("spec", "../../kosmos-json-specifications", "is the directory of the json specifications")
+	out := flag.String("out", "schemas.go", "is the generated go source file")
+	flag.Parse()
+
+	src, err := generate(*spec)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot generate the schemas: %s\n", err)
+		os.Exit(1)
+	}
+
+	if err := ioutil.WriteFile(*out, src, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "cannot write %s: %s\n", *out, err)
+		os.Exit(1)
+	}
+}
+
+// generate returns the go source file, which embeds the schemas of the specifications; the
+// schemas, which are required by the validator, have to be part of the specifications
+func generate(spec string) ([]byte, error) {
+	schemas := make(map[string]string)
+	err := filepath.Walk(spec, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, suffix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(spec, path)
+		if err != nil {
+			return err
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		schemas[filepath.ToSlash(strings.TrimSuffix(rel, suffix))] = string(data)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the specifications: %s", err)
+	}
+
+	for _, name := range schema.Required {
+		if _, ok := schemas[name]; !ok {
+			return nil, fmt.Errorf("specifications %s contain no schema %s%s", spec, name, suffix)
+		}
+	}
+
+	names := make([]string, 0, len(schemas))
+	for name := range schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by go run ./gen; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package schema\n\n")
+	fmt.Fprintf(&buf, "func init() {\n")
+	fmt.Fprintf(&buf, "schemas = map[string]string{\n")
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%q: %s,\n", name, literal(schemas[name]))
+	}
+	fmt.Fprintf(&buf, "}\n}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("cannot format the generated source: %s", err)
+	}
+
+	// the generated schemas have to be compilable by the validator
+	if _, err := schema.NewValidatorFromSchemas(schemas); err != nil {
+		return nil, err
+	}
+	return src, nil
+}
+
+// literal returns a raw string literal, if the schema does not contain a backtick
+func literal(source string) string {
+	if strings.Contains(source, "`") {
+		return strconv.Quote(source)
+	}
+	return "`" + source + "`"
+}
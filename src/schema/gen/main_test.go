@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	src, err := generate(filepath.Join("..", "testdata", "spec"))
+	if err != nil {
+		t.Fatalf("cannot generate the schemas: %s", err)
+	}
+
+	for _, name := range []string{"common/column", "mqtt_payloads/sensorUpdate", "http_payloads/machineData"} {
+		if !strings.Contains(string(src), `"`+name+`": `) {
+			t.Errorf("schema %s is not embedded", name)
+		}
+	}
+}
+
+func TestGenerateIncomplete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "mqtt_payloads"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "mqtt_payloads", "contract-schema.json"), []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := generate(dir); err == nil {
+		t.Errorf("schemas are generated without the required schemas")
+	}
+
+	if _, err := generate(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("schemas are generated without specifications")
+	}
+}
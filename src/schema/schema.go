@@ -0,0 +1,113 @@
+// Package schema validates the messages against the json schemas of the
+// kosmos-json-specifications
+package schema
+
+//go:generate go run ./gen -spec ../../kosmos-json-specifications -out schemas.go
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// The names of the embedded schemas
+const (
+	Contract         = "mqtt_payloads/contract"
+	ContractRemove   = "mqtt_payloads/contractRemove"
+	SensorUpdate     = "mqtt_payloads/sensorUpdate"
+	AnalysisContract = "http_payloads/contract"
+	MachineData      = "http_payloads/machineData"
+)
+
+// Required are the names of the schemas, which are used to validate the messages
+var Required = []string{Contract, ContractRemove, SensorUpdate, AnalysisContract, MachineData}
+
+// schemas are the json schemas of the kosmos-json-specifications by their names; they are
+// embedded by go generate into schemas.go, which is not checked in
+var schemas map[string]string
+
+// ValidationError contains the violations of a message against a schema
+type ValidationError struct {
+	Schema     string
+	Violations []string
+}
+
+func (v *ValidationError) Error() string {
+	return fmt.Sprintf("message violates schema %s: %s", v.Schema, strings.Join(v.Violations, "; "))
+}
+
+// Report returns the violations of the schema
+func (v *ValidationError) Report() []string {
+	return v.Violations
+}
+
+// Validator validates messages against the embedded schemas
+type Validator struct {
+	schemas map[string]*gojsonschema.Schema
+}
+
+// NewValidator compiles the embedded schemas; the schemas have to be generated from the
+// kosmos-json-specifications before the build, e.g. with make schemas
+func NewValidator() (*Validator, error) {
+	for _, name := range Required {
+		if _, ok := schemas[name]; !ok {
+			return nil, fmt.Errorf("schema %s is not embedded, generate the schemas with make schemas", name)
+		}
+	}
+	return NewValidatorFromSchemas(schemas)
+}
+
+// NewValidatorFromSchemas compiles the schemas by their names. A schema can reference the
+// other schemas with their relative file names, e.g. ../common/date-schema.json.
+func NewValidatorFromSchemas(sources map[string]string) (*Validator, error) {
+	v := &Validator{schemas: make(map[string]*gojsonschema.Schema)}
+	for name := range sources {
+		loader := gojsonschema.NewSchemaLoader()
+		for other, source := range sources {
+			if err := loader.AddSchema(schemaURL(other), gojsonschema.NewStringLoader(source)); err != nil {
+				return nil, fmt.Errorf("cannot load schema %s: %s", other, err)
+			}
+		}
+
+		compiled, err := loader.Compile(gojsonschema.NewReferenceLoader(schemaURL(name)))
+		if err != nil {
+			return nil, fmt.Errorf("cannot compile schema %s: %s", name, err)
+		}
+		v.schemas[name] = compiled
+	}
+	return v, nil
+}
+
+// schemaURL returns the address of a schema, under which it is referenced by the others
+func schemaURL(name string) string {
+	return "file:///" + name + "-schema.json"
+}
+
+// Validate validates the json data against the named schema and returns a
+// *ValidationError, if the data violates the schema. A nil validator accepts every message.
+func (v *Validator) Validate(name string, data []byte) error {
+	if v == nil {
+		return nil
+	}
+
+	schema, ok := v.schemas[name]
+	if !ok {
+		return fmt.Errorf("unknown schema %s", name)
+	}
+
+	result, err := schema.Validate(gojsonschema.NewBytesLoader(data))
+	if err != nil {
+		return &ValidationError{Schema: name, Violations: []string{err.Error()}}
+	}
+
+	if result.Valid() {
+		return nil
+	}
+
+	violations := make([]string, 0, len(result.Errors()))
+	for _, e := range result.Errors() {
+		violations = append(violations, e.String())
+	}
+	return &ValidationError{Schema: name, Violations: violations}
+}
@@ -0,0 +1,136 @@
+package schema
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testSchemas returns the schemas of the test specifications by their names
+func testSchemas(t *testing.T) map[string]string {
+	sources := make(map[string]string)
+	spec := filepath.Join("testdata", "spec")
+	err := filepath.Walk(spec, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(spec, path)
+		if err != nil {
+			return err
+		}
+		sources[filepath.ToSlash(strings.TrimSuffix(rel, "-schema.json"))] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("cannot read the test specifications: %s", err)
+	}
+	return sources
+}
+
+func TestValidate(t *testing.T) {
+	validator, err := NewValidatorFromSchemas(testSchemas(t))
+	if err != nil {
+		t.Fatalf("cannot compile schemas: %s", err)
+	}
+
+	testTable := []struct {
+		description string
+		schema      string
+		data        string
+		valid       bool
+	}{
+		{
+			description: "valid contract",
+			schema:      Contract,
+			data:        `{"body":{"contract":{"id":"contract"},"machine":"machine","sensors":[{"name":"sensor"}]},"signature":{"signature":"","meta":{"date":"","algorithm":""}}}`,
+			valid:       true,
+		},
+		{
+			description: "contract without id",
+			schema:      Contract,
+			data:        `{"body":{"contract":{},"machine":"machine","sensors":[]}}`,
+		},
+		{
+			description: "valid contract removal",
+			schema:      ContractRemove,
+			data:        `{"body":{"contract":"contract"}}`,
+			valid:       true,
+		},
+		{
+			description: "valid sensor update",
+			schema:      SensorUpdate,
+			data:        `{"body":{"timestamp":"2021-01-01T00:00:00Z","columns":[{"name":"a","type":"number"}],"data":[["1"]]}}`,
+			valid:       true,
+		},
+		{
+			description: "sensor update with a column without type",
+			schema:      SensorUpdate,
+			data:        `{"body":{"timestamp":"2021-01-01T00:00:00Z","columns":[{"name":"a"}],"data":[["1"]]}}`,
+		},
+		{
+			description: "sensor update with numeric data",
+			schema:      SensorUpdate,
+			data:        `{"body":{"timestamp":"2021-01-01T00:00:00Z","columns":[],"data":[[1]]}}`,
+		},
+		{
+			description: "valid machine data",
+			schema:      MachineData,
+			data:        `[{"body":{"timestamp":"","machineID":"machine","sensor":"sensor","columns":null,"data":[["1"]],"from":""}}]`,
+			valid:       true,
+		},
+		{
+			description: "analysis contract without system",
+			schema:      AnalysisContract,
+			data:        `{"body":{"contract":{"id":"contract"},"machine":"machine","analysis":{"systems":[]}}}`,
+		},
+		{
+			description: "no json",
+			schema:      ContractRemove,
+			data:        `contract`,
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			err := validator.Validate(test.schema, []byte(test.data))
+			if test.valid {
+				if err != nil {
+					t.Errorf("unexpected validation error: %s", err)
+				}
+				return
+			}
+
+			vErr, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatalf("expected validation error, got: %v", err)
+			}
+			if len(vErr.Report()) == 0 {
+				t.Errorf("validation error without report")
+			}
+		})
+	}
+}
+
+func TestNilValidator(t *testing.T) {
+	var validator *Validator
+	if err := validator.Validate(Contract, []byte("invalid")); err != nil {
+		t.Errorf("disabled validator rejects message: %s", err)
+	}
+}
+
+func TestNewValidatorWithoutSchemas(t *testing.T) {
+	embedded := schemas
+	defer func() { schemas = embedded }()
+
+	schemas = map[string]string{Contract: `{}`}
+	if _, err := NewValidator(); err == nil {
+		t.Errorf("validator is created without the required schemas")
+	}
+}
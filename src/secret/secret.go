@@ -0,0 +1,133 @@
+// Package secret contains the logic to read the secrets of the configuration from files and
+// to redact them in dumps of the configuration
+package secret
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"k8s.io/klog"
+)
+
+// FileSuffix is appended to the config string of a secret to define the file, which
+// contains the secret, e.g. edge.database.password_file
+const FileSuffix = "_file"
+
+// Mask replaces the secrets, which are set, in the dumps of the configuration
+const Mask = "*****"
+
+// Resolve reads the secrets, whose file is configured, from their files; a secret file
+// takes precedence over the secret itself. Trailing line breaks of the files are removed.
+func Resolve(vi *viper.Viper, keys []string) error {
+	for _, key := range keys {
+		if vi.GetString(key+FileSuffix) == "" {
+			continue
+		}
+
+		value, err := Read(vi, key)
+		if err != nil {
+			return err
+		}
+		vi.Set(key, value)
+	}
+	return nil
+}
+
+// Read returns the current value of a secret; a configured secret file is read again, so
+// that changed secrets are used without a restart
+func Read(vi *viper.Viper, key string) (string, error) {
+	file := vi.GetString(key + FileSuffix)
+	if file == "" {
+		return vi.GetString(key), nil
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("cannot read secret %s: %s", key, err)
+	}
+
+	klog.V(2).Infof("read secret %s from %s", key, file)
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Watch calls changed in every interval, in which one of the secret files has been
+// modified; files, which cannot be checked, are retried in the next interval
+func Watch(files []string, interval time.Duration, changed func()) {
+	if interval <= 0 || len(files) == 0 {
+		return
+	}
+
+	modified := modTimes(files)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			current := modTimes(files)
+			if !modifiedSince(current, modified) {
+				continue
+			}
+
+			for file, t := range current {
+				modified[file] = t
+			}
+			changed()
+		}
+	}()
+}
+
+// modTimes returns the modification times of the files, which can be checked
+func modTimes(files []string) map[string]time.Time {
+	modified := make(map[string]time.Time)
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			klog.Errorf("cannot check secret file %s: %s", file, err)
+			continue
+		}
+		modified[file] = info.ModTime()
+	}
+	return modified
+}
+
+// modifiedSince tests if a file has been modified or could be checked for the first time;
+// a file, which cannot be checked anymore, keeps its previous modification time
+func modifiedSince(current, previous map[string]time.Time) bool {
+	for file, t := range current {
+		if p, ok := previous[file]; !ok || !t.Equal(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact returns a copy of the settings, in which the secrets, which are set, are replaced
+// by the mask. The keys are compared case-insensitive, because the settings of viper are
+// lower case.
+func Redact(settings map[string]interface{}, keys []string) map[string]interface{} {
+	secrets := make(map[string]bool)
+	for _, key := range keys {
+		secrets[strings.ToLower(key)] = true
+	}
+	return redact(settings, "", secrets)
+}
+
+func redact(settings map[string]interface{}, prefix string, secrets map[string]bool) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(settings))
+	for key, value := range settings {
+		path := strings.ToLower(prefix + key)
+		switch v := value.(type) {
+		case map[string]interface{}:
+			redacted[key] = redact(v, path+".", secrets)
+		default:
+			if secrets[path] && fmt.Sprint(value) != "" {
+				value = Mask
+			}
+			redacted[key] = value
+		}
+	}
+	return redacted
+}
@@ -0,0 +1,162 @@
+package secret
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestResolve(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(file, []byte("from file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	testTable := []struct {
+		description string
+		password    string
+		file        string
+		expected    string
+		expectErr   bool
+	}{
+		{
+			description: "secret without file",
+			password:    "inline",
+			expected:    "inline",
+		},
+		{
+			description: "secret file takes precedence",
+			password:    "inline",
+			file:        file,
+			expected:    "from file",
+		},
+		{
+			description: "missing secret file",
+			file:        filepath.Join(dir, "missing"),
+			expectErr:   true,
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			vi := viper.New()
+			vi.Set("edge.database.password", test.password)
+			vi.Set("edge.database.password"+FileSuffix, test.file)
+
+			if err := Resolve(vi, []string{"edge.database.password"}); (err != nil) != test.expectErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if password := vi.GetString("edge.database.password"); !test.expectErr && password != test.expected {
+				t.Errorf("unexpected secret: %s != %s", password, test.expected)
+			}
+		})
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(file, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := make(chan struct{}, 1)
+	Watch([]string{file}, 10*time.Millisecond, func() {
+		changed <- struct{}{}
+	})
+
+	select {
+	case <-changed:
+		t.Fatalf("unchanged secret file is reported")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := ioutil.WriteFile(file, []byte("new"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Now().Add(time.Minute)
+	if err := os.Chtimes(file, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatalf("changed secret file is not reported")
+	}
+
+	vi := viper.New()
+	vi.Set("password", "inline")
+	vi.Set("password"+FileSuffix, file)
+	if value, err := Read(vi, "password"); err != nil || value != "new" {
+		t.Errorf("changed secret is not read: %s, %v", value, err)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	settings := map[string]interface{}{
+		"edge": map[string]interface{}{
+			"database": map[string]interface{}{
+				"password":      "secret",
+				"password_file": "/run/secrets/password",
+				"user":          "kosmos",
+			},
+			"mqtt": map[string]interface{}{
+				"password": "",
+			},
+		},
+		"analysistargets": map[string]interface{}{
+			"onprem": map[string]interface{}{
+				"usermgmt": map[string]interface{}{
+					"clientsecret": "secret",
+				},
+			},
+		},
+	}
+
+	expected := map[string]interface{}{
+		"edge": map[string]interface{}{
+			"database": map[string]interface{}{
+				"password":      Mask,
+				"password_file": "/run/secrets/password",
+				"user":          "kosmos",
+			},
+			"mqtt": map[string]interface{}{
+				"password": "",
+			},
+		},
+		"analysistargets": map[string]interface{}{
+			"onprem": map[string]interface{}{
+				"usermgmt": map[string]interface{}{
+					"clientsecret": Mask,
+				},
+			},
+		},
+	}
+
+	redacted := Redact(settings, []string{"edge.database.password", "edge.mqtt.password", "analysisTargets.onprem.userMgmt.clientSecret"})
+	if !reflect.DeepEqual(redacted, expected) {
+		t.Errorf("unexpected redacted settings: %v != %v", redacted, expected)
+	}
+
+	if settings["edge"].(map[string]interface{})["database"].(map[string]interface{})["password"] != "secret" {
+		t.Errorf("settings have been modified")
+	}
+}
@@ -0,0 +1,108 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+)
+
+// The algorithms, which are recorded in the signature meta data
+const (
+	RSASHA256   = "RSA-SHA256"
+	ECDSASHA256 = "ECDSA-SHA256"
+	Ed25519     = "Ed25519"
+)
+
+// Signer signs json messages with the key of the edge
+type Signer interface {
+	// Sign returns the base64 encoded signature of the canonicalised json data
+	Sign(data []byte) (string, error)
+	// Algorithm returns the name of the signature algorithm
+	Algorithm() string
+}
+
+type keySigner struct {
+	key       crypto.Signer
+	algorithm string
+}
+
+// NewKeySigner loads a RSA, ECDSA or Ed25519 private key in PEM format
+func NewKeySigner(path string) (Signer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in %s", path)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %s in %s", block.Type, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return keySigner{key: k, algorithm: RSASHA256}, nil
+	case *ecdsa.PrivateKey:
+		return keySigner{key: k, algorithm: ECDSASHA256}, nil
+	case ed25519.PrivateKey:
+		return keySigner{key: k, algorithm: Ed25519}, nil
+	}
+	return nil, fmt.Errorf("unsupported private key type %T", key)
+}
+
+func (k keySigner) Algorithm() string {
+	return k.algorithm
+}
+
+func (k keySigner) Sign(data []byte) (string, error) {
+	canonical, err := Canonicalise(data)
+	if err != nil {
+		return "", err
+	}
+
+	var sig []byte
+	if k.algorithm == Ed25519 {
+		// ed25519 signs the message itself and not a digest
+		sig, err = k.key.Sign(rand.Reader, canonical, crypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(canonical)
+		sig, err = k.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// SignJSON signs the json encoding of a message body
+func SignJSON(signer Signer, body interface{}) (string, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+	return signer.Sign(data)
+}
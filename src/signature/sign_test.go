@@ -0,0 +1,80 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSign(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("cannot generate rsa key: %s", err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("cannot generate ecdsa key: %s", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("cannot generate ed25519 key: %s", err)
+	}
+
+	testTable := []struct {
+		description string
+		key         crypto.Signer
+		algorithm   string
+	}{
+		{description: "rsa", key: rsaKey, algorithm: RSASHA256},
+		{description: "ecdsa", key: ecdsaKey, algorithm: ECDSASHA256},
+		{description: "ed25519", key: edKey, algorithm: Ed25519},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			dir := writeTrustStore(t, test.key.Public())
+			defer os.RemoveAll(dir)
+
+			der, err := x509.MarshalPKCS8PrivateKey(test.key)
+			if err != nil {
+				t.Fatalf("cannot marshal private key: %s", err)
+			}
+			keyFile := filepath.Join(dir, "edge.key")
+			if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+				t.Fatalf("cannot write private key: %s", err)
+			}
+
+			signer, err := NewKeySigner(keyFile)
+			if err != nil {
+				t.Fatalf("cannot load private key: %s", err)
+			}
+			if signer.Algorithm() != test.algorithm {
+				t.Errorf("unexpected algorithm: %s != %s", signer.Algorithm(), test.algorithm)
+			}
+
+			sig, err := SignJSON(signer, map[string]string{"machine": "machine", "sensor": "sensor"})
+			if err != nil {
+				t.Fatalf("cannot sign: %s", err)
+			}
+
+			// the private key is ignored by the trust store
+			verifier, err := NewTrustStore(dir)
+			if err != nil {
+				t.Fatalf("cannot load trust store: %s", err)
+			}
+
+			if err := verifier.Verify([]byte(`{"sensor": "sensor", "machine": "machine"}`), sig, signer.Algorithm()); err != nil {
+				t.Errorf("cannot verify signature: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+// Package signature contains the logic to verify and create signatures of json messages
+package signature
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog"
+)
+
+// ErrUnsigned is returned, if a message has no signature
+var ErrUnsigned = errors.New("message is not signed")
+
+// ErrInvalid is returned, if the signature cannot be verified with any trusted key
+var ErrInvalid = errors.New("signature cannot be verified with a trusted key")
+
+// Verifier verifies the signature of a json message
+type Verifier interface {
+	// Verify verifies the base64 encoded signature of the canonicalised json data. If the
+	// algorithm is empty, every trusted key is tried.
+	Verify(data []byte, signature, algorithm string) error
+}
+
+// Canonicalise returns the json data with sorted object keys and without insignificant
+// whitespace
+func Canonicalise(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// family returns the key type of a signature algorithm like RSA-SHA256 or Ed25519
+func family(algorithm string) string {
+	algorithm = strings.ToLower(algorithm)
+	switch {
+	case strings.Contains(algorithm, "ed25519"):
+		return "ed25519"
+	case strings.Contains(algorithm, "ecdsa") || strings.HasPrefix(algorithm, "es"):
+		return "ecdsa"
+	case strings.Contains(algorithm, "rsa") || strings.HasPrefix(algorithm, "rs"):
+		return "rsa"
+	}
+	return algorithm
+}
+
+type trustStore struct {
+	keys []crypto.PublicKey
+}
+
+// NewTrustStore loads every public key and certificate in PEM format of the directory
+func NewTrustStore(dir string) (Verifier, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var store trustStore
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		keys, err := parsePublicKeys(data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %s: %s", file.Name(), err)
+		}
+		klog.Infof("loaded %d trusted keys from %s", len(keys), file.Name())
+		store.keys = append(store.keys, keys...)
+	}
+
+	if len(store.keys) == 0 {
+		return nil, fmt.Errorf("no trusted key found in %s", dir)
+	}
+	return store, nil
+}
+
+// parsePublicKeys returns the public keys of all PEM blocks
+func parsePublicKeys(data []byte) ([]crypto.PublicKey, error) {
+	var keys []crypto.PublicKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return keys, nil
+		}
+
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		case "RSA PUBLIC KEY":
+			key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, cert.PublicKey)
+		}
+	}
+}
+
+func (t trustStore) Verify(data []byte, signature, algorithm string) error {
+	if signature == "" {
+		return ErrUnsigned
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		if sig, err = base64.RawURLEncoding.DecodeString(signature); err != nil {
+			return fmt.Errorf("cannot decode signature: %s", err)
+		}
+	}
+
+	canonical, err := Canonicalise(data)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(canonical)
+
+	fam := family(algorithm)
+	for _, key := range t.keys {
+		switch k := key.(type) {
+		case *rsa.PublicKey:
+			if fam != "" && fam != "rsa" {
+				continue
+			}
+			if rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) == nil {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			if fam != "" && fam != "ecdsa" {
+				continue
+			}
+			if ecdsa.VerifyASN1(k, digest[:], sig) {
+				return nil
+			}
+		case ed25519.PublicKey:
+			if fam != "" && fam != "ed25519" {
+				continue
+			}
+			if ed25519.Verify(k, canonical, sig) {
+				return nil
+			}
+		}
+	}
+
+	return ErrInvalid
+}
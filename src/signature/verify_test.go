@@ -0,0 +1,150 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTrustStore writes the public keys in PEM format into a temporary directory
+func writeTrustStore(t *testing.T, keys ...crypto.PublicKey) string {
+	dir, err := ioutil.TempDir("", "trust")
+	if err != nil {
+		t.Fatalf("cannot create trust store: %s", err)
+	}
+
+	for i, key := range keys {
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			t.Fatalf("cannot marshal public key: %s", err)
+		}
+
+		data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+		if err := ioutil.WriteFile(filepath.Join(dir, string(rune('a'+i))+".pem"), data, 0600); err != nil {
+			t.Fatalf("cannot write public key: %s", err)
+		}
+	}
+	return dir
+}
+
+func TestCanonicalise(t *testing.T) {
+	canonical, err := Canonicalise([]byte(`{ "b": [1, 2.50], "a": {"d": "<x>", "c": null} }`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := `{"a":{"c":null,"d":"<x>"},"b":[1,2.50]}`
+	if string(canonical) != expected {
+		t.Errorf("unexpected canonical json: %s != %s", canonical, expected)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("cannot generate rsa key: %s", err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("cannot generate ecdsa key: %s", err)
+	}
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("cannot generate ed25519 key: %s", err)
+	}
+
+	dir := writeTrustStore(t, &rsaKey.PublicKey, &ecdsaKey.PublicKey, edPublic)
+	defer os.RemoveAll(dir)
+
+	verifier, err := NewTrustStore(dir)
+	if err != nil {
+		t.Fatalf("cannot load trust store: %s", err)
+	}
+
+	signed := []byte(`{"machine":"machine","sensor":"sensor"}`)
+	digest := sha256.Sum256(signed)
+
+	rsaSig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("cannot sign: %s", err)
+	}
+	ecdsaSig, err := ecdsa.SignASN1(rand.Reader, ecdsaKey, digest[:])
+	if err != nil {
+		t.Fatalf("cannot sign: %s", err)
+	}
+	edSig := ed25519.Sign(edPrivate, signed)
+
+	testTable := []struct {
+		description string
+		data        string
+		signature   []byte
+		algorithm   string
+		expectErr   bool
+	}{
+		{
+			description: "rsa signature of a formatted message",
+			data:        "{\n  \"sensor\": \"sensor\",\n  \"machine\": \"machine\"\n}",
+			signature:   rsaSig,
+			algorithm:   "RSA-SHA256",
+		},
+		{
+			description: "ecdsa signature",
+			data:        string(signed),
+			signature:   ecdsaSig,
+			algorithm:   "ECDSA-SHA256",
+		},
+		{
+			description: "ed25519 signature without algorithm",
+			data:        string(signed),
+			signature:   edSig,
+		},
+		{
+			description: "tampered message",
+			data:        `{"machine":"other","sensor":"sensor"}`,
+			signature:   rsaSig,
+			algorithm:   "RSA-SHA256",
+			expectErr:   true,
+		},
+		{
+			description: "wrong algorithm",
+			data:        string(signed),
+			signature:   rsaSig,
+			algorithm:   "Ed25519",
+			expectErr:   true,
+		},
+		{
+			description: "unsigned message",
+			data:        string(signed),
+			expectErr:   true,
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			err := verifier.Verify([]byte(test.data), base64.StdEncoding.EncodeToString(test.signature), test.algorithm)
+			if (err != nil) != test.expectErr {
+				t.Errorf("unexpected verification result: %v", err)
+			}
+		})
+	}
+}
+
+func TestEmptyTrustStore(t *testing.T) {
+	dir := writeTrustStore(t)
+	defer os.RemoveAll(dir)
+
+	if _, err := NewTrustStore(dir); err == nil {
+		t.Errorf("expected error on empty trust store")
+	}
+}
@@ -0,0 +1,504 @@
+// Package target contains the analysis systems, to which the contracts and the data of
+// the sensors are sent
+package target
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"k8s.io/klog"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/auth"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/connection"
+)
+
+// Default is the name of the analysis target, which is configured in the analysisCloud
+// section. Contracts stored without definition are sent to this target.
+const Default = "cloud"
+
+// Dialer logs in at the user management and creates the connection to the endpoint of a
+// target. An empty url or user management is replaced by the configured one of the target.
+// The connection has to use the outbox with the given name.
+type Dialer func(url, userMgmt, outbox string) (auth.Auth, *connection.Connection, error)
+
+// Target is an analysis system with its own endpoint, credentials and outbox. Contracts,
+// which define their own endpoint on an allowed host, are sent to a separate connection
+// with its own session.
+type Target struct {
+	// Name is the name of the system, which is referenced in the contracts
+	Name string
+	// Interval is the upload interval of the contracts, which do not define an interval
+	Interval string
+	// Auth is the authentication at the user management of the target
+	Auth auth.Auth
+	// Connection is the connection to the configured endpoint of the target
+	Connection *connection.Connection
+	// AllowedHosts are the hosts of the endpoints and user managements, which the contracts
+	// may define; a host like *.example.com allows every subdomain
+	AllowedHosts []string
+
+	dial      Dialer
+	lock      sync.Mutex
+	endpoints map[endpoint]*session
+	contracts map[string]*session
+	// draining contains the endpoints without contract, whose outboxes are sent, before
+	// their sessions are closed
+	draining map[endpoint]*session
+}
+
+// endpoint identifies the endpoint of a contract
+type endpoint struct {
+	url      string
+	userMgmt string
+}
+
+// outbox returns the name of the outbox of the endpoint of a target
+func (e endpoint) outbox(name string) string {
+	return fmt.Sprintf("%s %s %s", name, e.url, e.userMgmt)
+}
+
+// session is the authentication and the connection of an endpoint
+type session struct {
+	auth auth.Auth
+	con  *connection.Connection
+}
+
+// New connects to the configured endpoint of a target; the dialer creates the connections
+// to the endpoints of the contracts
+func New(name, interval string, dial Dialer) (*Target, error) {
+	a, con, err := dial("", "", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Target{
+		Name:       name,
+		Interval:   interval,
+		Auth:       a,
+		Connection: con,
+		dial:       dial,
+		endpoints:  make(map[endpoint]*session),
+		contracts:  make(map[string]*session),
+		draining:   make(map[endpoint]*session),
+	}, nil
+}
+
+// Bind assigns the endpoint of a contract; the connection to the endpoint is created on
+// first use and shared by all contracts with the same endpoint. A contract without url and
+// user management uses the configured endpoint of the target. The hosts of the endpoint
+// have to be allowed, because the edge logs in with the credentials of the target.
+func (t *Target) Bind(contract, url, userMgmt string) error {
+	if url == "" && userMgmt == "" {
+		t.Unbind(contract)
+		return nil
+	}
+
+	if err := t.allowed(url, userMgmt); err != nil {
+		return err
+	}
+
+	key := endpoint{url: url, userMgmt: userMgmt}
+	t.lock.Lock()
+	s, ok := t.endpoints[key]
+	if !ok {
+		s, ok = t.reuse(key)
+	}
+	if ok {
+		t.bind(contract, s)
+		t.lock.Unlock()
+		return nil
+	}
+	t.lock.Unlock()
+
+	// the login is done without the lock, so the other contracts are not blocked by an
+	// endpoint, which does not answer
+	a, con, err := t.dial(url, userMgmt, key.outbox(t.Name))
+	if err != nil {
+		return fmt.Errorf("cannot connect to endpoint %s of target %s: %s", url, t.Name, err)
+	}
+	klog.Infof("connected to endpoint %s with user management %s of target %s", url, userMgmt, t.Name)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if s, ok = t.endpoints[key]; ok {
+		// another contract has connected to the endpoint in the meantime
+		go closeSession(t.Name, &session{auth: a, con: con})
+	} else {
+		s = &session{auth: a, con: con}
+		t.endpoints[key] = s
+	}
+	t.bind(contract, s)
+	return nil
+}
+
+// bind assigns the session to a contract and retires the previous session of the
+// contract, if no other contract uses it; the lock has to be held
+func (t *Target) bind(contract string, s *session) {
+	previous := t.contracts[contract]
+	if s == nil {
+		delete(t.contracts, contract)
+	} else {
+		t.contracts[contract] = s
+	}
+
+	if previous == nil || previous == s {
+		return
+	}
+	for _, other := range t.contracts {
+		if other == previous {
+			return
+		}
+	}
+
+	for key, other := range t.endpoints {
+		if other == previous {
+			delete(t.endpoints, key)
+			t.draining[key] = previous
+			go t.retire(key, previous)
+		}
+	}
+}
+
+// reuse binds the session of a draining endpoint again; the lock has to be held
+func (t *Target) reuse(key endpoint) (*session, bool) {
+	s, ok := t.draining[key]
+	if !ok {
+		return nil, false
+	}
+
+	delete(t.draining, key)
+	if s.con == nil || !s.con.Reuse() {
+		return nil, false
+	}
+	t.endpoints[key] = s
+	return s, true
+}
+
+// retire closes the session of an endpoint, which is not used anymore, once the messages
+// of its outbox have been sent; a session, which is bound again in the meantime, is kept
+func (t *Target) retire(key endpoint, s *session) {
+	if s.con != nil && !s.con.Retire() {
+		return
+	}
+
+	t.lock.Lock()
+	if t.draining[key] == s {
+		delete(t.draining, key)
+	}
+	t.lock.Unlock()
+
+	closeSession(t.Name, s)
+}
+
+// DrainOutboxes sends the messages, which are left in the outboxes of endpoints without
+// contract, e.g. after a restart, and closes their sessions, once the outboxes are empty.
+// The outboxes of endpoints, which are not allowed anymore, are kept.
+func (t *Target) DrainOutboxes(outboxes []string) {
+	for _, outbox := range outboxes {
+		rest := strings.TrimPrefix(outbox, t.Name+" ")
+		parts := strings.SplitN(rest, " ", 2)
+		if rest == outbox || len(parts) != 2 {
+			continue
+		}
+		go t.drainOutbox(endpoint{url: parts[0], userMgmt: parts[1]})
+	}
+}
+
+// drainOutbox connects to an endpoint without contract to send the messages of its outbox
+func (t *Target) drainOutbox(key endpoint) {
+	if err := t.allowed(key.url, key.userMgmt); err != nil {
+		klog.Errorf("cannot send the outbox of endpoint %s: %s", key.url, err)
+		return
+	}
+
+	t.lock.Lock()
+	_, bound := t.endpoints[key]
+	_, draining := t.draining[key]
+	t.lock.Unlock()
+	if bound || draining {
+		return
+	}
+
+	a, con, err := t.dial(key.url, key.userMgmt, key.outbox(t.Name))
+	if err != nil {
+		klog.Errorf("cannot connect to endpoint %s of target %s to send its outbox: %s", key.url, t.Name, err)
+		return
+	}
+
+	s := &session{auth: a, con: con}
+	t.lock.Lock()
+	_, bound = t.endpoints[key]
+	_, draining = t.draining[key]
+	if bound || draining {
+		t.lock.Unlock()
+		go closeSession(t.Name, s)
+		return
+	}
+	t.draining[key] = s
+	t.lock.Unlock()
+
+	klog.Infof("send the outbox of endpoint %s of target %s", key.url, t.Name)
+	t.retire(key, s)
+}
+
+// closeSession logs out of an endpoint and closes its connection
+func closeSession(name string, s *session) {
+	if s.auth != nil {
+		if err := s.auth.Logout(); err != nil {
+			klog.Errorf("cannot log out of an endpoint of target %s: %s", name, err)
+		}
+	}
+	if s.con != nil {
+		s.con.Close()
+	}
+}
+
+// allowed tests if the hosts of the endpoint and of the user management of a contract are
+// allowed hosts of the target
+func (t *Target) allowed(url, userMgmt string) error {
+	var hosts []string
+	if url != "" {
+		host, err := hostname(url)
+		if err != nil {
+			return fmt.Errorf("invalid endpoint %s of target %s: %s", url, t.Name, err)
+		}
+		hosts = append(hosts, host)
+	}
+	if userMgmt != "" {
+		mgmt, err := ParseUserMgmt(userMgmt, UserMgmt{Schema: "https"})
+		if err != nil {
+			return fmt.Errorf("invalid user management %s of target %s: %s", userMgmt, t.Name, err)
+		}
+		hosts = append(hosts, mgmt.Host)
+	}
+
+	for _, host := range hosts {
+		if !matchHost(host, t.AllowedHosts) {
+			return fmt.Errorf("host %s is not an allowed host of target %s", host, t.Name)
+		}
+	}
+	return nil
+}
+
+// hostname returns the host of an url
+func hostname(address string) (string, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", err
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("url has no host")
+	}
+	return u.Hostname(), nil
+}
+
+// matchHost tests if a host is one of the allowed hosts; an allowed host like
+// *.example.com matches every subdomain of example.com
+func matchHost(host string, allowed []string) bool {
+	host = strings.ToLower(host)
+	for _, a := range allowed {
+		a = strings.ToLower(a)
+		if host == a || (strings.HasPrefix(a, "*.") && strings.HasSuffix(host, a[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+// Unbind removes the endpoint assignment of a contract; the connection is closed, if no
+// other contract uses it
+func (t *Target) Unbind(contract string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.bind(contract, nil)
+}
+
+// For returns the connection of a contract; contracts without an own endpoint use the
+// configured endpoint of the target
+func (t *Target) For(contract string) *connection.Connection {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if s, ok := t.contracts[contract]; ok {
+		return s.con
+	}
+	return t.Connection
+}
+
+// Connections returns the connection to the configured endpoint and the connections to
+// the endpoints of the contracts and to the draining endpoints
+func (t *Target) Connections() []*connection.Connection {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	connections := []*connection.Connection{t.Connection}
+	for _, s := range t.endpoints {
+		connections = append(connections, s.con)
+	}
+	for _, s := range t.draining {
+		connections = append(connections, s.con)
+	}
+	return connections
+}
+
+// Logout logs out the sessions of the configured endpoint, of the endpoints of the
+// contracts and of the draining endpoints; the errors are logged
+func (t *Target) Logout() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	auths := []auth.Auth{t.Auth}
+	for _, s := range t.endpoints {
+		auths = append(auths, s.auth)
+	}
+	for _, s := range t.draining {
+		auths = append(auths, s.auth)
+	}
+
+	for _, a := range auths {
+		if a == nil {
+			continue
+		}
+		if err := a.Logout(); err != nil {
+			klog.Errorf("cannot log out of target %s: %s", t.Name, err)
+		}
+	}
+}
+
+// Redial logs in again at the configured endpoint and at the endpoints of the contracts,
+// e.g. after the credentials of the target have changed. The previous sessions are logged
+// out and their connections are closed; the messages stay in the outbox. An endpoint,
+// which cannot be dialed, keeps its previous session.
+func (t *Target) Redial() error {
+	t.lock.Lock()
+	keys := make([]endpoint, 0, len(t.endpoints))
+	for key := range t.endpoints {
+		keys = append(keys, key)
+	}
+	t.lock.Unlock()
+
+	var failed []string
+	a, con, err := t.dial("", "", t.Name)
+	if err != nil {
+		klog.Errorf("cannot connect to target %s: %s", t.Name, err)
+		failed = append(failed, "configured endpoint")
+	} else {
+		t.lock.Lock()
+		previous := &session{auth: t.Auth, con: t.Connection}
+		t.Auth, t.Connection = a, con
+		t.lock.Unlock()
+		go closeSession(t.Name, previous)
+	}
+
+	for _, key := range keys {
+		a, con, err := t.dial(key.url, key.userMgmt, key.outbox(t.Name))
+		if err != nil {
+			klog.Errorf("cannot connect to endpoint %s of target %s: %s", key.url, t.Name, err)
+			failed = append(failed, key.url)
+			continue
+		}
+
+		t.lock.Lock()
+		s, ok := t.endpoints[key]
+		previous := &session{auth: a, con: con}
+		if ok {
+			// the session is replaced in place, so the contracts keep their assignment
+			previous = &session{auth: s.auth, con: s.con}
+			s.auth, s.con = a, con
+		}
+		t.lock.Unlock()
+		go closeSession(t.Name, previous)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("cannot connect to %s of target %s", strings.Join(failed, ", "), t.Name)
+	}
+	return nil
+}
+
+// Registry contains the enabled analysis targets
+type Registry struct {
+	targets map[string]*Target
+}
+
+// NewRegistry initialise a registry with the targets
+func NewRegistry(targets ...*Target) *Registry {
+	r := &Registry{targets: make(map[string]*Target)}
+	for _, t := range targets {
+		r.targets[strings.ToLower(t.Name)] = t
+	}
+	return r
+}
+
+// Get returns the target of an analysis system; the names are compared case-insensitive
+func (r *Registry) Get(system string) (*Target, bool) {
+	if r == nil {
+		return nil, false
+	}
+
+	t, ok := r.targets[strings.ToLower(system)]
+	return t, ok
+}
+
+// Targets returns all targets ordered by their names
+func (r *Registry) Targets() []*Target {
+	if r == nil {
+		return nil
+	}
+
+	targets := make([]*Target, 0, len(r.targets))
+	for _, t := range r.targets {
+		targets = append(targets, t)
+	}
+
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Name < targets[j].Name })
+	return targets
+}
+
+// UserMgmt is the address of a user management
+type UserMgmt struct {
+	Schema string
+	Host   string
+	Path   string
+	Port   int
+}
+
+// ParseUserMgmt parses the user management of a contract like https://auth.example.com/auth.
+// An address without schema or path uses the schema or the path of the configured user
+// management and an address without port uses the default port of the schema.
+func ParseUserMgmt(address string, configured UserMgmt) (UserMgmt, error) {
+	if !strings.Contains(address, "://") {
+		address = configured.Schema + "://" + address
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return UserMgmt{}, err
+	}
+
+	parsed := UserMgmt{Schema: u.Scheme, Host: u.Hostname(), Path: strings.Trim(u.Path, "/")}
+	if parsed.Host == "" {
+		return UserMgmt{}, fmt.Errorf("user management %s has no host", address)
+	}
+
+	if parsed.Path == "" {
+		parsed.Path = configured.Path
+	}
+
+	switch {
+	case u.Port() != "":
+		if parsed.Port, err = strconv.Atoi(u.Port()); err != nil {
+			return UserMgmt{}, err
+		}
+	case parsed.Schema == "http":
+		parsed.Port = 80
+	default:
+		parsed.Port = 443
+	}
+
+	return parsed, nil
+}
@@ -0,0 +1,405 @@
+package target
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/auth"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/connection"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry(&Target{Name: "onprem"}, &Target{Name: "cloud"})
+
+	testTable := []struct {
+		description string
+		system      string
+		found       bool
+	}{
+		{
+			description: "configured target",
+			system:      "cloud",
+			found:       true,
+		},
+		{
+			description: "case-insensitive name",
+			system:      "OnPrem",
+			found:       true,
+		},
+		{
+			description: "unknown target",
+			system:      "edge",
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			if _, found := registry.Get(test.system); found != test.found {
+				t.Errorf("unexpected lookup of %s: %t != %t", test.system, found, test.found)
+			}
+		})
+	}
+
+	targets := registry.Targets()
+	if len(targets) != 2 || targets[0].Name != "cloud" || targets[1].Name != "onprem" {
+		t.Errorf("unexpected targets: %v", targets)
+	}
+
+	var empty *Registry
+	if _, found := empty.Get("cloud"); found || len(empty.Targets()) != 0 {
+		t.Errorf("nil registry contains targets")
+	}
+}
+
+func TestBind(t *testing.T) {
+	var outboxes []string
+	dial := func(url, userMgmt, outbox string) (auth.Auth, *connection.Connection, error) {
+		if url == "http://unreachable" {
+			return nil, nil, fmt.Errorf("connection refused")
+		}
+		outboxes = append(outboxes, outbox)
+		return nil, connection.NewConnection(url, nil, nil), nil
+	}
+
+	target, err := New("cloud", "1m", dial)
+	if err != nil {
+		t.Fatalf("cannot create target: %s", err)
+	}
+	target.AllowedHosts = []string{"partner", "auth.partner", "unreachable"}
+
+	if err := target.Bind("contract1", "http://partner", "auth.partner"); err != nil {
+		t.Fatalf("cannot bind contract: %s", err)
+	}
+	if err := target.Bind("contract2", "http://partner", "auth.partner"); err != nil {
+		t.Fatalf("cannot bind contract: %s", err)
+	}
+	if err := target.Bind("contract3", "", ""); err != nil {
+		t.Fatalf("cannot bind contract: %s", err)
+	}
+
+	if target.For("contract1") == target.Connection || target.For("contract1") != target.For("contract2") {
+		t.Errorf("contracts with the same endpoint do not share a separate connection")
+	}
+
+	if target.For("contract3") != target.Connection {
+		t.Errorf("contract without endpoint does not use the configured endpoint")
+	}
+
+	if err := target.Bind("contract4", "http://unreachable", ""); err == nil || target.For("contract4") != target.Connection {
+		t.Errorf("unreachable endpoint has been bound")
+	}
+
+	target.Unbind("contract1")
+	if target.For("contract1") != target.Connection {
+		t.Errorf("unbound contract does not use the configured endpoint")
+	}
+
+	if len(target.Connections()) != 2 || strings.Join(outboxes, ",") != "cloud,cloud http://partner auth.partner" {
+		t.Errorf("unexpected connections with the outboxes %v", outboxes)
+	}
+}
+
+func TestParseUserMgmt(t *testing.T) {
+	configured := UserMgmt{Schema: "https", Host: "auth.local", Path: "auth", Port: 8443}
+
+	testTable := []struct {
+		description string
+		address     string
+		expected    UserMgmt
+		expectErr   bool
+	}{
+		{
+			description: "complete address",
+			address:     "http://auth.partner:8080/realms/edge",
+			expected:    UserMgmt{Schema: "http", Host: "auth.partner", Path: "realms/edge", Port: 8080},
+		},
+		{
+			description: "host only",
+			address:     "auth.partner",
+			expected:    UserMgmt{Schema: "https", Host: "auth.partner", Path: "auth", Port: 443},
+		},
+		{
+			description: "address without host",
+			address:     "https:///auth",
+			expectErr:   true,
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			parsed, err := ParseUserMgmt(test.address, configured)
+			if (err != nil) != test.expectErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if parsed != test.expected {
+				t.Errorf("unexpected user management: %v != %v", parsed, test.expected)
+			}
+		})
+	}
+}
+
+// logoutAuth counts the logouts
+type logoutAuth struct {
+	logouts *int
+}
+
+func (a logoutAuth) Login() error {
+	return nil
+}
+
+func (a logoutAuth) Logout() error {
+	*a.logouts++
+	return nil
+}
+
+func (a logoutAuth) Refresh() (auth.Token, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+func TestLogout(t *testing.T) {
+	var logouts int
+	dial := func(url, userMgmt, outbox string) (auth.Auth, *connection.Connection, error) {
+		return logoutAuth{logouts: &logouts}, connection.NewConnection(url, nil, nil), nil
+	}
+
+	target, err := New("cloud", "1m", dial)
+	if err != nil {
+		t.Fatalf("cannot create target: %s", err)
+	}
+	target.AllowedHosts = []string{"partner", "auth.partner"}
+
+	if err := target.Bind("contract1", "http://partner", "auth.partner"); err != nil {
+		t.Fatalf("cannot bind contract: %s", err)
+	}
+
+	target.Logout()
+	if logouts != 2 {
+		t.Errorf("unexpected number of logouts: %d != 2", logouts)
+	}
+}
+
+func TestAllowedHosts(t *testing.T) {
+	var dialed []string
+	dial := func(url, userMgmt, outbox string) (auth.Auth, *connection.Connection, error) {
+		dialed = append(dialed, outbox)
+		return nil, connection.NewConnection(url, nil, nil), nil
+	}
+
+	target, err := New("cloud", "1m", dial)
+	if err != nil {
+		t.Fatalf("cannot create target: %s", err)
+	}
+	target.AllowedHosts = []string{"analysis.example.com", "*.partner.com"}
+
+	testTable := []struct {
+		description string
+		url         string
+		userMgmt    string
+		allowed     bool
+	}{
+		{
+			description: "allowed endpoint and user management",
+			url:         "https://analysis.example.com/api",
+			userMgmt:    "https://auth.partner.com/auth",
+			allowed:     true,
+		},
+		{
+			description: "allowed endpoint with configured user management",
+			url:         "https://ANALYSIS.example.com",
+			allowed:     true,
+		},
+		{
+			description: "foreign user management",
+			url:         "https://analysis.example.com",
+			userMgmt:    "attacker.com",
+		},
+		{
+			description: "foreign endpoint",
+			url:         "https://analysis.example.com.attacker.com",
+		},
+		{
+			description: "wildcard does not match the domain itself",
+			userMgmt:    "partner.com",
+		},
+		{
+			description: "endpoint without host",
+			url:         "analysis.example.com",
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			dialed = nil
+			err := target.Bind("contract", test.url, test.userMgmt)
+			if (err == nil) != test.allowed {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !test.allowed && len(dialed) != 0 {
+				t.Errorf("endpoint, which is not allowed, has been dialed")
+			}
+		})
+	}
+}
+
+// releaseAuth reports its logout on a channel
+type releaseAuth struct {
+	released chan string
+	name     string
+}
+
+func (a releaseAuth) Login() error {
+	return nil
+}
+
+func (a releaseAuth) Logout() error {
+	a.released <- a.name
+	return nil
+}
+
+func (a releaseAuth) Refresh() (auth.Token, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+func TestRelease(t *testing.T) {
+	released := make(chan string, 4)
+	dial := func(url, userMgmt, outbox string) (auth.Auth, *connection.Connection, error) {
+		return releaseAuth{released: released, name: url}, connection.NewConnection(url, nil, nil), nil
+	}
+
+	target, err := New("cloud", "1m", dial)
+	if err != nil {
+		t.Fatalf("cannot create target: %s", err)
+	}
+	target.AllowedHosts = []string{"first", "second"}
+
+	for _, contract := range []string{"contract1", "contract2"} {
+		if err := target.Bind(contract, "http://first", ""); err != nil {
+			t.Fatalf("cannot bind contract: %s", err)
+		}
+	}
+
+	target.Unbind("contract1")
+	if err := target.Bind("contract2", "http://second", ""); err != nil {
+		t.Fatalf("cannot bind contract: %s", err)
+	}
+
+	select {
+	case name := <-released:
+		if name != "http://first" {
+			t.Errorf("unexpected endpoint has been released: %s", name)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("unused endpoint has not been released")
+	}
+
+	if len(target.Connections()) != 2 {
+		t.Errorf("unexpected number of connections: %d", len(target.Connections()))
+	}
+
+	target.Unbind("contract2")
+	select {
+	case name := <-released:
+		if name != "http://second" {
+			t.Errorf("unexpected endpoint has been released: %s", name)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("unused endpoint has not been released")
+	}
+
+	if len(target.Connections()) != 1 {
+		t.Errorf("unexpected number of connections: %d", len(target.Connections()))
+	}
+}
+
+func TestRedial(t *testing.T) {
+	released := make(chan string, 4)
+	var dials int
+	dial := func(url, userMgmt, outbox string) (auth.Auth, *connection.Connection, error) {
+		dials++
+		name := fmt.Sprintf("%s#%d", url, dials)
+		return releaseAuth{released: released, name: name}, connection.NewConnection(url, nil, nil), nil
+	}
+
+	target, err := New("cloud", "1m", dial)
+	if err != nil {
+		t.Fatalf("cannot create target: %s", err)
+	}
+	target.AllowedHosts = []string{"first"}
+
+	if err := target.Bind("contract", "http://first", ""); err != nil {
+		t.Fatalf("cannot bind contract: %s", err)
+	}
+	configured, bound := target.For("other"), target.For("contract")
+
+	if err := target.Redial(); err != nil {
+		t.Fatalf("cannot redial target: %s", err)
+	}
+
+	var logouts []string
+	for len(logouts) < 2 {
+		select {
+		case name := <-released:
+			logouts = append(logouts, name)
+		case <-time.After(time.Second):
+			t.Fatalf("previous sessions have not been logged out: %v", logouts)
+		}
+	}
+	sort.Strings(logouts)
+	if strings.Join(logouts, ",") != "#1,http://first#2" {
+		t.Errorf("unexpected sessions have been logged out: %v", logouts)
+	}
+
+	if target.For("other") == configured || target.For("contract") == bound {
+		t.Errorf("connections have not been replaced")
+	}
+
+	if len(target.Connections()) != 2 {
+		t.Errorf("unexpected number of connections: %d", len(target.Connections()))
+	}
+}
+
+func TestDrainOutboxes(t *testing.T) {
+	released := make(chan string, 4)
+	dialed := make(chan string, 4)
+	dial := func(url, userMgmt, outbox string) (auth.Auth, *connection.Connection, error) {
+		dialed <- outbox
+		return releaseAuth{released: released, name: url}, connection.NewConnection(url, nil, nil), nil
+	}
+
+	target, err := New("cloud", "1m", dial)
+	if err != nil {
+		t.Fatalf("cannot create target: %s", err)
+	}
+	<-dialed
+	target.AllowedHosts = []string{"first"}
+
+	target.DrainOutboxes([]string{"cloud", "cloud http://first ", "cloud http://denied ", "other http://first "})
+
+	select {
+	case outbox := <-dialed:
+		if outbox != "cloud http://first " {
+			t.Errorf("unexpected outbox has been dialed: %q", outbox)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("left outbox has not been dialed")
+	}
+
+	select {
+	case name := <-released:
+		if name != "http://first" {
+			t.Errorf("unexpected endpoint has been released: %s", name)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("drained endpoint has not been released")
+	}
+
+	select {
+	case outbox := <-dialed:
+		t.Errorf("unexpected outbox has been dialed: %q", outbox)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,207 @@
+// Package tlsconfig contains the tls configuration of the outbound connections, whose
+// certificates are reloaded, when their files change
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// Config defines the certificates of a tls connection; empty files are not used
+type Config struct {
+	// CA is the PEM bundle of the certificate authorities, which are trusted instead of
+	// the certificate authorities of the system
+	CA string
+	// Cert is the PEM client certificate of mutual tls
+	Cert string
+	// Key is the PEM private key of the client certificate
+	Key string
+	// ServerName overrides the name, which is expected in the certificate of the server
+	ServerName string
+}
+
+// Reloader provides the tls configuration of a Config with the latest certificates
+type Reloader struct {
+	config Config
+
+	lock     sync.RWMutex
+	roots    *x509.CertPool
+	cert     *tls.Certificate
+	modified map[string]time.Time
+}
+
+// New loads the certificates of a configuration
+func New(config Config) (*Reloader, error) {
+	r := &Reloader{config: config}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load reads the certificate files and replaces the certificates
+func (r *Reloader) load() error {
+	if (r.config.Cert == "") != (r.config.Key == "") {
+		return fmt.Errorf("client certificate and key have to be configured together")
+	}
+
+	modified, err := r.modTimes()
+	if err != nil {
+		return err
+	}
+
+	var roots *x509.CertPool
+	if r.config.CA != "" {
+		pem, err := ioutil.ReadFile(r.config.CA)
+		if err != nil {
+			return fmt.Errorf("cannot read ca bundle: %s", err)
+		}
+
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("ca bundle %s contains no certificate", r.config.CA)
+		}
+	}
+
+	var cert *tls.Certificate
+	if r.config.Cert != "" {
+		c, err := tls.LoadX509KeyPair(r.config.Cert, r.config.Key)
+		if err != nil {
+			return fmt.Errorf("cannot load client certificate: %s", err)
+		}
+		cert = &c
+	}
+
+	r.lock.Lock()
+	r.roots, r.cert, r.modified = roots, cert, modified
+	r.lock.Unlock()
+	return nil
+}
+
+// modTimes returns the modification times of the configured files
+func (r *Reloader) modTimes() (map[string]time.Time, error) {
+	modified := make(map[string]time.Time)
+	for _, file := range []string{r.config.CA, r.config.Cert, r.config.Key} {
+		if file == "" {
+			continue
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		modified[file] = info.ModTime()
+	}
+	return modified, nil
+}
+
+// changed returns true, if a file has been modified since the last load
+func (r *Reloader) changed() bool {
+	modified, err := r.modTimes()
+	if err != nil {
+		klog.Errorf("cannot check the certificates: %s", err)
+		return false
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for file, t := range modified {
+		if !t.Equal(r.modified[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch reloads the certificates in every interval, if their files have changed; the
+// previous certificates are kept, if the changed files cannot be loaded
+func (r *Reloader) Watch(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if !r.changed() {
+				continue
+			}
+
+			if err := r.load(); err != nil {
+				klog.Errorf("cannot reload the changed certificates: %s", err)
+				continue
+			}
+			klog.Infof("reloaded the certificates %s", r)
+		}
+	}()
+}
+
+// String returns the configured files
+func (r *Reloader) String() string {
+	return fmt.Sprintf("ca=%s cert=%s key=%s", r.config.CA, r.config.Cert, r.config.Key)
+}
+
+// TLSConfig returns the tls configuration, which always uses the latest certificates
+func (r *Reloader) TLSConfig() *tls.Config {
+	config := &tls.Config{
+		ServerName: r.config.ServerName,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			r.lock.RLock()
+			defer r.lock.RUnlock()
+			if r.cert == nil {
+				return &tls.Certificate{}, nil
+			}
+			return r.cert, nil
+		},
+	}
+
+	if r.config.CA == "" {
+		return config
+	}
+
+	// the default verification uses the certificate authorities of the creation of the
+	// configuration, so the chain is verified with the latest certificate authorities
+	config.InsecureSkipVerify = true
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		return r.verify(state)
+	}
+	return config
+}
+
+// verify verifies the certificate chain of a server with the latest certificate authorities
+func (r *Reloader) verify(state tls.ConnectionState) error {
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("server has not sent a certificate")
+	}
+
+	r.lock.RLock()
+	roots := r.roots
+	r.lock.RUnlock()
+
+	name := r.config.ServerName
+	if name == "" {
+		name = state.ServerName
+	}
+	if name == "" {
+		// a server, which is addressed by its ip address, does not receive the name by sni,
+		// so the certificate could not be matched against the server
+		return fmt.Errorf("the name of the server is unknown, configure the server name of the tls section")
+	}
+
+	opts := x509.VerifyOptions{DNSName: name, Roots: roots, Intermediates: x509.NewCertPool()}
+	for _, cert := range state.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	_, err := state.PeerCertificates[0].Verify(opts)
+	return err
+}
@@ -0,0 +1,221 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// authority is a certificate authority, which issues the certificates of the tests
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newAuthority(t *testing.T, name string) authority {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authority{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a certificate of the authority and its private key in PEM format
+func (a authority) issue(t *testing.T, name string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, a.cert, &key.PublicKey, a.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func writeFile(t *testing.T, file string, data []byte, modified time.Time) {
+	if err := ioutil.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(file, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tlsconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	serverCA, clientCA, otherCA := newAuthority(t, "server ca"), newAuthority(t, "client ca"), newAuthority(t, "other ca")
+	serverCert, serverKey := serverCA.issue(t, "analysis.local", x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := clientCA.issue(t, "edge", x509.ExtKeyUsageClientAuth)
+
+	cert, err := tls.X509KeyPair(serverCert, serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clients := x509.NewCertPool()
+	clients.AddCert(clientCA.cert)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{cert}, ClientCAs: clients, ClientAuth: tls.RequireAndVerifyClientCert}
+	ts.StartTLS()
+	defer ts.Close()
+
+	config := Config{
+		CA:         filepath.Join(dir, "ca.pem"),
+		Cert:       filepath.Join(dir, "cert.pem"),
+		Key:        filepath.Join(dir, "key.pem"),
+		ServerName: "analysis.local",
+	}
+	modified := time.Now().Add(-time.Minute)
+	writeFile(t, config.CA, serverCA.pem, modified)
+	writeFile(t, config.Cert, clientCert, modified)
+	writeFile(t, config.Key, clientKey, modified)
+
+	r, err := New(config)
+	if err != nil {
+		t.Fatalf("cannot load certificates: %s", err)
+	}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: r.TLSConfig()}}
+	get := func() error {
+		res, err := client.Get(ts.URL)
+		if err == nil {
+			err = res.Body.Close()
+		}
+		client.CloseIdleConnections()
+		return err
+	}
+
+	if err := get(); err != nil {
+		t.Errorf("cannot connect with the certificates: %s", err)
+	}
+
+	if r.changed() {
+		t.Errorf("unchanged certificates are reported as changed")
+	}
+
+	writeFile(t, config.CA, otherCA.pem, time.Now())
+	if !r.changed() {
+		t.Fatalf("changed ca bundle has not been detected")
+	}
+	if err := r.load(); err != nil {
+		t.Fatalf("cannot reload certificates: %s", err)
+	}
+
+	if err := get(); err == nil {
+		t.Errorf("server certificate of an untrusted ca has been accepted")
+	}
+
+	if _, err := New(Config{Cert: config.Cert}); err == nil {
+		t.Errorf("client certificate without key has been accepted")
+	}
+
+	if _, err := New(Config{CA: config.Key}); err == nil {
+		t.Errorf("ca bundle without certificate has been accepted")
+	}
+}
+
+func TestServerName(t *testing.T) {
+	ca := newAuthority(t, "ca")
+	serverCert, _ := ca.issue(t, "analysis.local", x509.ExtKeyUsageServerAuth)
+
+	block, _ := pem.Decode(serverCert)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	testTable := []struct {
+		description string
+		serverName  string
+		sni         string
+		expectErr   bool
+	}{
+		{
+			description: "matching host",
+			sni:         "analysis.local",
+		},
+		{
+			description: "server name override",
+			serverName:  "analysis.local",
+			sni:         "10.0.0.1",
+		},
+		{
+			description: "mismatching host",
+			sni:         "other.local",
+			expectErr:   true,
+		},
+		{
+			description: "server without name",
+			expectErr:   true,
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			r := &Reloader{config: Config{ServerName: test.serverName}, roots: roots}
+			err := r.verify(tls.ConnectionState{ServerName: test.sni, PeerCertificates: []*x509.Certificate{cert}})
+			if (err != nil) != test.expectErr {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
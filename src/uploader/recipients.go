@@ -0,0 +1,73 @@
+package uploader
+
+import (
+	"sort"
+	"strings"
+)
+
+// Audit is the audit entry of a batch, which has been forwarded to an analysis target
+type Audit struct {
+	Target     string
+	Contract   string
+	Machine    string
+	Sensor     string
+	Recipients []string
+	// Updates is the number of sensor updates of the batch
+	Updates int
+	// Bytes is the size of the uploaded batch
+	Bytes int
+	// Queued is true, if the batch could not be sent and is kept in the outbox
+	Queued bool
+}
+
+// SetAudit defines the function, which records the audit entry of every forwarded batch
+func (u *Sensor) SetAudit(audit func(Audit) error) {
+	u.audit = audit
+}
+
+// SetRecipients defines the partners of a contract, which are permitted to read its data.
+// The batches of the contract are forwarded to these recipients; the batches are dropped,
+// if no partner has the read permission.
+func (u *Sensor) SetRecipients(contract string, recipients []string) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.recipients[contract] = append([]string{}, recipients...)
+}
+
+// RemoveRecipients removes the restriction of a contract, whose batches are forwarded
+// without recipients afterwards
+func (u *Sensor) RemoveRecipients(contract string) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	delete(u.recipients, contract)
+}
+
+// contractRecipients returns the recipients of the batches of a contract; false is
+// returned, if the batches of the contract are not restricted
+func (u *Sensor) contractRecipients(contract string) ([]string, bool) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	recipients, ok := u.recipients[contract]
+	return recipients, ok
+}
+
+// Recipients returns the partners, which have the read permission; the partners are
+// returned sorted and without duplicates
+func Recipients(partners, read []string) []string {
+	permitted := make(map[string]bool)
+	for _, v := range read {
+		permitted[strings.TrimSpace(v)] = true
+	}
+
+	recipients := []string{}
+	for _, v := range partners {
+		v = strings.TrimSpace(v)
+		if permitted[v] {
+			recipients = append(recipients, v)
+			delete(permitted, v)
+		}
+	}
+
+	sort.Strings(recipients)
+	return recipients
+}
@@ -0,0 +1,75 @@
+package uploader
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/buffer"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/connection"
+)
+
+func TestRecipients(t *testing.T) {
+	testTable := []struct {
+		description string
+		partners    []string
+		read        []string
+		expected    string
+	}{
+		{
+			description: "partners with read permission",
+			partners:    []string{"partner2", "partner1", "partner3"},
+			read:        []string{"partner1", "partner2", "other"},
+			expected:    "partner1,partner2",
+		},
+		{
+			description: "duplicated partners",
+			partners:    []string{"partner1", " partner1"},
+			read:        []string{"partner1"},
+			expected:    "partner1",
+		},
+		{
+			description: "partners without read permission",
+			partners:    []string{"partner1"},
+			read:        []string{"other"},
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			recipients := Recipients(test.partners, test.read)
+			if strings.Join(recipients, ",") != test.expected {
+				t.Errorf("unexpected recipients: %v != %s", recipients, test.expected)
+			}
+		})
+	}
+}
+
+func TestUploadWithoutRecipients(t *testing.T) {
+	var u Sensor
+	u.Init(buffer.NewLocalBuffer(), nil)
+	u.SetAudit(func(a Audit) error {
+		t.Errorf("dropped batch has been audited: %v", a)
+		return nil
+	})
+
+	s := stream{machine: "machine", sensor: "sensor", route: Route{Target: "cloud", Contract: "contract", Pipeline: -1}}
+	u.handlers[s] = &handler{fire: make(chan struct{}, 1)}
+	u.SetRecipients("contract", nil)
+	u.Insert("machine", "sensor", connection.SensorData{})
+
+	u.upload(context.Background(), s)
+
+	if values := u.buf.GetValues("machine", s.key()); len(values) != 0 {
+		t.Errorf("updates of the dropped batch are still buffered: %d", len(values))
+	}
+
+	if _, restricted := u.contractRecipients("contract"); !restricted {
+		t.Errorf("contract is not restricted")
+	}
+
+	u.RemoveRecipients("contract")
+	if _, restricted := u.contractRecipients("contract"); restricted {
+		t.Errorf("contract is still restricted")
+	}
+}
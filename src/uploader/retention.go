@@ -0,0 +1,238 @@
+package uploader
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"k8s.io/klog"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/connection"
+)
+
+var purgedUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "analysis_connector_retention_purged_updates_total",
+	Help: "The number of buffered sensor updates, which are purged because their retention has ended",
+}, []string{"contract", "reason"})
+
+// Retention is the storage duration of the data of a contract sensor; a zero duration is
+// unlimited
+type Retention struct {
+	// Edge is the duration, for which the updates are kept in the buffer of the edge
+	Edge time.Duration
+	// Analysis is the duration, in which the updates may be forwarded to the analysis
+	// targets; batches, which are kept in the outbox, expire at its end
+	Analysis time.Duration
+}
+
+// retentionState is the retention of a contract sensor with the number of purged updates
+type retentionState struct {
+	Retention
+	purged  int
+	expired int
+}
+
+// ParseRetention parses a storage duration like 12h or 30d
+func ParseRetention(duration string) (time.Duration, error) {
+	if strings.HasSuffix(duration, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(duration, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("cannot parse days of storage duration %s: %s", duration, err)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(duration)
+}
+
+// SetRetention defines the storage duration of the updates of a contract sensor
+func (u *Sensor) SetRetention(contract, sensor string, retention Retention) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	sensors, ok := u.retention[contract]
+	if !ok {
+		sensors = make(map[string]*retentionState)
+		u.retention[contract] = sensors
+	}
+
+	if state, ok := sensors[sensor]; ok {
+		state.Retention = retention
+		return
+	}
+	sensors[sensor] = &retentionState{Retention: retention}
+}
+
+// RemoveRetention removes the storage durations of the sensors of a contract
+func (u *Sensor) RemoveRetention(contract string) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	delete(u.retention, contract)
+}
+
+// streamRetention returns the retention of a stream; the caller has to hold the lock
+func (u *Sensor) streamRetention(s stream) *retentionState {
+	return u.retention[s.route.Contract][s.sensor]
+}
+
+// StartPurge purges the updates, whose retention on the edge has ended, from the buffer
+// in every interval
+func (u *Sensor) StartPurge(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-u.purgeQuit:
+				return
+			case now := <-ticker.C:
+				u.purge(now)
+			}
+		}
+	}()
+}
+
+// purge removes the updates from the buffer, which are older than the retention on the
+// edge
+func (u *Sensor) purge(now time.Time) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	for s := range u.handlers {
+		state := u.streamRetention(s)
+		if state == nil || state.Edge <= 0 {
+			continue
+		}
+
+		data := u.buf.GetValues(s.machine, s.key())
+		kept := expire(data, state.Edge, now)
+		for _, v := range kept {
+			u.buf.Insert(s.machine, s.key(), v)
+		}
+
+		if purged := len(data) - len(kept); purged > 0 {
+			klog.Infof("purged %d updates of %s, their retention on the edge has ended", purged, s)
+			state.purged += purged
+			purgedUpdates.WithLabelValues(s.route.Contract, "edge").Add(float64(purged))
+		}
+	}
+}
+
+// applyRetention removes the updates of a batch, whose retention has ended, and returns
+// the expiry of the batch in the outbox, which is the end of the analysis retention of its
+// oldest update
+func (u *Sensor) applyRetention(s stream, data []connection.SensorData, now time.Time) ([]connection.SensorData, time.Time) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	state := u.streamRetention(s)
+	if state == nil {
+		return data, time.Time{}
+	}
+
+	kept := expire(expire(data, state.Edge, now), state.Analysis, now)
+	if expired := len(data) - len(kept); expired > 0 {
+		klog.Warningf("%d updates of %s are not forwarded, their retention has ended", expired, s)
+		state.expired += expired
+		purgedUpdates.WithLabelValues(s.route.Contract, "analysis").Add(float64(expired))
+	}
+
+	if state.Analysis <= 0 {
+		return kept, time.Time{}
+	}
+
+	var expires time.Time
+	for _, v := range kept {
+		if ts, err := time.Parse(time.RFC3339, v.Body.Timestamp); err == nil {
+			if end := ts.Add(state.Analysis); expires.IsZero() || end.Before(expires) {
+				expires = end
+			}
+		}
+	}
+	return kept, expires
+}
+
+// expire returns the updates, which are not older than the maximal age; updates without
+// a parsable timestamp are kept
+func expire(data []connection.SensorData, age time.Duration, now time.Time) []connection.SensorData {
+	if age <= 0 {
+		return data
+	}
+
+	var kept []connection.SensorData
+	for _, v := range data {
+		ts, err := time.Parse(time.RFC3339, v.Body.Timestamp)
+		if err == nil && now.Sub(ts) > age {
+			continue
+		}
+		kept = append(kept, v)
+	}
+	return kept
+}
+
+// SensorRetention is the retention of a sensor of a contract
+type SensorRetention struct {
+	Sensor   string `json:"sensor"`
+	Edge     string `json:"edge,omitempty"`
+	Analysis string `json:"analysis,omitempty"`
+	// Purged is the number of updates, which have been purged from the buffer
+	Purged int `json:"purged"`
+	// Expired is the number of updates, which have not been forwarded
+	Expired int `json:"expired"`
+}
+
+// RetentionReport is the retention of the sensors of a contract
+type RetentionReport struct {
+	Contract string            `json:"contract"`
+	Sensors  []SensorRetention `json:"sensors"`
+}
+
+// Retention returns the retention reports of the contracts ordered by the contracts
+func (u *Sensor) Retention() []RetentionReport {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	duration := func(d time.Duration) string {
+		if d <= 0 {
+			return ""
+		}
+		return d.String()
+	}
+
+	reports := []RetentionReport{}
+	for contract, sensors := range u.retention {
+		report := RetentionReport{Contract: contract}
+		for sensor, state := range sensors {
+			report.Sensors = append(report.Sensors, SensorRetention{
+				Sensor:   sensor,
+				Edge:     duration(state.Edge),
+				Analysis: duration(state.Analysis),
+				Purged:   state.purged,
+				Expired:  state.expired,
+			})
+		}
+		sort.Slice(report.Sensors, func(i, j int) bool { return report.Sensors[i].Sensor < report.Sensors[j].Sensor })
+		reports = append(reports, report)
+	}
+
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Contract < reports[j].Contract })
+	return reports
+}
+
+// ServeHTTP returns the retention reports of the contracts as json
+func (u *Sensor) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(u.Retention()); err != nil {
+		klog.Errorf("cannot encode retention reports: %s", err)
+	}
+}
@@ -0,0 +1,92 @@
+package uploader
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/buffer"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/connection"
+)
+
+func TestParseRetention(t *testing.T) {
+	testTable := []struct {
+		description string
+		duration    string
+		expected    time.Duration
+		expectErr   bool
+	}{
+		{
+			description: "duration",
+			duration:    "12h",
+			expected:    12 * time.Hour,
+		},
+		{
+			description: "days",
+			duration:    "30d",
+			expected:    30 * 24 * time.Hour,
+		},
+		{
+			description: "invalid days",
+			duration:    "xd",
+			expectErr:   true,
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			duration, err := ParseRetention(test.duration)
+			if (err != nil) != test.expectErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if duration != test.expected {
+				t.Errorf("unexpected duration: %s != %s", duration, test.expected)
+			}
+		})
+	}
+}
+
+func TestRetention(t *testing.T) {
+	now := time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)
+	update := func(timestamp string) connection.SensorData {
+		var data connection.SensorData
+		data.Body.Timestamp = timestamp
+		return data
+	}
+
+	var u Sensor
+	u.Init(buffer.NewLocalBuffer(), nil)
+	s := stream{machine: "machine", sensor: "sensor", route: Route{Target: "cloud", Contract: "contract", Pipeline: -1}}
+	u.handlers[s] = &handler{fire: make(chan struct{}, 1)}
+	u.SetRetention("contract", "sensor", Retention{Edge: 24 * time.Hour, Analysis: 12 * time.Hour})
+
+	u.Insert("machine", "sensor", update("2020-12-31T00:00:00Z"))
+	u.Insert("machine", "sensor", update("2021-01-01T06:00:00Z"))
+	u.Insert("machine", "sensor", update("2021-01-01T18:00:00Z"))
+	u.Insert("machine", "sensor", update("unknown"))
+
+	u.purge(now)
+	data := u.buf.GetValues("machine", s.key())
+	if len(data) != 3 {
+		t.Fatalf("unexpected number of updates after the purge: %d", len(data))
+	}
+
+	kept, expires := u.applyRetention(s, data, now)
+	if len(kept) != 2 || kept[0].Body.Timestamp != "2021-01-01T18:00:00Z" {
+		t.Errorf("unexpected forwarded updates: %v", kept)
+	}
+
+	if !expires.Equal(time.Date(2021, 1, 2, 6, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected expiry of the batch: %s", expires)
+	}
+
+	reports := u.Retention()
+	if len(reports) != 1 || len(reports[0].Sensors) != 1 {
+		t.Fatalf("unexpected retention reports: %v", reports)
+	}
+
+	expected := SensorRetention{Sensor: "sensor", Edge: "24h0m0s", Analysis: "12h0m0s", Purged: 1, Expired: 1}
+	if reports[0].Sensors[0] != expected {
+		t.Errorf("unexpected retention report: %v != %v", reports[0].Sensors[0], expected)
+	}
+}
@@ -0,0 +1,47 @@
+package uploader
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Route identifies the pipeline of a contract on an analysis target, which is fed with the
+// data of a machine sensor combination. A negative pipeline identifies a contract without
+// pipelines.
+type Route struct {
+	Target   string
+	Contract string
+	Pipeline int
+}
+
+func (r Route) String() string {
+	if r.Pipeline < 0 {
+		return fmt.Sprintf("%s/%s", r.Target, r.Contract)
+	}
+	return fmt.Sprintf("%s/%s/%d", r.Target, r.Contract, r.Pipeline)
+}
+
+// queryArgs returns the query arguments, which tag an upload with the pipeline
+func (r Route) queryArgs() map[string]string {
+	args := map[string]string{"contract": r.Contract}
+	if r.Pipeline >= 0 {
+		args["pipeline"] = strconv.Itoa(r.Pipeline)
+	}
+	return args
+}
+
+// stream is the data of a machine sensor combination, which is routed to a pipeline
+type stream struct {
+	machine string
+	sensor  string
+	route   Route
+}
+
+func (s stream) String() string {
+	return fmt.Sprintf("machine %s sensor %s route %s", s.machine, s.sensor, s.route)
+}
+
+// key returns the key of the stream in the buffer
+func (s stream) key() string {
+	return fmt.Sprintf("%s#%s", s.sensor, s.route)
+}
@@ -0,0 +1,66 @@
+package uploader
+
+import (
+	"testing"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/buffer"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/connection"
+)
+
+func TestRouteQueryArgs(t *testing.T) {
+	testTable := []struct {
+		description string
+		route       Route
+		name        string
+		pipeline    string
+	}{
+		{
+			description: "pipeline route",
+			route:       Route{Target: "cloud", Contract: "contract", Pipeline: 2},
+			name:        "cloud/contract/2",
+			pipeline:    "2",
+		},
+		{
+			description: "contract without pipelines",
+			route:       Route{Target: "cloud", Contract: "contract", Pipeline: -1},
+			name:        "cloud/contract",
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			if test.route.String() != test.name {
+				t.Errorf("unexpected name of the route: %s != %s", test.route, test.name)
+			}
+
+			args := test.route.queryArgs()
+			if args["contract"] != "contract" || args["pipeline"] != test.pipeline {
+				t.Errorf("unexpected query arguments: %v", args)
+			}
+		})
+	}
+}
+
+func TestInsertRoutes(t *testing.T) {
+	var u Sensor
+	u.Init(buffer.NewLocalBuffer(), nil)
+	for _, pipeline := range []int{0, 1} {
+		s := stream{machine: "machine", sensor: "sensor", route: Route{Contract: "contract", Pipeline: pipeline}}
+		u.handlers[s] = &handler{fire: make(chan struct{}, 1)}
+	}
+
+	u.Insert("machine", "sensor", connection.SensorData{})
+	u.Insert("machine", "unrouted", connection.SensorData{})
+
+	if n := u.Discard("machine", "sensor", Route{Contract: "contract", Pipeline: 1}); n != 1 {
+		t.Errorf("unexpected number of updates of the pipeline: %d", n)
+	}
+
+	if n := u.Discard("machine", "sensor", Route{Contract: "contract", Pipeline: 0}); n != 1 {
+		t.Errorf("unexpected number of buffered updates of the other pipeline: %d", n)
+	}
+
+	if values := u.buf.GetValues("machine", "unrouted"); len(values) != 0 {
+		t.Errorf("update of an unrouted sensor has been buffered: %d", len(values))
+	}
+}
@@ -1,127 +1,390 @@
 package uploader
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"k8s.io/klog"
 
 	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/buffer"
 	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/connection"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/reject"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/schema"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/signature"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/target"
 )
 
-// Sensor contains the logic to upload data to analysis cloud
+// Sensor contains the logic to upload data to the analysis targets. The updates of a
+// machine sensor combination are buffered separately for every route and each route is
+// uploaded to its target, when its triggers fire. It implements buffer.Inserter, so that
+// the count and event triggers are evaluated on every inserted update. The batches of a
+// contract are only forwarded to the partners, which have the read permission.
 type Sensor struct {
-	buf          buffer.Data
-	con          *connection.Connection
-	quitChannels map[string]map[string]chan bool
+	buf        buffer.Data
+	targets    *target.Registry
+	signer     signature.Signer
+	validator  *schema.Validator
+	rejecter   *reject.Rejecter
+	audit      func(Audit) error
+	handlers   map[stream]*handler
+	recipients map[string][]string
+	retention  map[string]map[string]*retentionState
+	purgeQuit  chan struct{}
+	purgeOnce  sync.Once
+	// stopped are the streams, whose handlers have been stopped by the shutdown
+	stopped []stream
+	// ctx is canceled at the deadline of the shutdown to cancel the running uploads
+	ctx    context.Context
+	cancel context.CancelFunc
+	lock   sync.Mutex
+	wg     sync.WaitGroup
 }
 
-// Init initialise the connection to the analysis cloud
-func (u *Sensor) Init(buf buffer.Data, con *connection.Connection) {
-	//var quitChanel map[string]map[string]chan bool
-	//quitChanel = map[string]map[string]chan bool{}
-	//u := Sensor{buf: buf, con: con, quitChannels: quitChanel}
+// handler contains the state of the upload handler of a stream
+type handler struct {
+	triggers []Trigger
+	// count is the number of inserted updates since the last upload
+	count int
+	quit  chan bool
+	fire  chan struct{}
+}
+
+// Init initialise the buffer and the analysis targets, to which the data is uploaded
+func (u *Sensor) Init(buf buffer.Data, targets *target.Registry) {
 	u.buf = buf
-	u.con = con
-	u.quitChannels = make(map[string]map[string]chan bool)
+	u.targets = targets
+	u.handlers = make(map[stream]*handler)
+	u.recipients = make(map[string][]string)
+	u.retention = make(map[string]map[string]*retentionState)
+	u.purgeQuit = make(chan struct{})
+	u.ctx, u.cancel = context.WithCancel(context.Background())
 }
 
-// GetBuffer returns a pointer to the buffer of the uploader
-func (u *Sensor) GetBuffer() *buffer.Data {
-	return &u.buf
+// SetSigner defines the signer, which signs every uploaded sensor update
+func (u *Sensor) SetSigner(signer signature.Signer) {
+	u.signer = signer
 }
 
-// StartHandler starts a handler for a given machine sensor combination
-func (u Sensor) StartHandler(machine, sensor string, interval time.Duration) {
-	_, ok := u.quitChannels[machine]
-	if !ok {
-		u.quitChannels[machine] = make(map[string]chan bool)
+// SetValidator defines the validator of the uploaded sensor updates; invalid batches are
+// rejected instead of uploaded
+func (u *Sensor) SetValidator(validator *schema.Validator, rejecter *reject.Rejecter) {
+	u.validator = validator
+	u.rejecter = rejecter
+}
+
+// Insert buffers an update for every route of the machine sensor combination and fires
+// the upload of a route, if one of its count or event triggers matches. Updates of a
+// machine sensor combination without route are dropped.
+func (u *Sensor) Insert(machine, sensor string, update connection.SensorData) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	for s, h := range u.handlers {
+		if s.machine != machine || s.sensor != sensor {
+			continue
+		}
+
+		u.buf.Insert(machine, s.key(), update)
+
+		h.count++
+		fire := false
+		if n := count(h.triggers); n > 0 && h.count >= n {
+			fire = true
+		}
+		for _, trigger := range h.triggers {
+			if trigger.matches(update) {
+				fire = true
+			}
+		}
+
+		if fire {
+			select {
+			case h.fire <- struct{}{}:
+			default:
+				// an upload is already pending
+			}
+		}
 	}
+}
 
-	if _, ok := u.quitChannels[machine][sensor]; ok {
+// Discard removes the buffered updates of a route of a machine sensor combination and
+// returns the number of removed updates
+func (u *Sensor) Discard(machine, sensor string, route Route) int {
+	s := stream{machine: machine, sensor: sensor, route: route}
+	return len(u.buf.GetValues(machine, s.key()))
+}
+
+// StartHandler starts a handler for a route of a machine sensor combination, which
+// uploads the buffered data whenever one of the triggers fires
+func (u *Sensor) StartHandler(machine, sensor string, route Route, triggers []Trigger) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.start(stream{machine: machine, sensor: sensor, route: route}, triggers)
+}
+
+func (u *Sensor) start(s stream, triggers []Trigger) {
+	if _, ok := u.handlers[s]; ok {
 		return
 	}
 
-	channel := make(chan bool, 1)
-	u.quitChannels[machine][sensor] = channel
-	go u.handler(interval, machine, sensor, channel)
+	h := &handler{
+		triggers: triggers,
+		quit:     make(chan bool),
+		fire:     make(chan struct{}, 1),
+	}
+	// the updates, which are recovered from a previous run, are uploaded at once
+	if p, ok := u.buf.(buffer.Pending); ok && p.Pending(s.machine, s.key()) > 0 {
+		h.fire <- struct{}{}
+	}
+	u.handlers[s] = h
+	u.wg.Add(1)
+	go u.handler(s, h)
 }
 
-// Stop stops an specific handler defined by machine and sensor
-func (u *Sensor) Stop(machine, sensor string) {
-	u.stop(machine, sensor)
-	delete(u.quitChannels[machine], sensor)
-	if len(u.quitChannels[machine]) == 0 {
-		delete(u.quitChannels, machine)
-	}
+// Stop stops the handler of a route of a machine sensor combination
+func (u *Sensor) Stop(machine, sensor string, route Route) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.stop(stream{machine: machine, sensor: sensor, route: route})
 }
 
-// ChangeInterval change the interval, which uploads a specific
-func (u *Sensor) ChangeInterval(machine, sensor string, interval time.Duration) {
-	klog.Infof("stop requested machine %s sensor %s", machine, sensor)
-	channel := u.stop(machine, sensor)
-	klog.Infof("stopped %s, %s sensor", machine, sensor)
-	if channel == nil {
-		u.StartHandler(machine, sensor, interval)
-		return
+// ChangeTriggers changes the triggers, which upload the data of a route of a machine
+// sensor combination; the handler is started, if it is not running
+func (u *Sensor) ChangeTriggers(machine, sensor string, route Route, triggers []Trigger) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	s := stream{machine: machine, sensor: sensor, route: route}
+	u.stop(s)
+	u.start(s, triggers)
+}
+
+// Shutdown stops all handlers and uploads the buffered data of every route a last time.
+// At the end of the context the running uploads are canceled and the remaining data is
+// stored in the outbox, so that it is uploaded after the restart.
+func (u *Sensor) Shutdown(ctx context.Context) {
+	streams := u.stopAll()
+
+	stopped := make(chan struct{})
+	go func() {
+		u.wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		u.cancel()
+		<-stopped
 	}
 
-	go u.handler(interval, machine, sensor, channel)
+	for _, s := range streams {
+		if ctx.Err() != nil {
+			klog.Warningf("final upload of %s is stored in the outbox: %s", s, ctx.Err())
+		} else {
+			klog.Infof("final upload of %s", s)
+		}
+		u.upload(ctx, s)
+	}
+}
+
+// Persist stores the buffered data of every route in the outbox without uploading it; it
+// is the last step of a shutdown, whose final uploads have not finished or not started
+// before the deadline
+func (u *Sensor) Persist() {
+	streams := u.stopAll()
+	u.cancel()
+	u.wg.Wait()
+
+	for _, s := range streams {
+		u.upload(u.ctx, s)
+	}
 }
 
-func (u *Sensor) stop(machine, sensor string) chan bool {
-	if _, ok := u.quitChannels[machine]; !ok {
-		return nil
+// stopAll stops the running handlers and the purge and returns every stream, which has
+// been stopped by the shutdown
+func (u *Sensor) stopAll() []stream {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	for s := range u.handlers {
+		u.stopped = append(u.stopped, s)
+		u.stop(s)
 	}
-	channel, ok := u.quitChannels[machine][sensor]
+	u.purgeOnce.Do(func() {
+		close(u.purgeQuit)
+	})
+	return append([]stream(nil), u.stopped...)
+}
+
+func (u *Sensor) stop(s stream) {
+	h, ok := u.handlers[s]
 	if !ok {
-		return nil
+		return
 	}
 
-	channel <- true
-	return channel
+	close(h.quit)
+	delete(u.handlers, s)
 }
 
-func (u *Sensor) handler(interval time.Duration, machine, sensor string, quit chan bool) {
-	klog.Infof("handler of machine %s sensor %s with interval %v has been started", machine, sensor, interval)
-	var nextIteration bool = true
-	go func() {
-		<-quit
-		nextIteration = false
-	}()
+func (u *Sensor) handler(s stream, h *handler) {
+	defer u.wg.Done()
+	klog.Infof("handler of %s with triggers %v has been started", s, h.triggers)
+
+	// a nil channel blocks forever, if there is no time trigger
+	var tick <-chan time.Time
+	if d := interval(h.triggers); d > 0 {
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
 	for {
-		klog.Infof("next iteration of machine %s and upload %s sensor has begun", machine, sensor)
-		if !nextIteration {
+		select {
+		case <-h.quit:
+			klog.Infof("handler of %s has been stopped", s)
 			return
+		case <-tick:
+			klog.Infof("time trigger of %s has been fired", s)
+		case <-h.fire:
+			klog.Infof("update trigger of %s has been fired", s)
 		}
-		time.Sleep(interval)
-		klog.Infof("sleeping interval has been finished of machine %s and upload %s", machine, sensor)
-		data := u.buf.GetValues(machine, sensor)
 
-		klog.Infof("handling machine %s sensor %s with the length of data %d", machine, sensor, len(data))
+		u.lock.Lock()
+		h.count = 0
+		u.lock.Unlock()
+		u.upload(u.ctx, s)
+	}
+}
 
-		// do not upload empty data
-		if len(data) == 0 {
-			continue
+// upload sends the buffered data of a stream to the target of the route; the batch is
+// tagged with the contract, the pipeline and the recipients of the route. Updates, whose
+// retention has ended, are not uploaded and the batch expires in the outbox at the end of
+// the analysis retention.
+func (u *Sensor) upload(ctx context.Context, s stream) {
+	data := u.buf.GetValues(s.machine, s.key())
+
+	klog.Infof("handling %s with the length of data %d", s, len(data))
+
+	// do not upload empty data
+	if len(data) == 0 {
+		return
+	}
+
+	// the updates are signed before the retention is applied, so that the original batch
+	// can be kept for the next upload
+	signed, err := u.sign(data)
+	if err != nil {
+		klog.Errorf("cannot sign data of %s: %s", s, err)
+		for _, v := range data {
+			u.buf.Insert(s.machine, s.key(), v)
 		}
+		return
+	}
 
-		encodedData, err := json.Marshal(data)
-		if err != nil {
-			klog.Errorf("cannot marshal data: %s", err)
+	data, expires := u.applyRetention(s, signed, time.Now())
+	if len(data) == 0 {
+		return
+	}
+
+	args := s.route.queryArgs()
+	recipients, restricted := u.contractRecipients(s.route.Contract)
+	if restricted {
+		if len(recipients) == 0 {
+			klog.Warningf("drop %d updates of %s, no partner of contract %s has the read permission", len(data), s, s.route.Contract)
+			return
 		}
+		args["recipients"] = strings.Join(recipients, ",")
+	}
 
-		klog.Infof("upload data to analysis cloud of machine %s and sensor %s", machine, sensor)
-		req, err := u.con.Request("POST", "machine-data", nil, strings.NewReader(string(encodedData)))
-		if err != nil {
-			klog.Errorf("cannot upload data, this data is not stores by this program: %s", err)
+	t, ok := u.targets.Get(s.route.Target)
+	if !ok {
+		klog.Errorf("cannot upload data of %s, the analysis target is not configured", s)
+		return
+	}
+
+	encodedData, err := json.Marshal(data)
+	if err != nil {
+		klog.Errorf("cannot marshal data: %s", err)
+		return
+	}
+
+	queue := fmt.Sprintf("%s/%s/%s", s.machine, s.sensor, s.route)
+	if err := u.validator.Validate(schema.MachineData, encodedData); err != nil {
+		u.rejecter.Reject("machineData", reject.Schema, "machine-data", encodedData, err)
+		// the batch has been removed from the buffer, so it is kept in the dead letters
+		if err := t.For(s.route.Contract).DeadLetter(queue, "POST", "machine-data", args, encodedData, err.Error()); err != nil {
+			klog.Errorf("cannot dead letter data of %s, the data is dropped: %s", s, err)
+		}
+		return
+	}
+
+	klog.Infof("upload data of %s to analysis target %s", s, t.Name)
+	req, err := t.For(s.route.Contract).RequestExpiringContext(ctx, queue, "POST", "machine-data", args, strings.NewReader(string(encodedData)), expires)
+	if errors.Is(err, connection.ErrNotStored) {
+		klog.Errorf("cannot store data of %s in the outbox: %s", s, err)
+		// keep the data for the next upload
+		for _, v := range data {
+			u.buf.Insert(s.machine, s.key(), v)
+		}
+		return
+	}
+	if u.audit != nil {
+		audit := Audit{
+			Target:     t.Name,
+			Contract:   s.route.Contract,
+			Machine:    s.machine,
+			Sensor:     s.sensor,
+			Recipients: recipients,
+			Updates:    len(data),
+			Bytes:      len(encodedData),
+			Queued:     err != nil,
+		}
+		if err := u.audit(audit); err != nil {
+			klog.Errorf("cannot record audit of %s: %s", s, err)
+		}
+	}
+	if err != nil {
+		klog.Errorf("cannot upload data, the data is kept in the outbox: %s", err)
+		return
+	}
+
+	defer func() {
+		if err := req.Body.Close(); err != nil {
+			klog.Errorf("cannot close response body: %s", err)
 		}
-		klog.Infof("data upload has been finished of machine %s and sensor %s", machine, sensor)
+	}()
+	klog.Infof("data upload has been finished of %s", s)
 
-		if req.StatusCode != 201 && req.StatusCode != 200 {
-			klog.Errorf("cannot upload data, status code %d is been returned", req.StatusCode)
+	if req.StatusCode != 201 && req.StatusCode != 200 {
+		klog.Errorf("cannot upload data, status code %d is been returned", req.StatusCode)
+	}
+}
+
+// sign returns a signed copy of the updates; the signature meta data records the date and
+// the algorithm of the signature like the meta data of a contract
+func (u *Sensor) sign(data []connection.SensorData) ([]connection.SensorData, error) {
+	if u.signer == nil {
+		return data, nil
+	}
+
+	signed := make([]connection.SensorData, len(data))
+	for i, v := range data {
+		sig, err := signature.SignJSON(u.signer, v.Body)
+		if err != nil {
+			return nil, err
 		}
 
+		signed[i] = v
+		signed[i].Signature = sig
+		signed[i].SignatureMeta = &connection.SignatureMeta{
+			Date:      time.Now().UTC().Format(time.RFC3339),
+			Algorithm: u.signer.Algorithm(),
+		}
 	}
+	return signed, nil
 }
@@ -0,0 +1,99 @@
+package uploader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/auth"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/buffer"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/connection"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/target"
+)
+
+// fakeSigner signs every message with the signature "signature" or fails
+type fakeSigner struct {
+	fail bool
+}
+
+func (f fakeSigner) Sign(data []byte) (string, error) {
+	if f.fail {
+		return "", errors.New("signer is not available")
+	}
+	return "signature", nil
+}
+
+func (fakeSigner) Algorithm() string {
+	return "fake"
+}
+
+func TestUploadSignature(t *testing.T) {
+	testTable := []struct {
+		description string
+		fail        bool
+	}{
+		{
+			description: "signed batch",
+		},
+		{
+			description: "signer fails",
+			fail:        true,
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			outbox := &memoryOutbox{}
+			dial := func(url, userMgmt, name string) (auth.Auth, *connection.Connection, error) {
+				return nil, connection.NewConnection("http://unreachable", nil, outbox), nil
+			}
+			cloud, err := target.New("cloud", "1m", dial)
+			if err != nil {
+				t.Fatalf("cannot create target: %s", err)
+			}
+
+			var u Sensor
+			u.Init(buffer.NewLocalBuffer(), target.NewRegistry(cloud))
+			u.SetSigner(fakeSigner{fail: test.fail})
+
+			s := stream{machine: "machine", sensor: "sensor", route: Route{Target: "cloud", Contract: "contract", Pipeline: -1}}
+			update := connection.SensorData{Body: connection.SensorDataBody{Machine: "machine", Sensor: "sensor", Timestamp: "2021-01-01T00:00:00Z"}}
+			u.buf.Insert("machine", s.key(), update)
+			u.buf.Insert("machine", s.key(), update)
+
+			// the batch is only stored in the outbox
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			u.upload(ctx, s)
+
+			kept := u.buf.GetValues("machine", s.key())
+			messages := outbox.Query()
+			if test.fail {
+				if len(messages) != 0 || len(kept) != 2 {
+					t.Fatalf("batch is not kept in the buffer, %d messages, %d updates", len(messages), len(kept))
+				}
+				for _, v := range kept {
+					if v.Signature != "" || v.SignatureMeta != nil {
+						t.Errorf("kept update is modified: %v", v)
+					}
+				}
+				return
+			}
+
+			if len(messages) != 1 || len(kept) != 0 {
+				t.Fatalf("batch is not uploaded, %d messages, %d updates", len(messages), len(kept))
+			}
+
+			var data []connection.SensorData
+			if err := json.Unmarshal(messages[0].Message, &data); err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range data {
+				if v.Signature != "signature" || v.SignatureMeta == nil || v.SignatureMeta.Algorithm != "fake" || v.SignatureMeta.Date == "" {
+					t.Errorf("unexpected signature of update: %v", v)
+				}
+			}
+		})
+	}
+}
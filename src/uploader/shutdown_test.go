@@ -0,0 +1,74 @@
+package uploader
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/auth"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/buffer"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/connection"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/target"
+)
+
+// memoryOutbox is an outbox, which keeps the messages in memory
+type memoryOutbox struct {
+	lock     sync.Mutex
+	messages []connection.Message
+}
+
+func (o *memoryOutbox) Close() error { return nil }
+
+func (o *memoryOutbox) Insert(msg []connection.Message) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for i := range msg {
+		msg[i].ID = uint(len(o.messages) + 1)
+		o.messages = append(o.messages, msg[i])
+	}
+	return nil
+}
+
+func (o *memoryOutbox) Remove(msg []connection.Message) error { return nil }
+
+func (o *memoryOutbox) Query() []connection.Message {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return append([]connection.Message(nil), o.messages...)
+}
+
+func (o *memoryOutbox) Queued(queue string, before uint) bool { return false }
+
+func (o *memoryOutbox) Reschedule(msg connection.Message) error { return nil }
+
+func (o *memoryOutbox) DeadLetter(msg connection.Message, reason string) error { return nil }
+
+func (o *memoryOutbox) Target(name string) connection.Persist { return o }
+
+func (o *memoryOutbox) Outboxes() ([]string, error) { return nil, nil }
+
+func TestShutdownAfterDeadline(t *testing.T) {
+	outbox := &memoryOutbox{}
+	dial := func(url, userMgmt, name string) (auth.Auth, *connection.Connection, error) {
+		return nil, connection.NewConnection("http://unreachable", nil, outbox), nil
+	}
+	cloud, err := target.New("cloud", "1m", dial)
+	if err != nil {
+		t.Fatalf("cannot create target: %s", err)
+	}
+
+	var u Sensor
+	u.Init(buffer.NewLocalBuffer(), target.NewRegistry(cloud))
+	route := Route{Target: "cloud", Contract: "contract", Pipeline: -1}
+	u.StartHandler("machine", "sensor", route, nil)
+	u.Insert("machine", "sensor", connection.SensorData{Body: connection.SensorDataBody{Machine: "machine", Sensor: "sensor"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	u.Shutdown(ctx)
+
+	messages := outbox.Query()
+	if len(messages) != 1 || messages[0].Attempts != 0 {
+		t.Errorf("buffered data is not stored in the outbox after the deadline: %v", messages)
+	}
+}
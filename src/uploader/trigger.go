@@ -0,0 +1,120 @@
+package uploader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/connection"
+)
+
+// The supported types of the ml-trigger of a pipeline
+const (
+	TimeTrigger  = "time"
+	CountTrigger = "count"
+	EventTrigger = "event"
+)
+
+// Trigger decides when the buffered data of a machine sensor combination is uploaded
+type Trigger struct {
+	Type string
+	// Interval is the duration between two uploads of a time trigger
+	Interval time.Duration
+	// Count is the number of updates, after which a count trigger uploads the data
+	Count int
+	// MetaName and MetaValue define the meta data of the update, which fires an event
+	// trigger; an empty name matches every meta data
+	MetaName  string
+	MetaValue string
+}
+
+// ParseTrigger parses the ml-trigger definition of a pipeline. The after definition is a
+// duration for time triggers, a number of updates for count triggers and a meta value
+// or a name=value pair of the meta data for event triggers.
+func ParseTrigger(triggerType, after string) (Trigger, error) {
+	switch strings.ToLower(triggerType) {
+	case TimeTrigger:
+		interval, err := time.ParseDuration(after)
+		if err != nil {
+			return Trigger{}, fmt.Errorf("cannot parse duration of time trigger: %s", err)
+		}
+		if interval <= 0 {
+			return Trigger{}, fmt.Errorf("duration of time trigger has to be positive: %s", after)
+		}
+		return Trigger{Type: TimeTrigger, Interval: interval}, nil
+	case CountTrigger:
+		count, err := strconv.Atoi(after)
+		if err != nil {
+			return Trigger{}, fmt.Errorf("cannot parse count of count trigger: %s", err)
+		}
+		if count <= 0 {
+			return Trigger{}, fmt.Errorf("count of count trigger has to be positive: %s", after)
+		}
+		return Trigger{Type: CountTrigger, Count: count}, nil
+	case EventTrigger:
+		if after == "" {
+			return Trigger{}, fmt.Errorf("event trigger without meta value")
+		}
+		trigger := Trigger{Type: EventTrigger, MetaValue: after}
+		if i := strings.Index(after, "="); i >= 0 {
+			trigger.MetaName = after[:i]
+			trigger.MetaValue = after[i+1:]
+		}
+		return trigger, nil
+	}
+	return Trigger{}, fmt.Errorf("unknown trigger type %s", triggerType)
+}
+
+func (t Trigger) String() string {
+	switch t.Type {
+	case TimeTrigger:
+		return fmt.Sprintf("time after %s", t.Interval)
+	case CountTrigger:
+		return fmt.Sprintf("count after %d", t.Count)
+	case EventTrigger:
+		if t.MetaName == "" {
+			return fmt.Sprintf("event on %s", t.MetaValue)
+		}
+		return fmt.Sprintf("event on %s=%s", t.MetaName, t.MetaValue)
+	}
+	return t.Type
+}
+
+// matches returns true, if the update fires the event trigger
+func (t Trigger) matches(update connection.SensorData) bool {
+	if t.Type != EventTrigger {
+		return false
+	}
+
+	for _, meta := range update.Body.Meta {
+		if (t.MetaName == "" || meta.Name == t.MetaName) && meta.Value == t.MetaValue {
+			return true
+		}
+	}
+	return false
+}
+
+// interval returns the shortest interval of the time triggers; 0 is returned, if there is
+// no time trigger
+func interval(triggers []Trigger) time.Duration {
+	var min time.Duration
+	for _, t := range triggers {
+		if t.Type == TimeTrigger && (min == 0 || t.Interval < min) {
+			min = t.Interval
+		}
+	}
+	return min
+}
+
+// count returns the smallest count of the count triggers; 0 is returned, if there is no
+// count trigger
+func count(triggers []Trigger) int {
+	var min int
+	for _, t := range triggers {
+		if t.Type == CountTrigger && (min == 0 || t.Count < min) {
+			min = t.Count
+		}
+	}
+	return min
+}
@@ -0,0 +1,185 @@
+package uploader
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/auth"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/buffer"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/connection"
+	"github.com/kosmos-industrie40/kosmos-analyse-connector/src/target"
+)
+
+func TestParseTrigger(t *testing.T) {
+	testTable := []struct {
+		description string
+		triggerType string
+		after       string
+		expected    Trigger
+		expectErr   bool
+	}{
+		{
+			description: "time trigger",
+			triggerType: "time",
+			after:       "30s",
+			expected:    Trigger{Type: TimeTrigger, Interval: 30 * time.Second},
+		},
+		{
+			description: "count trigger",
+			triggerType: "Count",
+			after:       "50",
+			expected:    Trigger{Type: CountTrigger, Count: 50},
+		},
+		{
+			description: "event trigger on a meta value",
+			triggerType: "event",
+			after:       "error",
+			expected:    Trigger{Type: EventTrigger, MetaValue: "error"},
+		},
+		{
+			description: "event trigger on a named meta value",
+			triggerType: "event",
+			after:       "state=error",
+			expected:    Trigger{Type: EventTrigger, MetaName: "state", MetaValue: "error"},
+		},
+		{
+			description: "negative count",
+			triggerType: "count",
+			after:       "-1",
+			expectErr:   true,
+		},
+		{
+			description: "unknown type",
+			triggerType: "cron",
+			after:       "* * * * *",
+			expectErr:   true,
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			trigger, err := ParseTrigger(test.triggerType, test.after)
+			if (err != nil) != test.expectErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if trigger != test.expected {
+				t.Errorf("unexpected trigger: %v != %v", trigger, test.expected)
+			}
+		})
+	}
+}
+
+func TestInsertFiresTrigger(t *testing.T) {
+	update := func(state string) connection.SensorData {
+		var data connection.SensorData
+		data.Body.Meta = []connection.Meta{{Name: "state", Value: state}}
+		return data
+	}
+
+	testTable := []struct {
+		description string
+		triggers    []Trigger
+		updates     []connection.SensorData
+		fired       bool
+	}{
+		{
+			description: "count reached",
+			triggers:    []Trigger{{Type: CountTrigger, Count: 2}},
+			updates:     []connection.SensorData{update("ok"), update("ok")},
+			fired:       true,
+		},
+		{
+			description: "count not reached",
+			triggers:    []Trigger{{Type: CountTrigger, Count: 3}},
+			updates:     []connection.SensorData{update("ok"), update("ok")},
+		},
+		{
+			description: "matching event",
+			triggers:    []Trigger{{Type: EventTrigger, MetaName: "state", MetaValue: "error"}},
+			updates:     []connection.SensorData{update("ok"), update("error")},
+			fired:       true,
+		},
+		{
+			description: "time trigger only",
+			triggers:    []Trigger{{Type: TimeTrigger, Interval: time.Hour}},
+			updates:     []connection.SensorData{update("error")},
+		},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.description, func(t *testing.T) {
+			var u Sensor
+			u.Init(buffer.NewLocalBuffer(), nil)
+
+			// the handler is not started, so that the fired upload stays pending
+			h := &handler{triggers: test.triggers, fire: make(chan struct{}, 1)}
+			u.handlers[stream{machine: "machine", sensor: "sensor", route: Route{Contract: "contract", Pipeline: 0}}] = h
+
+			for _, v := range test.updates {
+				u.Insert("machine", "sensor", v)
+			}
+
+			fired := len(h.fire) == 1
+			if fired != test.fired {
+				t.Errorf("unexpected firing of the triggers: %t != %t", fired, test.fired)
+			}
+
+			if n := u.Discard("machine", "sensor", Route{Contract: "contract", Pipeline: 0}); n != len(test.updates) {
+				t.Errorf("unexpected number of buffered updates: %d", n)
+			}
+		})
+	}
+}
+
+func TestStartUploadsRecoveredUpdates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buffer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	route := Route{Target: "cloud", Contract: "contract", Pipeline: -1}
+	s := stream{machine: "machine", sensor: "sensor", route: route}
+
+	previous, err := buffer.NewFileBuffer(dir)
+	if err != nil {
+		t.Fatalf("cannot create file buffer: %s", err)
+	}
+	previous.Insert("machine", s.key(), connection.SensorData{Body: connection.SensorDataBody{Machine: "machine", Sensor: "sensor"}})
+
+	// a new buffer on the same directory simulates a restart of the connector
+	buf, err := buffer.NewFileBuffer(dir)
+	if err != nil {
+		t.Fatalf("cannot recreate file buffer: %s", err)
+	}
+
+	outbox := &memoryOutbox{}
+	dial := func(url, userMgmt, name string) (auth.Auth, *connection.Connection, error) {
+		return nil, connection.NewConnection("http://unreachable", nil, outbox), nil
+	}
+	cloud, err := target.New("cloud", "1m", dial)
+	if err != nil {
+		t.Fatalf("cannot create target: %s", err)
+	}
+
+	var u Sensor
+	u.Init(buf, target.NewRegistry(cloud))
+	// the time trigger does not fire during the test
+	u.StartHandler("machine", "sensor", route, []Trigger{{Type: TimeTrigger, Interval: time.Hour}})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(outbox.Query()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	u.Shutdown(ctx)
+
+	if messages := outbox.Query(); len(messages) != 1 {
+		t.Errorf("recovered updates are not uploaded after the start of the handler: %v", messages)
+	}
+}